@@ -2,11 +2,16 @@ package errlog
 
 import (
 	"context"
+	"encoding"
 	"fmt"
 	"io"
 	"log/slog"
 	"runtime"
+	"strconv"
+	"strings"
 	"sync"
+	"unicode"
+	"unicode/utf8"
 )
 
 // ANSI color codes
@@ -23,16 +28,29 @@ const (
 )
 
 // ConsoleHandler is a slog.Handler that writes log records to the console with colorized output.
+// A record is written as a single line: time, level, message, then key=value attributes.
+// The keys of grouped attributes are dotted paths, like req.method=GET. Values with spaces,
+// quotes or '=' are quoted.
 type ConsoleHandler struct {
-	w           io.Writer
-	opts        slog.HandlerOptions
-	mu          *sync.Mutex
-	attrs       []slog.Attr
-	groups      []string
-	colorize    bool
-	levelColors map[slog.Level]string
+	w            io.Writer
+	opts         ConsoleHandlerOptions
+	mu           *sync.Mutex
+	preformat    []byte        // Attributes of WithAttrs, already formatted
+	preformatErr []prettyError // Errors of WithAttrs, with PrettyErrors
+	groups       []string      // Groups of WithGroup, prefix of the attributes added later
+	colorize     bool
+	levelColors  map[slog.Level]string
 }
 
+// prettyError is an error attribute written after the record line
+type prettyError struct {
+	key string
+	err error
+}
+
+// levelWidth is the length of the longest default level name, the level column with MessageWidth
+const levelWidth = 5
+
 // Enabled reports whether the handler handles records at the given level.
 func (c *ConsoleHandler) Enabled(ctx context.Context, level slog.Level) bool {
 	minLevel := slog.LevelInfo
@@ -44,85 +62,287 @@ func (c *ConsoleHandler) Enabled(ctx context.Context, level slog.Level) bool {
 
 // Handle formats and writes a log record to the console with colorized output.
 func (c *ConsoleHandler) Handle(ctx context.Context, record slog.Record) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
 	// Format the log record
 	var buf []byte
+	var errs *[]prettyError
+	if c.opts.PrettyErrors {
+		errs = &[]prettyError{}
+		*errs = append(*errs, c.preformatErr...)
+	}
 
 	// Add time if not zero
-	if !record.Time.IsZero() {
-		timeStr := record.Time.Format("2006-01-02T15:04:05.000Z07:00")
-		buf = append(buf, timeStr...)
-		buf = append(buf, ' ')
+	if !record.Time.IsZero() && c.opts.TimeFormat != "-" {
+		if attr, ok := c.replaceBuiltin(slog.Time(slog.TimeKey, record.Time)); ok {
+			buf = c.appendValue(buf, attr.Value)
+			buf = append(buf, ' ')
+		}
 	}
 
 	// Add level with color
-	levelColor := c.getLevelColor(record.Level)
-	if c.colorize {
-		buf = append(buf, levelColor...)
-	}
-	buf = append(buf, record.Level.String()...)
-	if c.colorize {
-		buf = append(buf, colorReset...)
+	if attr, ok := c.replaceBuiltin(slog.Any(slog.LevelKey, record.Level)); ok {
+		if c.colorize {
+			buf = append(buf, c.getLevelColor(record.Level)...)
+		}
+		start := len(buf)
+		buf = c.appendValue(buf, attr.Value)
+		if c.opts.MessageWidth > 0 {
+			buf = appendPadding(buf, levelWidth-(len(buf)-start))
+		}
+		if c.colorize {
+			buf = append(buf, colorReset...)
+		}
+		buf = append(buf, ' ')
 	}
-	buf = append(buf, ' ')
 
 	// Add message
-	buf = append(buf, record.Message...)
+	if attr, ok := c.replaceBuiltin(slog.String(slog.MessageKey, record.Message)); ok {
+		start := len(buf)
+		if attr.Value.Kind() == slog.KindString {
+			buf = append(buf, attr.Value.String()...)
+		} else {
+			buf = c.appendValue(buf, attr.Value)
+		}
+		if c.opts.MessageWidth > 0 {
+			buf = appendPadding(buf, c.opts.MessageWidth-utf8.RuneCount(buf[start:]))
+		}
+	}
 
 	// Add source if enabled
 	if c.opts.AddSource && record.PC != 0 {
 		frames := runtime.CallersFrames([]uintptr{record.PC})
 		frame, _ := frames.Next()
 		if frame.File != "" {
-			buf = append(buf, ' ')
-			buf = append(buf, fmt.Sprintf("source=%s:%d", frame.File, frame.Line)...)
+			source := &slog.Source{Function: frame.Function, File: frame.File, Line: frame.Line}
+			if attr, ok := c.replaceBuiltin(slog.Any(slog.SourceKey, source)); ok {
+				buf = append(buf, ' ')
+				buf = c.appendKey(buf, attr.Key)
+				buf = c.appendValue(buf, attr.Value)
+			}
 		}
 	}
 
-	// Add attributes
-	for _, attr := range c.attrs {
-		buf = append(buf, ' ')
-		buf = append(buf, attr.Key...)
-		buf = append(buf, '=')
-		buf = append(buf, fmt.Sprintf("%v", attr.Value.Any())...)
-	}
+	// Add attributes of WithAttrs
+	buf = append(buf, c.preformat...)
 
-	// Add attributes from the record
+	// Add attributes from the record, prefixed with the groups
+	prefix := groupPrefix(c.groups)
 	record.Attrs(func(attr slog.Attr) bool {
-		buf = append(buf, ' ')
-
-		// Add group prefix to key if there are groups
-		if len(c.groups) > 0 {
-			for i, group := range c.groups {
-				buf = append(buf, group...)
-				if i < len(c.groups)-1 || attr.Key != "" {
-					buf = append(buf, '.')
-				}
-			}
-		}
-
-		buf = append(buf, attr.Key...)
-		buf = append(buf, '=')
-		buf = append(buf, fmt.Sprintf("%v", attr.Value.Any())...)
+		buf = c.appendAttr(buf, errs, c.groups, prefix, attr)
 		return true
 	})
 
 	buf = append(buf, '\n')
+	if errs != nil {
+		for _, e := range *errs {
+			buf = c.appendPrettyError(buf, e)
+		}
+	}
 
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	_, err := c.w.Write(buf)
 	return err
 }
 
+// replaceBuiltin applies ReplaceAttr to a built-in attribute. It returns false if the attribute is removed.
+func (c *ConsoleHandler) replaceBuiltin(attr slog.Attr) (slog.Attr, bool) {
+	if c.opts.ReplaceAttr == nil {
+		return attr, true
+	}
+	attr = c.opts.ReplaceAttr(nil, attr)
+	attr.Value = attr.Value.Resolve()
+	return attr, attr.Key != ""
+}
+
+// appendAttr appends " key=value" for the attribute, or for every attribute of a group.
+// groups are the names of the enclosing groups, prefix is their dotted form.
+// Errors are collected in errs instead if it isn't nil.
+func (c *ConsoleHandler) appendAttr(buf []byte, errs *[]prettyError, groups []string, prefix string, attr slog.Attr) []byte {
+	attr.Value = attr.Value.Resolve()
+	if attr.Value.Kind() == slog.KindGroup {
+		groupAttrs := attr.Value.Group()
+		if len(groupAttrs) == 0 {
+			return buf
+		}
+		// A group without a key is inlined
+		if attr.Key != "" {
+			groups = append(sliceClone(groups), attr.Key)
+			prefix += attr.Key + "."
+		}
+		for _, ga := range groupAttrs {
+			buf = c.appendAttr(buf, errs, groups, prefix, ga)
+		}
+		return buf
+	}
+
+	if c.opts.ReplaceAttr != nil {
+		attr = c.opts.ReplaceAttr(groups, attr)
+		attr.Value = attr.Value.Resolve()
+	}
+	// Empty attributes, and the ones removed by ReplaceAttr are ignored
+	if attr.Key == "" {
+		return buf
+	}
+	if attr.Value.Kind() == slog.KindGroup {
+		// ReplaceAttr returned a group
+		return c.appendAttr(buf, errs, groups, prefix, attr)
+	}
+	if err, ok := attr.Value.Any().(error); ok && errs != nil && attr.Value.Kind() == slog.KindAny {
+		*errs = append(*errs, prettyError{key: prefix + attr.Key, err: err})
+		return buf
+	}
+
+	buf = append(buf, ' ')
+	buf = c.appendKey(buf, prefix+attr.Key)
+	return c.appendValue(buf, attr.Value)
+}
+
+// appendKey appends "key=", with the key color
+func (c *ConsoleHandler) appendKey(buf []byte, key string) []byte {
+	if c.colorize {
+		buf = append(buf, c.opts.KeyColor...)
+	}
+	buf = appendString(buf, key)
+	if c.colorize {
+		buf = append(buf, colorReset...)
+	}
+	return append(buf, '=')
+}
+
+// appendPrettyError appends the error on its own line, followed by the stack frames of
+// the first StackTracer in the chain
+func (c *ConsoleHandler) appendPrettyError(buf []byte, e prettyError) []byte {
+	buf = append(buf, "    "...)
+	if c.colorize {
+		buf = append(buf, c.getLevelColor(slog.LevelError)...)
+	}
+	buf = append(buf, e.key...)
+	buf = append(buf, ": "...)
+	buf = append(buf, e.err.Error()...)
+	if c.colorize {
+		buf = append(buf, colorReset...)
+	}
+	buf = append(buf, '\n')
+
+	for _, frame := range StackFrames(e.err, c.opts.StackTrace) {
+		buf = fmt.Appendf(buf, "        at %s\n", frame)
+	}
+	return buf
+}
+
+// appendPadding appends n spaces, if n is positive
+func appendPadding(buf []byte, n int) []byte {
+	for range n {
+		buf = append(buf, ' ')
+	}
+	return buf
+}
+
+// appendValue appends a resolved, non-group value, quoted if needed
+func (c *ConsoleHandler) appendValue(buf []byte, v slog.Value) []byte {
+	switch v.Kind() {
+	case slog.KindString:
+		return appendString(buf, v.String())
+	case slog.KindInt64:
+		return strconv.AppendInt(buf, v.Int64(), 10)
+	case slog.KindUint64:
+		return strconv.AppendUint(buf, v.Uint64(), 10)
+	case slog.KindFloat64:
+		return strconv.AppendFloat(buf, v.Float64(), 'g', -1, 64)
+	case slog.KindBool:
+		return strconv.AppendBool(buf, v.Bool())
+	case slog.KindDuration:
+		return append(buf, v.Duration().String()...)
+	case slog.KindTime:
+		return appendString(buf, v.Time().Format(c.timeFormat()))
+	}
+
+	switch x := v.Any().(type) {
+	case slog.Level:
+		return append(buf, c.levelName(x)...)
+	case *slog.Source:
+		return appendString(buf, fmt.Sprintf("%s:%d", x.File, x.Line))
+	case error:
+		return appendString(buf, x.Error())
+	case encoding.TextMarshaler:
+		text, err := x.MarshalText()
+		if err != nil {
+			return appendString(buf, "!ERROR:"+err.Error())
+		}
+		return appendString(buf, string(text))
+	case []byte:
+		return appendString(buf, string(x))
+	default:
+		return appendString(buf, fmt.Sprintf("%+v", x))
+	}
+}
+
+// consoleTimeFormat is RFC 3339 with milliseconds
+const consoleTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// timeFormat is the layout of time values
+func (c *ConsoleHandler) timeFormat() string {
+	if c.opts.TimeFormat == "" || c.opts.TimeFormat == "-" {
+		return consoleTimeFormat
+	}
+	return c.opts.TimeFormat
+}
+
+// levelName returns the name of the level, like INFO or DEBUG+2
+func (c *ConsoleHandler) levelName(level slog.Level) string {
+	if name, ok := c.opts.LevelNames[level]; ok {
+		return name
+	}
+	if name, ok := defaultLevelNames[level]; ok {
+		return name
+	}
+	return level.String()
+}
+
+// appendString appends s, quoted if it's empty or has spaces, quotes, '=' or non-printable characters
+func appendString(buf []byte, s string) []byte {
+	if needsQuoting(s) {
+		return strconv.AppendQuote(buf, s)
+	}
+	return append(buf, s...)
+}
+
+func needsQuoting(s string) bool {
+	if s == "" {
+		return true
+	}
+	for _, r := range s {
+		if r == ' ' || r == '=' || r == '"' || !unicode.IsPrint(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// groupPrefix joins the group names into a key prefix, like "a.b."
+func groupPrefix(groups []string) string {
+	if len(groups) == 0 {
+		return ""
+	}
+	return strings.Join(groups, ".") + "."
+}
+
 // WithAttrs returns a new ConsoleHandler with the given attributes added.
+// The attributes are formatted once, in the groups active now.
 func (c *ConsoleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
 	if len(attrs) == 0 {
 		return c
 	}
 
 	newHandler := c.clone()
-	newHandler.attrs = append(sliceClone(c.attrs), attrs...)
+	prefix := groupPrefix(c.groups)
+	var errs *[]prettyError
+	if c.opts.PrettyErrors {
+		errs = &newHandler.preformatErr
+	}
+	for _, attr := range attrs {
+		newHandler.preformat = c.appendAttr(newHandler.preformat, errs, c.groups, prefix, attr)
+	}
 	return newHandler
 }
 
@@ -141,35 +361,49 @@ func (c *ConsoleHandler) WithGroup(name string) slog.Handler {
 var _ slog.Handler = &ConsoleHandler{}
 
 // NewConsoleHandler creates a new ConsoleHandler that writes to w.
+// Colors are written if w is a terminal, see ConsoleHandlerOptions.Color.
 func NewConsoleHandler(w io.Writer, opts *slog.HandlerOptions) *ConsoleHandler {
 	if opts == nil {
 		opts = &slog.HandlerOptions{}
 	}
+	return NewConsoleHandlerWithOptions(w, &ConsoleHandlerOptions{HandlerOptions: *opts})
+}
 
-	return &ConsoleHandler{
-		w:        w,
-		opts:     *opts,
-		mu:       &sync.Mutex{},
-		colorize: true,
-		levelColors: map[slog.Level]string{
-			slog.LevelDebug: colorGray,
-			slog.LevelInfo:  colorGreen,
-			slog.LevelWarn:  colorYellow,
-			slog.LevelError: colorRed,
-		},
+// NewConsoleHandlerWithOptions creates a new ConsoleHandler that writes to w, with colors and layout options.
+func NewConsoleHandlerWithOptions(w io.Writer, opts *ConsoleHandlerOptions) *ConsoleHandler {
+	if opts == nil {
+		opts = &ConsoleHandlerOptions{}
+	}
+	c := &ConsoleHandler{
+		w:           w,
+		opts:        *opts,
+		mu:          &sync.Mutex{},
+		colorize:    useColor(opts.Color, w),
+		levelColors: make(map[slog.Level]string, len(defaultLevelColors)+len(opts.LevelColors)),
+	}
+	for level, color := range defaultLevelColors {
+		c.levelColors[level] = color
+	}
+	for level, color := range opts.LevelColors {
+		c.levelColors[level] = color
+	}
+	if c.opts.KeyColor == "" {
+		c.opts.KeyColor = colorCyan
 	}
+	return c
 }
 
 // clone creates a copy of the handler for use by WithAttrs and WithGroup.
 func (c *ConsoleHandler) clone() *ConsoleHandler {
 	return &ConsoleHandler{
-		w:           c.w,
-		opts:        c.opts,
-		mu:          c.mu, // mutex is shared among all clones
-		attrs:       sliceClone(c.attrs),
-		groups:      sliceClone(c.groups),
-		colorize:    c.colorize,
-		levelColors: c.levelColors,
+		w:            c.w,
+		opts:         c.opts,
+		mu:           c.mu, // mutex is shared among all clones
+		preformat:    sliceClone(c.preformat),
+		preformatErr: sliceClone(c.preformatErr),
+		groups:       sliceClone(c.groups),
+		colorize:     c.colorize,
+		levelColors:  c.levelColors,
 	}
 }
 
@@ -183,6 +417,8 @@ func (c *ConsoleHandler) getLevelColor(level slog.Level) string {
 	switch {
 	case level < slog.LevelInfo:
 		return colorGray
+	case level >= LevelFatal:
+		return colorPurple
 	case level < slog.LevelWarn:
 		return colorGreen
 	case level < slog.LevelError:
@@ -3,9 +3,13 @@ package errlog
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
+	"strconv"
 	"strings"
 	"testing"
+	"testing/slogtest"
 	"time"
 )
 
@@ -177,3 +181,240 @@ func TestConsoleHandlerRecord(t *testing.T) {
 		t.Error("key=value not found in output")
 	}
 }
+
+func TestConsoleHandlerSlogtest(t *testing.T) {
+	var buf bytes.Buffer
+	newHandler := func(t *testing.T) slog.Handler {
+		buf.Reset()
+		handler := NewConsoleHandler(&buf, nil)
+		handler.colorize = false
+		return handler
+	}
+	result := func(t *testing.T) map[string]any {
+		m, err := parseConsoleLine(buf.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	slogtest.Run(t, newHandler, result)
+}
+
+// parseConsoleLine parses a line of a ConsoleHandler without colors into
+// the map slogtest expects. Dotted keys become nested maps.
+func parseConsoleLine(line string) (map[string]any, error) {
+	line = strings.TrimSuffix(line, "\n")
+	m := make(map[string]any)
+	var msg []string
+	for i := 0; line != ""; i++ {
+		var token string
+		if strings.HasPrefix(line, `"`) {
+			quoted, err := strconv.QuotedPrefix(line)
+			if err != nil {
+				return nil, err
+			}
+			token = quoted
+		} else if key, rest, ok := strings.Cut(line, "="); ok && !strings.Contains(key, " ") {
+			// key=value, with a possibly quoted value
+			value := rest
+			if strings.HasPrefix(rest, `"`) {
+				quoted, err := strconv.QuotedPrefix(rest)
+				if err != nil {
+					return nil, err
+				}
+				value = quoted
+			} else if end := strings.IndexByte(rest, ' '); end >= 0 {
+				value = rest[:end]
+			}
+			token = key + "=" + value
+		} else if end := strings.IndexByte(line, ' '); end >= 0 {
+			token = line[:end]
+		} else {
+			token = line
+		}
+		line = strings.TrimPrefix(line[len(token):], " ")
+
+		if key, value, ok := strings.Cut(token, "="); ok && !strings.HasPrefix(token, `"`) {
+			if unquoted, err := strconv.Unquote(value); err == nil {
+				value = unquoted
+			}
+			setDotted(m, key, value)
+			continue
+		}
+		if _, ok := m[slog.TimeKey]; !ok && i == 0 {
+			if ts, err := time.Parse(consoleTimeFormat, token); err == nil {
+				m[slog.TimeKey] = ts
+				continue
+			}
+		}
+		if _, ok := m[slog.LevelKey]; !ok {
+			var level slog.Level
+			if err := level.UnmarshalText([]byte(token)); err != nil {
+				return nil, fmt.Errorf("level expected: %q", token)
+			}
+			m[slog.LevelKey] = level
+			continue
+		}
+		msg = append(msg, token)
+	}
+	m[slog.MessageKey] = strings.Join(msg, " ")
+	return m, nil
+}
+
+func setDotted(m map[string]any, key string, value any) {
+	parts := strings.Split(key, ".")
+	for _, group := range parts[:len(parts)-1] {
+		sub, ok := m[group].(map[string]any)
+		if !ok {
+			sub = make(map[string]any)
+			m[group] = sub
+		}
+		m = sub
+	}
+	m[parts[len(parts)-1]] = value
+}
+
+type consoleTestValuer struct{ name string }
+
+func (v consoleTestValuer) LogValue() slog.Value {
+	return slog.GroupValue(slog.String("name", v.name), slog.Int("len", len(v.name)))
+}
+
+func TestConsoleHandlerValues(t *testing.T) {
+	var buf bytes.Buffer
+	handler := NewConsoleHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			switch {
+			case a.Key == slog.TimeKey && len(groups) == 0:
+				return slog.Attr{}
+			case a.Key == "password":
+				return slog.String(a.Key, "***")
+			case a.Key == "len" && strings.Join(groups, ".") == "req.user":
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+	handler.colorize = false
+	logger := slog.New(handler).With("app", "demo").WithGroup("req").With("method", "GET")
+
+	logger.Info("user logged in",
+		"path", "/login page",
+		"user", consoleTestValuer{"alice"},
+		"password", "secret",
+		slog.Group("", slog.Int("status", 200)),
+		slog.Group("empty"),
+		"err", errors.New(`bad "input"`),
+		"took", 1500*time.Millisecond,
+	)
+
+	want := `INFO user logged in app=demo req.method=GET req.path="/login page" req.user.name=alice req.password=*** req.status=200 req.err="bad \"input\"" req.took=1.5s` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestConsoleHandlerColorMode(t *testing.T) {
+	testCases := []struct {
+		name       string
+		mode       ColorMode
+		noColor    string
+		forceColor string
+		want       bool
+	}{
+		{"auto buffer", ColorAuto, "", "", false},
+		{"auto FORCE_COLOR", ColorAuto, "", "1", true},
+		{"auto FORCE_COLOR=0", ColorAuto, "", "0", false},
+		{"auto NO_COLOR", ColorAuto, "1", "", false},
+		{"always", ColorAlways, "1", "", true},
+		{"never", ColorNever, "", "1", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("NO_COLOR", tc.noColor)
+			t.Setenv("FORCE_COLOR", tc.forceColor)
+			var buf bytes.Buffer
+			logger := slog.New(NewConsoleHandlerWithOptions(&buf, &ConsoleHandlerOptions{Color: tc.mode, TimeFormat: "-"}))
+			logger.Info("hello", "k", "v")
+			if got := strings.Contains(buf.String(), "\033["); got != tc.want {
+				t.Errorf("colors: got %v, want %v in %q", got, tc.want, buf.String())
+			}
+		})
+	}
+}
+
+func TestConsoleHandlerColors(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewConsoleHandlerWithOptions(&buf, &ConsoleHandlerOptions{
+		HandlerOptions: slog.HandlerOptions{Level: LevelTrace},
+		Color:          ColorAlways,
+		TimeFormat:     "-",
+		LevelColors:    map[slog.Level]string{slog.LevelInfo: colorBlue},
+		KeyColor:       colorWhite,
+	}))
+	logger.Info("hello", "k", "v")
+	logger.Log(context.Background(), LevelTrace, "trace")
+	logger.Log(context.Background(), LevelFatal, "fatal")
+
+	want := colorBlue + "INFO" + colorReset + " hello " + colorWhite + "k" + colorReset + "=v\n" +
+		colorGray + "TRACE" + colorReset + " trace\n" +
+		colorPurple + "FATAL" + colorReset + " fatal\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
+
+func TestConsoleHandlerLayout(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewConsoleHandlerWithOptions(&buf, &ConsoleHandlerOptions{
+		HandlerOptions: slog.HandlerOptions{Level: LevelTrace},
+		TimeFormat:     time.TimeOnly,
+		LevelNames:     map[slog.Level]string{slog.LevelWarn: "WRN"},
+		MessageWidth:   10,
+	}))
+	at := time.Date(2025, 1, 2, 15, 4, 5, 0, time.UTC)
+	for _, r := range []slog.Record{
+		slog.NewRecord(at, slog.LevelWarn, "short", 0),
+		slog.NewRecord(at, LevelTrace, "a longer message", 0),
+	} {
+		r.AddAttrs(slog.Time("at", at))
+		if err := logger.Handler().Handle(context.Background(), r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := "15:04:05 WRN   short      at=15:04:05\n" +
+		"15:04:05 TRACE a longer message at=15:04:05\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%swant\n%s", got, want)
+	}
+}
+
+func TestConsoleHandlerPrettyErrors(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewConsoleHandlerWithOptions(&buf, &ConsoleHandlerOptions{
+		TimeFormat:   "-",
+		PrettyErrors: true,
+		StackTrace:   StackTraceOptions{MaxDepth: 1},
+	}))
+	cause := WithStack(errors.New("disk full"))
+	logger.With("err", errors.New("first")).Error("save failed", "file", "a.txt", "cause", fmt.Errorf("save: %w", cause))
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("got %d lines:\n%s", len(lines), buf.String())
+	}
+	if want := "ERROR save failed file=a.txt"; lines[0] != want {
+		t.Errorf("got  %s\nwant %s", lines[0], want)
+	}
+	if want := "    err: first"; lines[1] != want {
+		t.Errorf("got  %s\nwant %s", lines[1], want)
+	}
+	if want := "    cause: save: disk full"; lines[2] != want {
+		t.Errorf("got  %s\nwant %s", lines[2], want)
+	}
+	if !strings.HasPrefix(lines[3], "        at github.com/bukodi/playground/errlog.TestConsoleHandlerPrettyErrors (") ||
+		!strings.Contains(lines[3], "console_handler_test.go:") {
+		t.Errorf("first frame: %s", lines[3])
+	}
+}
@@ -0,0 +1,101 @@
+package errlog
+
+import (
+	"io"
+	"log/slog"
+	"os"
+)
+
+// Levels beyond the slog levels, named by ConsoleHandler
+const (
+	LevelTrace = slog.Level(-8)
+	LevelFatal = slog.Level(12)
+)
+
+// ColorMode selects when ConsoleHandler writes ANSI colors
+type ColorMode int
+
+const (
+	ColorAuto   ColorMode = iota // Colors on terminals, see ConsoleHandlerOptions.Color
+	ColorAlways                  // Colors even in files and pipes
+	ColorNever                   // No colors
+)
+
+// ConsoleHandlerOptions are the options of NewConsoleHandlerWithOptions
+type ConsoleHandlerOptions struct {
+	slog.HandlerOptions
+
+	// Color is ColorAuto by default: colors are written if the writer is a terminal.
+	// The NO_COLOR environment variable turns them off, FORCE_COLOR turns them on.
+	Color ColorMode
+
+	// LevelColors and LevelNames override the ANSI color and the name of a level.
+	// TRACE (LevelTrace) and FATAL (LevelFatal) are named by default.
+	LevelColors map[slog.Level]string
+	LevelNames  map[slog.Level]string
+
+	// TimeFormat is the layout of the record time and time values.
+	// Defaults to RFC 3339 with milliseconds. "-" omits the record time.
+	TimeFormat string
+
+	// KeyColor is the ANSI color of the attribute keys. Defaults to cyan.
+	KeyColor string
+
+	// MessageWidth pads the messages, so the attributes start in the same column.
+	// Longer messages aren't cut.
+	MessageWidth int
+
+	// PrettyErrors writes the error attributes on their own lines after the record,
+	// with the stack frames of a StackTracer in the chain.
+	PrettyErrors bool
+
+	// StackTrace controls the frames written with PrettyErrors
+	StackTrace StackTraceOptions
+}
+
+// defaultLevelColors are the colors of the levels without LevelColors
+var defaultLevelColors = map[slog.Level]string{
+	LevelTrace:      colorGray,
+	slog.LevelDebug: colorGray,
+	slog.LevelInfo:  colorGreen,
+	slog.LevelWarn:  colorYellow,
+	slog.LevelError: colorRed,
+	LevelFatal:      colorPurple,
+}
+
+// defaultLevelNames are the levels not named by slog.Level.String
+var defaultLevelNames = map[slog.Level]string{
+	LevelTrace: "TRACE",
+	LevelFatal: "FATAL",
+}
+
+// useColor decides on colors for ColorAuto
+func useColor(mode ColorMode, w io.Writer) bool {
+	switch mode {
+	case ColorAlways:
+		return true
+	case ColorNever:
+		return false
+	}
+	if v := os.Getenv("FORCE_COLOR"); v != "" && v != "0" && v != "false" {
+		return true
+	}
+	// https://no-color.org: any non-empty value
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	return isTerminal(w)
+}
+
+// isTerminal reports whether w is a character device, like a terminal
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
@@ -6,15 +6,61 @@ import (
 	"sync"
 )
 
+// InMemoryHandlerOptions are the options of NewInMemoryHandlerWithOptions
+type InMemoryHandlerOptions struct {
+	slog.HandlerOptions
+
+	// StackTrace controls the frames stored with the errors with a StackTracer in their chain
+	StackTrace StackTraceOptions
+}
+
 // InMemoryHandler is a slog.Handler that stores log records in memory.
+// The last maxSize records are kept in a ring buffer, shared by the handlers of WithAttrs and WithGroup.
+// The keys of grouped attributes are dotted paths, like req.method.
+// Errors with a StackTracer in their chain are stored with their frames, see ErrorStackFrames.
 type InMemoryHandler struct {
-	opts        slog.HandlerOptions
-	mu          *sync.Mutex
-	attrs       []slog.Attr
-	groups      []string
-	records     []slog.Record
-	maxSize     int
-	currentSize int
+	opts   InMemoryHandlerOptions
+	attrs  []slog.Attr
+	groups []string
+	store  *recordStore
+}
+
+// recordStore is the ring buffer and the subscriptions of an InMemoryHandler and its clones
+type recordStore struct {
+	mu      sync.Mutex
+	records []slog.Record // Ring buffer, len is the maximum size
+	next    int           // Index of the next record
+	size    int
+	subs    map[*subscription]struct{}
+}
+
+// add stores the record, overwriting the oldest one if the buffer is full
+func (s *recordStore) add(record slog.Record) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records[s.next] = record
+	s.next = (s.next + 1) % len(s.records)
+	if s.size < len(s.records) {
+		s.size++
+	}
+	for sub := range s.subs {
+		sub.send(record)
+	}
+}
+
+// all calls fn with the stored records, from the oldest. It stops if fn returns false.
+// The store is locked while the records are visited.
+func (s *recordStore) all(fn func(slog.Record) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	first := s.next - s.size + len(s.records)
+	for j := range s.size {
+		if !fn(s.records[(first+j)%len(s.records)]) {
+			return
+		}
+	}
 }
 
 // Enabled reports whether the handler handles records at the given level.
@@ -28,52 +74,59 @@ func (i *InMemoryHandler) Enabled(ctx context.Context, level slog.Level) bool {
 
 // Handle stores a log record in memory.
 func (i *InMemoryHandler) Handle(ctx context.Context, record slog.Record) error {
-	i.mu.Lock()
-	defer i.mu.Unlock()
+	// Add the record to the buffer
+	i.store.add(flattenRecord(record, i.attrs, i.groups, i.addStackFrames))
+	return nil
+}
 
-	// If buffer is full, remove the oldest record
-	if i.currentSize >= i.maxSize {
-		i.records = i.records[1:]
-		i.currentSize--
+// flattenRecord returns a new record with the handler attributes, then the record attributes
+// with the group prefix added to their keys. The handler attributes are already prefixed.
+// value converts the attribute values, if not nil.
+func flattenRecord(record slog.Record, attrs []slog.Attr, groups []string, value func(slog.Value) slog.Value) slog.Record {
+	newRecord := slog.NewRecord(record.Time, record.Level, record.Message, record.PC)
+	newAttrs := make([]slog.Attr, 0, len(attrs)+record.NumAttrs())
+	newAttrs = append(newAttrs, attrs...)
+	prefix := groupPrefix(groups)
+	record.Attrs(func(attr slog.Attr) bool {
+		newAttrs = append(newAttrs, slog.Attr{Key: prefix + attr.Key, Value: attr.Value})
+		return true
+	})
+	if value != nil {
+		for j, attr := range newAttrs {
+			newAttrs[j].Value = value(attr.Value)
+		}
 	}
+	newRecord.AddAttrs(newAttrs...)
+	return newRecord
+}
 
-	// Clone the record to avoid shared state
-	newRecord := record.Clone()
-
-	// Add handler attributes to the record
-	for _, attr := range i.attrs {
-		newRecord.AddAttrs(attr)
+// prefixAttrs returns the attributes with the group prefix added to their keys
+func prefixAttrs(attrs []slog.Attr, groups []string) []slog.Attr {
+	prefix := groupPrefix(groups)
+	prefixed := make([]slog.Attr, len(attrs))
+	for j, attr := range attrs {
+		prefixed[j] = slog.Attr{Key: prefix + attr.Key, Value: attr.Value}
 	}
+	return prefixed
+}
 
-	// If there are groups, we need to create a new record with the group prefixes added to the attributes
-	if len(i.groups) > 0 {
-		// Create a new record with the same time, level, and message
-		groupedRecord := slog.NewRecord(newRecord.Time, newRecord.Level, newRecord.Message, newRecord.PC)
-
-		// Extract all attributes and add them with group prefixes
-		var groupedAttrs []slog.Attr
-		newRecord.Attrs(func(attr slog.Attr) bool {
-			// Create a new key with the group prefix
-			key := attr.Key
-			for _, group := range i.groups {
-				key = group + "." + key
-			}
-			groupedAttrs = append(groupedAttrs, slog.Attr{Key: key, Value: attr.Value})
-			return true
-		})
-
-		// Add the grouped attributes to the new record
-		groupedRecord.AddAttrs(groupedAttrs...)
-
-		// Use the grouped record instead
-		newRecord = groupedRecord
+// addStackFrames replaces the errors with a StackTracer in their chain, also in groups
+func (i *InMemoryHandler) addStackFrames(v slog.Value) slog.Value {
+	v = v.Resolve()
+	switch v.Kind() {
+	case slog.KindAny:
+		if err, ok := v.Any().(error); ok {
+			return slog.AnyValue(withStackFrames(err, i.opts.StackTrace))
+		}
+	case slog.KindGroup:
+		attrs := v.Group()
+		newAttrs := make([]slog.Attr, len(attrs))
+		for j, attr := range attrs {
+			newAttrs[j] = slog.Attr{Key: attr.Key, Value: i.addStackFrames(attr.Value)}
+		}
+		return slog.GroupValue(newAttrs...)
 	}
-
-	// Add the record to the buffer
-	i.records = append(i.records, newRecord)
-	i.currentSize++
-
-	return nil
+	return v
 }
 
 // WithAttrs returns a new InMemoryHandler with the given attributes added.
@@ -83,7 +136,7 @@ func (i *InMemoryHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
 	}
 
 	newHandler := i.clone()
-	newHandler.attrs = append(sliceClone(i.attrs), attrs...)
+	newHandler.attrs = append(sliceClone(i.attrs), prefixAttrs(attrs, i.groups)...)
 	return newHandler
 }
 
@@ -98,30 +151,18 @@ func (i *InMemoryHandler) WithGroup(name string) slog.Handler {
 	return newHandler
 }
 
-// GetRecords returns the stored log records.
+// GetRecords returns the stored log records, from the oldest.
 func (i *InMemoryHandler) GetRecords() []slog.Record {
-	i.mu.Lock()
-	defer i.mu.Unlock()
-
-	// Return a copy of the records to avoid race conditions
-	records := make([]slog.Record, len(i.records))
-	for j, record := range i.records {
-		records[j] = record.Clone()
-	}
-
-	return records
+	return i.Query(Query{})
 }
 
 // clone creates a copy of the handler for use by WithAttrs and WithGroup.
 func (i *InMemoryHandler) clone() *InMemoryHandler {
 	return &InMemoryHandler{
-		opts:        i.opts,
-		mu:          i.mu, // mutex is shared among all clones
-		attrs:       sliceClone(i.attrs),
-		groups:      sliceClone(i.groups),
-		records:     i.records, // records are shared among all clones
-		maxSize:     i.maxSize,
-		currentSize: i.currentSize,
+		opts:   i.opts,
+		attrs:  sliceClone(i.attrs),
+		groups: sliceClone(i.groups),
+		store:  i.store, // records are shared among all clones
 	}
 }
 
@@ -130,17 +171,25 @@ func NewInMemoryHandler(maxSize int, opts *slog.HandlerOptions) *InMemoryHandler
 	if opts == nil {
 		opts = &slog.HandlerOptions{}
 	}
+	return NewInMemoryHandlerWithOptions(maxSize, &InMemoryHandlerOptions{HandlerOptions: *opts})
+}
+
+// NewInMemoryHandlerWithOptions creates a new InMemoryHandler with the given maximum size and stack trace options.
+func NewInMemoryHandlerWithOptions(maxSize int, opts *InMemoryHandlerOptions) *InMemoryHandler {
+	if opts == nil {
+		opts = &InMemoryHandlerOptions{}
+	}
 
 	if maxSize <= 0 {
 		maxSize = 100 // Default size
 	}
 
 	return &InMemoryHandler{
-		opts:        *opts,
-		mu:          &sync.Mutex{},
-		records:     make([]slog.Record, 0, maxSize),
-		maxSize:     maxSize,
-		currentSize: 0,
+		opts: *opts,
+		store: &recordStore{
+			records: make([]slog.Record, maxSize),
+			subs:    make(map[*subscription]struct{}),
+		},
 	}
 }
 
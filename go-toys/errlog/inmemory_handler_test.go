@@ -2,7 +2,15 @@ package errlog
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -266,3 +274,150 @@ func TestInMemoryHandlerMaxSize(t *testing.T) {
 		}
 	}
 }
+
+func TestInMemoryHandlerSharedRing(t *testing.T) {
+	handler := NewInMemoryHandler(4, nil)
+	parent := slog.New(handler)
+	child := parent.With("child", true).WithGroup("g")
+
+	for n := range 10 {
+		if n%2 == 0 {
+			parent.Info("parent", "n", n)
+		} else {
+			child.Info("child", "n", n)
+		}
+	}
+
+	// The parent and the child see the same records
+	for _, h := range []slog.Handler{handler, child.Handler()} {
+		records := h.(*InMemoryHandler).GetRecords()
+		if len(records) != 4 {
+			t.Fatalf("Expected 4 records, got %d", len(records))
+		}
+		for j, record := range records {
+			key := "n"
+			if record.Message == "child" {
+				key = "g.n"
+			}
+			if value, ok := findAttr(record, key); !ok || value != strconv.Itoa(6+j) {
+				t.Errorf("Expected %s=%d in record %d, got %s", key, 6+j, j, value)
+			}
+		}
+	}
+}
+
+func TestInMemoryHandlerQuery(t *testing.T) {
+	handler := NewInMemoryHandler(10, &slog.HandlerOptions{Level: slog.LevelDebug})
+	base := time.Date(2025, 1, 2, 15, 0, 0, 0, time.UTC)
+	for j, r := range []struct {
+		level slog.Level
+		msg   string
+		attrs []any
+	}{
+		{slog.LevelDebug, "cache miss", []any{PackageKey, "cache", "key", "a"}},
+		{slog.LevelInfo, "request served", []any{PackageKey, "http", slog.Group("req", "method", "GET", "status", 200)}},
+		{slog.LevelWarn, "slow request", []any{PackageKey, "http", slog.Group("req", "method", "POST", "status", 200)}},
+		{slog.LevelError, "request failed", []any{PackageKey, "http", slog.Group("req", "method", "POST", "status", 500)}},
+	} {
+		record := slog.NewRecord(base.Add(time.Duration(j)*time.Minute), r.level, r.msg, 0)
+		record.Add(r.attrs...)
+		if err := handler.Handle(context.Background(), record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		name  string
+		query Query
+		want  []string
+	}{
+		{"all", Query{}, []string{"cache miss", "request served", "slow request", "request failed"}},
+		{"level", Query{MinLevel: slog.LevelWarn}, []string{"slow request", "request failed"}},
+		{"time range", Query{Since: base.Add(time.Minute), Until: base.Add(3 * time.Minute)}, []string{"request served", "slow request"}},
+		{"message", Query{Message: regexp.MustCompile(`^request`)}, []string{"request served", "request failed"}},
+		{"pkg", Query{Pkg: "cache"}, []string{"cache miss"}},
+		{"attrs", Query{Attrs: []slog.Attr{slog.String("req.method", "POST"), slog.Int("req.status", 200)}}, []string{"slow request"}},
+		{"limit", Query{Pkg: "http", Limit: 2}, []string{"slow request", "request failed"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []string
+			for _, record := range handler.Query(tc.query) {
+				got = append(got, record.Message)
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestInMemoryHandlerSubscribe(t *testing.T) {
+	handler := NewInMemoryHandler(10, nil)
+	logger := slog.New(handler)
+	logger.Info("before")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := handler.Subscribe(ctx)
+	logger.With("k", "v").Info("after")
+
+	select {
+	case record := <-ch:
+		if record.Message != "after" {
+			t.Errorf("Expected the record after Subscribe, got %q", record.Message)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("No record received")
+	}
+
+	cancel()
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Error("Expected closed channel")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Channel not closed")
+	}
+	logger.Info("after cancel")
+}
+
+func TestInMemoryHandlerServeHTTP(t *testing.T) {
+	handler := NewInMemoryHandler(10, nil)
+	logger := slog.New(handler)
+	logger.Info("started", "port", 8080)
+	logger.Warn("slow", slog.Group("req", "path", "/api", "took", 2*time.Second))
+	logger.Error("failed", ErrorAttr(WithStack(errors.New("boom"))))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/logs?level=WARN&attr.req.path=/api", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("Unexpected response %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var got []struct {
+		Level string         `json:"level"`
+		Msg   string         `json:"msg"`
+		Attrs map[string]any `json:"attrs"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Invalid JSON %s: %v", rec.Body.String(), err)
+	}
+	if len(got) != 1 || got[0].Msg != "slow" || got[0].Level != "WARN" {
+		t.Fatalf("Unexpected records: %s", rec.Body.String())
+	}
+	if want := map[string]any{"req": map[string]any{"path": "/api", "took": "2s"}}; !reflect.DeepEqual(got[0].Attrs, want) {
+		t.Errorf("Expected attrs %v, got %v", want, got[0].Attrs)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/logs?limit=1", nil))
+	if !strings.Contains(rec.Body.String(), `"err":{"msg":"boom","stack":[{"func":"github.com/bukodi/playground/errlog.TestInMemoryHandlerServeHTTP"`) {
+		t.Errorf("Expected error with stack, got %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/logs?msg=(", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid regexp, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,147 @@
+package errlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// jsonRecord is a record served by InMemoryHandler.ServeHTTP
+type jsonRecord struct {
+	Time   time.Time      `json:"time"`
+	Level  string         `json:"level"`
+	Msg    string         `json:"msg"`
+	Source *slog.Source   `json:"source,omitempty"`
+	Attrs  map[string]any `json:"attrs,omitempty"`
+}
+
+// ServeHTTP serves the stored records as a JSON array, from the oldest, for debug endpoints.
+// The query parameters select the records, see Query:
+//
+//	level=WARN  since=2025-01-02T15:04:05Z  until=...  msg=regexp  pkg=name  limit=50  attr.key=value
+func (i *InMemoryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	q, err := parseQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	records := i.Query(q)
+	out := make([]jsonRecord, len(records))
+	for j, record := range records {
+		out[j] = toJSONRecord(record)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// parseQuery reads a Query from the URL parameters of ServeHTTP
+func parseQuery(r *http.Request) (Query, error) {
+	var q Query
+	params := r.URL.Query()
+	if s := params.Get("level"); s != "" {
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(s)); err != nil {
+			return q, fmt.Errorf("invalid level: %q", s)
+		}
+		q.MinLevel = level
+	}
+	for _, p := range []struct {
+		name string
+		t    *time.Time
+	}{{"since", &q.Since}, {"until", &q.Until}} {
+		if s := params.Get(p.name); s != "" {
+			t, err := time.Parse(time.RFC3339Nano, s)
+			if err != nil {
+				return q, fmt.Errorf("invalid %s: %q", p.name, s)
+			}
+			*p.t = t
+		}
+	}
+	if s := params.Get("msg"); s != "" {
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return q, fmt.Errorf("invalid msg: %w", err)
+		}
+		q.Message = re
+	}
+	q.Pkg = params.Get("pkg")
+	if s := params.Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit < 0 {
+			return q, fmt.Errorf("invalid limit: %q", s)
+		}
+		q.Limit = limit
+	}
+	for name, values := range params {
+		if key, ok := strings.CutPrefix(name, "attr."); ok {
+			for _, value := range values {
+				q.Attrs = append(q.Attrs, slog.String(key, value))
+			}
+		}
+	}
+	return q, nil
+}
+
+func toJSONRecord(r slog.Record) jsonRecord {
+	jr := jsonRecord{Time: r.Time, Level: r.Level.String(), Msg: r.Message}
+	if r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		jr.Source = &slog.Source{Function: frame.Function, File: frame.File, Line: frame.Line}
+	}
+	if r.NumAttrs() > 0 {
+		jr.Attrs = make(map[string]any, r.NumAttrs())
+		r.Attrs(func(attr slog.Attr) bool {
+			addJSONAttr(jr.Attrs, attr)
+			return true
+		})
+	}
+	return jr
+}
+
+// addJSONAttr adds the attribute to m, groups as nested maps. Members of groups without a key are inlined.
+func addJSONAttr(m map[string]any, attr slog.Attr) {
+	v := attr.Value.Resolve()
+	if v.Kind() != slog.KindGroup {
+		if attr.Key != "" {
+			m[attr.Key] = jsonValue(v)
+		}
+		return
+	}
+	group := m
+	if attr.Key != "" {
+		group = make(map[string]any, len(v.Group()))
+		m[attr.Key] = group
+	}
+	for _, member := range v.Group() {
+		addJSONAttr(group, member)
+	}
+}
+
+// jsonValue converts the value like slog.JSONHandler: errors are strings, unless they marshal themselves
+func jsonValue(v slog.Value) any {
+	switch v.Kind() {
+	case slog.KindDuration:
+		return v.Duration().String()
+	case slog.KindAny:
+		switch x := v.Any().(type) {
+		case json.Marshaler:
+			return x
+		case error:
+			return x.Error()
+		}
+	}
+	return v.Any()
+}
@@ -0,0 +1,136 @@
+package errlog
+
+import (
+	"context"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Query selects records of an InMemoryHandler. The zero Query matches all records.
+type Query struct {
+	MinLevel slog.Leveler   // Records at this level or above
+	Since    time.Time      // Records at or after this time
+	Until    time.Time      // Records before this time
+	Message  *regexp.Regexp // Records with a matching message
+	Pkg      string         // Records of the package, see NewPkgLogger
+
+	// Attrs are the attributes of the matching records. Keys of grouped attributes are
+	// dotted paths, like req.method. Values are compared by their String form.
+	Attrs []slog.Attr
+
+	// Limit returns only the last Limit matching records
+	Limit int
+}
+
+// Match reports whether the record matches the query
+func (q Query) Match(r slog.Record) bool {
+	if q.MinLevel != nil && r.Level < q.MinLevel.Level() {
+		return false
+	}
+	if !q.Since.IsZero() && r.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !r.Time.Before(q.Until) {
+		return false
+	}
+	if q.Message != nil && !q.Message.MatchString(r.Message) {
+		return false
+	}
+	if q.Pkg != "" {
+		if v, ok := RecordAttr(r, PackageKey); !ok || v.String() != q.Pkg {
+			return false
+		}
+	}
+	for _, attr := range q.Attrs {
+		if v, ok := RecordAttr(r, attr.Key); !ok || v.String() != attr.Value.Resolve().String() {
+			return false
+		}
+	}
+	return true
+}
+
+// RecordAttr returns the value of the attribute of the record. The key of a grouped attribute is
+// its dotted path, like req.method, both for slog.Group attributes and for handler groups.
+func RecordAttr(r slog.Record, key string) (slog.Value, bool) {
+	var value slog.Value
+	var found bool
+	r.Attrs(func(attr slog.Attr) bool {
+		value, found = findAttrValue(attr, key)
+		return !found
+	})
+	return value, found
+}
+
+// findAttrValue looks up the dotted key in the attribute and in its group members
+func findAttrValue(attr slog.Attr, key string) (slog.Value, bool) {
+	v := attr.Value.Resolve()
+	if attr.Key == key {
+		return v, true
+	}
+	if v.Kind() != slog.KindGroup {
+		return slog.Value{}, false
+	}
+	if attr.Key != "" {
+		rest, ok := strings.CutPrefix(key, attr.Key+".")
+		if !ok {
+			return slog.Value{}, false
+		}
+		key = rest
+	}
+	for _, member := range v.Group() {
+		if v, ok := findAttrValue(member, key); ok {
+			return v, true
+		}
+	}
+	return slog.Value{}, false
+}
+
+// Query returns the stored records matching the query, from the oldest.
+func (i *InMemoryHandler) Query(q Query) []slog.Record {
+	var records []slog.Record
+	i.store.all(func(r slog.Record) bool {
+		if q.Match(r) {
+			records = append(records, r.Clone())
+		}
+		return true
+	})
+	if q.Limit > 0 && len(records) > q.Limit {
+		records = records[len(records)-q.Limit:]
+	}
+	return records
+}
+
+// subscriptionBuffer is the channel size of the subscriptions
+const subscriptionBuffer = 100
+
+// subscription is a channel receiving the new records
+type subscription struct {
+	ch chan slog.Record
+}
+
+// send doesn't block: a slow subscriber misses records instead of blocking the loggers
+func (sub *subscription) send(r slog.Record) {
+	select {
+	case sub.ch <- r.Clone():
+	default:
+	}
+}
+
+// Subscribe returns a channel of the records handled after the call, for live tailing.
+// The channel is closed when ctx is done. Records are dropped while the channel is full.
+func (i *InMemoryHandler) Subscribe(ctx context.Context) <-chan slog.Record {
+	sub := &subscription{ch: make(chan slog.Record, subscriptionBuffer)}
+	i.store.mu.Lock()
+	i.store.subs[sub] = struct{}{}
+	i.store.mu.Unlock()
+
+	context.AfterFunc(ctx, func() {
+		i.store.mu.Lock()
+		defer i.store.mu.Unlock()
+		delete(i.store.subs, sub)
+		close(sub.ch)
+	})
+	return sub.ch
+}
@@ -0,0 +1,44 @@
+package errlog
+
+import (
+	"io"
+	"log/slog"
+)
+
+// JSONHandlerOptions are the options of NewJSONHandler
+type JSONHandlerOptions struct {
+	slog.HandlerOptions
+
+	// StackTrace controls the frames of the errors with a StackTracer in their chain
+	StackTrace StackTraceOptions
+}
+
+// NewJSONHandler creates a slog.JSONHandler that writes the errors with a StackTracer in
+// their chain as {"msg":"...","stack":[{"func":"...","file":"...","line":42}]}.
+// Other errors are written as strings, like slog.JSONHandler does.
+func NewJSONHandler(w io.Writer, opts *JSONHandlerOptions) *slog.JSONHandler {
+	if opts == nil {
+		opts = &JSONHandlerOptions{}
+	}
+	handlerOpts := opts.HandlerOptions
+	handlerOpts.ReplaceAttr = StackTraceReplaceAttr(opts.StackTrace, opts.ReplaceAttr)
+	return slog.NewJSONHandler(w, &handlerOpts)
+}
+
+// StackTraceReplaceAttr returns a slog.HandlerOptions.ReplaceAttr function that adds the stack
+// frames to the error values, for slog handlers marshaling values to JSON.
+// next is called before, if not nil.
+func StackTraceReplaceAttr(opts StackTraceOptions, next func(groups []string, a slog.Attr) slog.Attr) func(groups []string, a slog.Attr) slog.Attr {
+	return func(groups []string, a slog.Attr) slog.Attr {
+		if next != nil {
+			a = next(groups, a)
+		}
+		if a.Value.Kind() != slog.KindAny {
+			return a
+		}
+		if err, ok := a.Value.Any().(error); ok {
+			a.Value = slog.AnyValue(withStackFrames(err, opts))
+		}
+		return a
+	}
+}
@@ -3,19 +3,34 @@ package errlog
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
 	"sync"
 	"testing"
+	"time"
 )
 
+// TestSLogHandler writes the log records to the test log, and keeps them for the assertions.
+// The keys of grouped attributes are dotted paths in the kept records, like InMemoryHandler's.
 type TestSLogHandler struct {
-	t                *testing.T
-	buffer           *bytes.Buffer
+	t                testing.TB
+	opts             slog.HandlerOptions
 	infoTextHandler  slog.Handler
 	errorTextHandler slog.Handler
-	originalHandler  slog.Handler
-	mu               sync.Mutex
-	logRecords       []slog.Record
+	failOnError      bool // Error records fail the test, see NewHandler
+	attrs            []slog.Attr
+	groups           []string
+	state            *testLogState
+}
+
+// testLogState is shared by a TestSLogHandler and its clones
+type testLogState struct {
+	mu              sync.Mutex
+	logRecords      []slog.Record
+	originalHandler slog.Handler // slog.Default handler replaced by NewHandler
 }
 
 type writerFunc struct {
@@ -26,38 +41,63 @@ func (wf writerFunc) Write(p []byte) (n int, err error) {
 	return wf.fn(p)
 }
 
+// NewHandler redirects slog.Default to the test log until Close, or the end of the test.
+// Error records fail the test. Tests using it can't run in parallel, see NewTestHandler.
 func NewHandler(t *testing.T) *TestSLogHandler {
-	tlh := &TestSLogHandler{t: t}
+	tlh := NewTestHandler(t, nil)
+	tlh.failOnError = true
+	tlh.state.originalHandler = slog.Default().Handler()
+	slog.SetDefault(slog.New(tlh))
+	t.Cleanup(func() { tlh.Close() })
+	return tlh
+}
+
+// NewTestHandler creates a handler writing to the test log, without changing slog.Default.
+// All levels are handled by default. Use it with Logger in parallel tests.
+func NewTestHandler(t testing.TB, opts *slog.HandlerOptions) *TestSLogHandler {
+	if opts == nil {
+		opts = &slog.HandlerOptions{}
+	}
+	tlh := &TestSLogHandler{t: t, opts: *opts, state: &testLogState{}}
 
-	tlh.buffer = &bytes.Buffer{}
+	textOpts := &slog.HandlerOptions{
+		AddSource:   true,
+		ReplaceAttr: opts.ReplaceAttr,
+	}
 	tlh.infoTextHandler = slog.NewTextHandler(writerFunc{
 		fn: func(p []byte) (n int, err error) {
 			t.Logf("out: %s", p)
 			return len(p), nil
 		},
-	}, &slog.HandlerOptions{
-		AddSource: true,
-	})
+	}, textOpts)
 	tlh.errorTextHandler = slog.NewTextHandler(writerFunc{
 		fn: func(p []byte) (n int, err error) {
-			t.Errorf("err: %s", p)
+			if tlh.failOnError {
+				t.Errorf("err: %s", p)
+			} else {
+				t.Logf("err: %s", p)
+			}
 			return len(p), nil
 		},
-	}, &slog.HandlerOptions{
-		AddSource: true,
-	})
-	tlh.originalHandler = slog.Default().Handler()
-	slog.SetDefault(slog.New(tlh))
+	}, textOpts)
 	return tlh
 }
 
+// Logger returns a logger writing to this handler
+func (tlh *TestSLogHandler) Logger() *slog.Logger {
+	return slog.New(tlh)
+}
+
+// Close restores slog.Default replaced by NewHandler, and returns the records.
 func (tlh *TestSLogHandler) Close() []slog.Record {
-	tlh.mu.Lock()
-	defer tlh.mu.Unlock()
+	tlh.state.mu.Lock()
+	defer tlh.state.mu.Unlock()
 
-	slog.SetDefault(slog.New(tlh.originalHandler))
-	tlh.originalHandler = nil
-	return tlh.logRecords
+	if tlh.state.originalHandler != nil {
+		slog.SetDefault(slog.New(tlh.state.originalHandler))
+		tlh.state.originalHandler = nil
+	}
+	return sliceClone(tlh.state.logRecords)
 }
 
 func CaptureSLog(t *testing.T, fn func()) []slog.Record {
@@ -67,13 +107,16 @@ func CaptureSLog(t *testing.T, fn func()) []slog.Record {
 }
 
 func (tlh *TestSLogHandler) Enabled(ctx context.Context, level slog.Level) bool {
-	return true
+	if tlh.opts.Level == nil {
+		return true
+	}
+	return level >= tlh.opts.Level.Level()
 }
 
 func (tlh *TestSLogHandler) Handle(ctx context.Context, record slog.Record) error {
-	tlh.mu.Lock()
-	defer tlh.mu.Unlock()
-	tlh.logRecords = append(tlh.logRecords, record)
+	tlh.state.mu.Lock()
+	tlh.state.logRecords = append(tlh.state.logRecords, flattenRecord(record, tlh.attrs, tlh.groups, nil))
+	tlh.state.mu.Unlock()
 
 	if record.Level >= slog.LevelError {
 		return tlh.errorTextHandler.Handle(ctx, record)
@@ -83,11 +126,149 @@ func (tlh *TestSLogHandler) Handle(ctx context.Context, record slog.Record) erro
 }
 
 func (tlh *TestSLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
-	panic("implement me")
+	if len(attrs) == 0 {
+		return tlh
+	}
+	newHandler := tlh.clone()
+	newHandler.attrs = append(sliceClone(tlh.attrs), prefixAttrs(attrs, tlh.groups)...)
+	newHandler.infoTextHandler = tlh.infoTextHandler.WithAttrs(attrs)
+	newHandler.errorTextHandler = tlh.errorTextHandler.WithAttrs(attrs)
+	return newHandler
 }
 
 func (tlh *TestSLogHandler) WithGroup(name string) slog.Handler {
-	panic("implement me")
+	if name == "" {
+		return tlh
+	}
+	newHandler := tlh.clone()
+	newHandler.groups = append(sliceClone(tlh.groups), name)
+	newHandler.infoTextHandler = tlh.infoTextHandler.WithGroup(name)
+	newHandler.errorTextHandler = tlh.errorTextHandler.WithGroup(name)
+	return newHandler
+}
+
+// clone creates a copy of the handler for use by WithAttrs and WithGroup.
+func (tlh *TestSLogHandler) clone() *TestSLogHandler {
+	c := *tlh
+	return &c
+}
+
+// Records returns the records handled so far, by this handler and its clones
+func (tlh *TestSLogHandler) Records() []slog.Record {
+	tlh.state.mu.Lock()
+	defer tlh.state.mu.Unlock()
+	return sliceClone(tlh.state.logRecords)
+}
+
+// find returns the records at the level, with a message matching msgPattern and the attributes.
+// attrs are key-value pairs or slog.Attr values, like the arguments of slog.Logger.Info.
+func (tlh *TestSLogHandler) find(level slog.Level, msgPattern string, attrs []any) []slog.Record {
+	tlh.t.Helper()
+	re, err := regexp.Compile(msgPattern)
+	if err != nil {
+		tlh.t.Fatalf("invalid message pattern %q: %v", msgPattern, err)
+	}
+	// slog.Record converts the key-value pairs to attributes
+	q := Query{Message: re}
+	r := slog.NewRecord(time.Time{}, level, "", 0)
+	r.Add(attrs...)
+	r.Attrs(func(attr slog.Attr) bool {
+		q.Attrs = append(q.Attrs, attr)
+		return true
+	})
+
+	var found []slog.Record
+	for _, record := range tlh.Records() {
+		if record.Level == level && q.Match(record) {
+			found = append(found, record)
+		}
+	}
+	return found
+}
+
+// AssertLogged fails the test if no record was logged at the level, with a message matching
+// msgPattern and the attributes. attrs are key-value pairs or slog.Attr values, like the
+// arguments of slog.Logger.Info. Keys of grouped attributes are dotted paths, like req.method.
+func (tlh *TestSLogHandler) AssertLogged(level slog.Level, msgPattern string, attrs ...any) bool {
+	tlh.t.Helper()
+	if len(tlh.find(level, msgPattern, attrs)) > 0 {
+		return true
+	}
+	tlh.t.Errorf("no %s record matching %q %v, logged:\n%s", level, msgPattern, attrs, tlh.format(tlh.Records()))
+	return false
+}
+
+// AssertNotLogged fails the test if a record was logged at the level, with a message matching
+// msgPattern and the attributes, see AssertLogged.
+func (tlh *TestSLogHandler) AssertNotLogged(level slog.Level, msgPattern string, attrs ...any) bool {
+	tlh.t.Helper()
+	found := tlh.find(level, msgPattern, attrs)
+	if len(found) == 0 {
+		return true
+	}
+	tlh.t.Errorf("unexpected %s record matching %q %v:\n%s", level, msgPattern, attrs, tlh.format(found))
+	return false
+}
+
+// AssertNoErrors fails the test if a record was logged at slog.LevelError or above
+func (tlh *TestSLogHandler) AssertNoErrors() bool {
+	tlh.t.Helper()
+	var errs []slog.Record
+	for _, record := range tlh.Records() {
+		if record.Level >= slog.LevelError {
+			errs = append(errs, record)
+		}
+	}
+	if len(errs) == 0 {
+		return true
+	}
+	tlh.t.Errorf("%d error records:\n%s", len(errs), tlh.format(errs))
+	return false
+}
+
+// UpdateGoldenEnv is the environment variable rewriting the golden files of AssertGolden, if set
+const UpdateGoldenEnv = "UPDATE_GOLDEN"
+
+// AssertGolden compares the records with the golden file, one ConsoleHandler line per record
+// without the time. The golden file is written instead, if the UPDATE_GOLDEN environment variable is set.
+func (tlh *TestSLogHandler) AssertGolden(path string) bool {
+	tlh.t.Helper()
+	got := tlh.format(tlh.Records())
+	if os.Getenv(UpdateGoldenEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			tlh.t.Fatalf("can't create the golden file directory: %v", err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			tlh.t.Fatalf("can't write the golden file: %v", err)
+		}
+		return true
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		tlh.t.Errorf("can't read the golden file, run with %s=1 to create it: %v", UpdateGoldenEnv, err)
+		return false
+	}
+	if !bytes.Equal(got, want) {
+		tlh.t.Errorf("logs differ from %s\ngot:\n%swant:\n%s", path, got, want)
+		return false
+	}
+	return true
+}
+
+// format writes the records like ConsoleHandler, without the time and colors
+func (tlh *TestSLogHandler) format(records []slog.Record) []byte {
+	var buf bytes.Buffer
+	h := NewConsoleHandlerWithOptions(&buf, &ConsoleHandlerOptions{
+		HandlerOptions: slog.HandlerOptions{Level: slog.Level(-100)},
+		Color:          ColorNever,
+		TimeFormat:     "-",
+	})
+	for _, record := range records {
+		if err := h.Handle(context.Background(), record); err != nil {
+			fmt.Fprintf(&buf, "%s: %v\n", record.Message, err)
+		}
+	}
+	return buf.Bytes()
 }
 
 var _ slog.Handler = &TestSLogHandler{}
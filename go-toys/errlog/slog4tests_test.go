@@ -1,8 +1,12 @@
 package errlog
 
 import (
+	"fmt"
 	"log/slog"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestTestSLogHandler_Enabled(t *testing.T) {
@@ -16,3 +20,77 @@ func TestTestSLogHandler_Enabled(t *testing.T) {
 		t.Logf("captured record: %v", r)
 	}
 }
+
+func TestTestSLogHandlerWithAttrs(t *testing.T) {
+	var records []slog.Record
+	records = CaptureSLog(t, func() {
+		logger := slog.With("app", "demo").WithGroup("req").With("method", "GET")
+		logger.Info("served", "status", 200)
+	})
+	if len(records) != 1 {
+		t.Fatalf("got %d records", len(records))
+	}
+	for key, want := range map[string]string{"app": "demo", "req.method": "GET", "req.status": "200"} {
+		if v, ok := RecordAttr(records[0], key); !ok || v.String() != want {
+			t.Errorf("%s: got %v, want %s", key, v, want)
+		}
+	}
+}
+
+func TestTestSLogHandlerAssertions(t *testing.T) {
+	t.Parallel()
+	tlh := NewTestHandler(t, nil)
+	logger := tlh.Logger().With(PackageKey, "shop")
+	logger.Debug("cart loaded", "items", 3)
+	logger.WithGroup("order").Warn("payment retried", "id", 42, slog.Group("card", "brand", "visa"))
+
+	tlh.AssertLogged(slog.LevelDebug, "^cart", "items", 3)
+	tlh.AssertLogged(slog.LevelWarn, "payment", PackageKey, "shop", slog.Int("order.id", 42), "order.card.brand", "visa")
+	tlh.AssertNotLogged(slog.LevelWarn, "payment", "order.id", 43)
+	tlh.AssertNoErrors()
+
+	// The assertions fail with a fake testing.TB
+	fake := &fakeTB{TB: t}
+	failing := NewTestHandler(fake, nil)
+	failing.Logger().Error("boom")
+	if failing.AssertLogged(slog.LevelError, "bang") || failing.AssertNotLogged(slog.LevelError, "boom") || failing.AssertNoErrors() {
+		t.Error("assertions should fail")
+	}
+	if len(fake.errors) != 3 {
+		t.Errorf("expected 3 errors, got %q", fake.errors)
+	}
+}
+
+func TestTestSLogHandlerGolden(t *testing.T) {
+	t.Parallel()
+	tlh := NewTestHandler(t, nil)
+	logger := tlh.Logger()
+	logger.Info("started", "port", 8080)
+	logger.WithGroup("req").Warn("slow request", "path", "/api items", "took", 1500*time.Millisecond)
+
+	golden := filepath.Join(t.TempDir(), "logs.golden")
+	want := "INFO started port=8080\nWARN slow request req.path=\"/api items\" req.took=1.5s\n"
+	if err := os.WriteFile(golden, []byte(want), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tlh.AssertGolden(golden)
+
+	fake := &fakeTB{TB: t}
+	failing := NewTestHandler(fake, nil)
+	failing.Logger().Info("other")
+	if failing.AssertGolden(golden) || len(fake.errors) != 1 {
+		t.Errorf("golden comparison should fail, errors: %q", fake.errors)
+	}
+}
+
+// fakeTB records the errors instead of failing the test
+type fakeTB struct {
+	testing.TB
+	errors []string
+}
+
+func (f *fakeTB) Errorf(format string, args ...any) {
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
+
+func (f *fakeTB) Helper() {}
@@ -1,9 +1,12 @@
 package errlog
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"path"
 	"runtime"
+	"strings"
 )
 
 type StackTracer interface {
@@ -27,6 +30,10 @@ func (ws withStack) Error() string {
 	return ws.cause.Error()
 }
 
+func (ws withStack) Unwrap() error {
+	return ws.cause
+}
+
 func (ws withStack) String() string {
 	if ws.stack != nil && len(ws.stack) > 0 {
 		fn := runtime.FuncForPC(ws.stack[0])
@@ -73,7 +80,8 @@ func WithStackSkip(skip int, err error) error {
 		return nil
 	}
 	pcs := make([]uintptr, 32)
-	count := runtime.Callers(skip+1, pcs)
+	// Skip runtime.Callers and WithStackSkip
+	count := runtime.Callers(skip+2, pcs)
 	ws := withStack{
 		cause: err,
 		stack: make([]uintptr, count),
@@ -84,3 +92,109 @@ func WithStackSkip(skip int, err error) error {
 
 	return ws
 }
+
+// StackFrame is a resolved frame of a StackTracer
+type StackFrame struct {
+	Function string `json:"func"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+}
+
+func (f StackFrame) String() string {
+	return fmt.Sprintf("%s (%s:%d)", f.Function, f.File, f.Line)
+}
+
+// StackTraceOptions control the frames rendered by the handlers
+type StackTraceOptions struct {
+	// MaxDepth limits the number of frames. Zero means all the captured frames.
+	MaxDepth int
+
+	// TrimPaths are removed from the start of the function names and the file paths,
+	// like the module path and the source directory.
+	TrimPaths []string
+}
+
+// FindStackTracer returns the first StackTracer in the Unwrap and errors.Join chain of err, or nil
+func FindStackTracer(err error) StackTracer {
+	var st StackTracer
+	if errors.As(err, &st) {
+		return st
+	}
+	return nil
+}
+
+// StackFrames returns the frames of the first StackTracer in the chain of err.
+// The frames of the runtime package are skipped.
+func StackFrames(err error, opts StackTraceOptions) []StackFrame {
+	st := FindStackTracer(err)
+	if st == nil || len(st.Callers()) == 0 {
+		return nil
+	}
+	var stack []StackFrame
+	frames := runtime.CallersFrames(st.Callers())
+	for {
+		frame, more := frames.Next()
+		if frame.Function != "" && !strings.HasPrefix(frame.Function, "runtime.") {
+			stack = append(stack, StackFrame{
+				Function: trimPaths(frame.Function, opts.TrimPaths),
+				File:     trimPaths(frame.File, opts.TrimPaths),
+				Line:     frame.Line,
+			})
+			if opts.MaxDepth > 0 && len(stack) >= opts.MaxDepth {
+				return stack
+			}
+		}
+		if !more {
+			return stack
+		}
+	}
+}
+
+// trimPaths removes the first matching prefix, and the slash after it
+func trimPaths(s string, prefixes []string) string {
+	for _, prefix := range prefixes {
+		if prefix != "" && strings.HasPrefix(s, prefix) {
+			return strings.TrimPrefix(s[len(prefix):], "/")
+		}
+	}
+	return s
+}
+
+// stackError is an error with its resolved frames, the value of error attributes in the
+// handlers rendering stack traces. It's marshaled to JSON as {"msg":..., "stack":[...]}.
+type stackError struct {
+	error
+	frames []StackFrame
+}
+
+func (se stackError) Unwrap() error {
+	return se.error
+}
+
+func (se stackError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Msg   string       `json:"msg"`
+		Stack []StackFrame `json:"stack,omitempty"`
+	}{se.Error(), se.frames})
+}
+
+// ErrorStackFrames returns the frames stored with an error by InMemoryHandler or NewJSONHandler's ReplaceAttr
+func ErrorStackFrames(err error) []StackFrame {
+	var se stackError
+	if errors.As(err, &se) {
+		return se.frames
+	}
+	return nil
+}
+
+// withStackFrames returns err as a stackError, if there is a StackTracer in its chain
+func withStackFrames(err error, opts StackTraceOptions) error {
+	if _, ok := err.(stackError); ok {
+		return err
+	}
+	frames := StackFrames(err, opts)
+	if frames == nil {
+		return err
+	}
+	return stackError{error: err, frames: frames}
+}
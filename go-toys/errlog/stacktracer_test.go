@@ -1,11 +1,14 @@
 package errlog_test
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/bukodi/playground/errlog"
 	"log/slog"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -33,3 +36,103 @@ func TestStacktraceMulti(t *testing.T) {
 	})))
 	slog.Error("Error occured", errlog.ErrorKey, err2)
 }
+
+func TestStackFrames(t *testing.T) {
+	cause := errors.New("cause")
+	err := fmt.Errorf("wrapped: %w", errors.Join(errors.New("other"), testFnWith(cause)))
+	if !errors.Is(err, cause) {
+		t.Errorf("errors.Is lost the cause of WithStack")
+	}
+
+	frames := errlog.StackFrames(err, errlog.StackTraceOptions{})
+	if len(frames) < 2 {
+		t.Fatalf("too few frames: %v", frames)
+	}
+	if want := "github.com/bukodi/playground/errlog_test.testFnWith"; frames[0].Function != want {
+		t.Errorf("first frame: got %s, want %s", frames[0].Function, want)
+	}
+	if want := "github.com/bukodi/playground/errlog_test.TestStackFrames"; frames[1].Function != want {
+		t.Errorf("second frame: got %s, want %s", frames[1].Function, want)
+	}
+
+	frames = errlog.StackFrames(err, errlog.StackTraceOptions{MaxDepth: 1, TrimPaths: []string{"github.com/bukodi/playground"}})
+	if len(frames) != 1 {
+		t.Fatalf("MaxDepth: got %d frames", len(frames))
+	}
+	if want := "errlog_test.testFnWith"; frames[0].Function != want {
+		t.Errorf("trimmed: got %s, want %s", frames[0].Function, want)
+	}
+
+	if frames := errlog.StackFrames(cause, errlog.StackTraceOptions{}); frames != nil {
+		t.Errorf("frames without StackTracer: %v", frames)
+	}
+}
+
+func testFnWith(err error) error {
+	return errlog.WithStack(err)
+}
+
+func TestJSONHandlerStackTrace(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(errlog.NewJSONHandler(&buf, &errlog.JSONHandlerOptions{
+		HandlerOptions: slog.HandlerOptions{
+			ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+				if a.Key == slog.TimeKey && len(groups) == 0 {
+					return slog.Attr{}
+				}
+				return a
+			},
+		},
+		StackTrace: errlog.StackTraceOptions{MaxDepth: 1},
+	}))
+	logger.Error("failed", errlog.ErrorAttr(testFnWith(errors.New("boom"))), slog.Group("g", "plain", errors.New("plain")))
+
+	var got struct {
+		Err struct {
+			Msg   string              `json:"msg"`
+			Stack []errlog.StackFrame `json:"stack"`
+		} `json:"err"`
+		G struct {
+			Plain string `json:"plain"`
+		} `json:"g"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON %s: %v", buf.String(), err)
+	}
+	if got.Err.Msg != "boom" {
+		t.Errorf("msg: got %q", got.Err.Msg)
+	}
+	if len(got.Err.Stack) != 1 || got.Err.Stack[0].Function != "github.com/bukodi/playground/errlog_test.testFnWith" ||
+		!strings.HasSuffix(got.Err.Stack[0].File, "stacktracer_test.go") || got.Err.Stack[0].Line == 0 {
+		t.Errorf("stack: got %+v", got.Err.Stack)
+	}
+	if got.G.Plain != "plain" {
+		t.Errorf("plain error: got %q", got.G.Plain)
+	}
+}
+
+func TestInMemoryHandlerStackTrace(t *testing.T) {
+	handler := errlog.NewInMemoryHandlerWithOptions(10, &errlog.InMemoryHandlerOptions{
+		StackTrace: errlog.StackTraceOptions{MaxDepth: 2},
+	})
+	cause := errors.New("boom")
+	slog.New(handler).Error("failed", slog.Group("req", errlog.ErrorAttr(testFnWith(cause))))
+
+	records := handler.GetRecords()
+	if len(records) != 1 {
+		t.Fatalf("got %d records", len(records))
+	}
+	var err error
+	records[0].Attrs(func(a slog.Attr) bool {
+		if a.Key == "req" {
+			err, _ = a.Value.Group()[0].Value.Any().(error)
+		}
+		return true
+	})
+	if !errors.Is(err, cause) {
+		t.Fatalf("stored error: %v", err)
+	}
+	if frames := errlog.ErrorStackFrames(err); len(frames) != 2 || frames[0].Function != "github.com/bukodi/playground/errlog_test.testFnWith" {
+		t.Errorf("frames: %v", frames)
+	}
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bukodi/playground/pqctlsscan/pqcscan"
+)
+
+// exitCodeRegression is the exit code of the diff mode and of a scan with -baseline if a regression is found
+const exitCodeRegression = 3
+
+// scanReport is the JSON output of a scan
+type scanReport struct {
+	ScanTime    string               `json:"scan_time"`
+	ElapsedTime string               `json:"elapsed_time"`
+	OpenPorts   int                  `json:"open_tls_ports"`
+	Results     []pqcscan.ScanResult `json:"results"`
+}
+
+// readScanReport reads a JSON file written with -format json
+func readScanReport(path string) (*scanReport, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	report := new(scanReport)
+	if err := json.NewDecoder(f).Decode(report); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return report, nil
+}
+
+// ChangeKind is the kind of a difference between two scans
+type ChangeKind string
+
+const (
+	PortOpened           = ChangeKind("port-opened")
+	PortClosed           = ChangeKind("port-closed")
+	PortTypeChanged      = ChangeKind("port-type-changed")
+	PQKexLost            = ChangeKind("pq-kex-lost")
+	PQKexGained          = ChangeKind("pq-kex-gained")
+	NonPQKexEnabled      = ChangeKind("non-pq-kex-enabled")
+	NonPQKexDisabled     = ChangeKind("non-pq-kex-disabled")
+	PQGroupRemoved       = ChangeKind("pq-group-removed")
+	GroupsChanged        = ChangeKind("groups-changed")
+	CertKeyChanged       = ChangeKind("cert-key-changed")
+	CertSignatureChanged = ChangeKind("cert-signature-changed")
+	RiskChanged          = ChangeKind("risk-changed")
+)
+
+// Change is a difference of an endpoint between two scans
+type Change struct {
+	Endpoint   string     `json:"endpoint"`
+	Kind       ChangeKind `json:"kind"`
+	Old        string     `json:"old,omitempty"`
+	New        string     `json:"new,omitempty"`
+	Regression bool       `json:"regression"`
+}
+
+func (c Change) String() string {
+	mark := " "
+	if c.Regression {
+		mark = "!"
+	}
+	s := fmt.Sprintf("%s %-22s %s", mark, c.Endpoint, c.Kind)
+	if c.Old != "" || c.New != "" {
+		s += fmt.Sprintf(": %s -> %s", orDash(c.Old), orDash(c.New))
+	}
+	return s
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// hasRegression reports whether any of the changes is a regression
+func hasRegression(changes []Change) bool {
+	return slices.ContainsFunc(changes, func(c Change) bool { return c.Regression })
+}
+
+// endpointKey is host:port, with a /udp suffix for QUIC that shares the port number with TCP.
+// The host is the host name the address was resolved from, if any, so a host behind
+// rotating addresses keeps its key. The addresses of a host name share the key, see
+// resultsByEndpoint.
+func endpointKey(result pqcscan.ScanResult) string {
+	key := net.JoinHostPort(endpointHost(result), strconv.Itoa(result.Port))
+	if result.PortType == pqcscan.QUIC {
+		key += "/udp"
+	}
+	return key
+}
+
+// diffResults compares a scan to an earlier one. The changes are sorted by endpoint.
+//
+// Regressions are changes weakening the protection against a quantum computer: lost
+// post-quantum key exchange or groups, re-enabled classic key exchange, certificates
+// losing post-quantum algorithms, higher quantum risk, and new ports without post-quantum
+// key exchange.
+func diffResults(old, new []pqcscan.ScanResult) []Change {
+	oldByKey := resultsByEndpoint(old)
+	newByKey := resultsByEndpoint(new)
+
+	var changes []Change
+	for key, n := range newByKey {
+		o, ok := oldByKey[key]
+		if !ok {
+			risky := (n.PortType == pqcscan.TLS || n.PortType == pqcscan.SSH || n.PortType == pqcscan.QUIC) && !n.IsPQKexSupported
+			changes = append(changes, Change{Endpoint: key, Kind: PortOpened, New: portTypeLabel(n), Regression: risky})
+			continue
+		}
+		changes = append(changes, diffResult(key, o, n)...)
+	}
+	for key, o := range oldByKey {
+		if _, ok := newByKey[key]; !ok {
+			changes = append(changes, Change{Endpoint: key, Kind: PortClosed, Old: portTypeLabel(o)})
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Endpoint < changes[j].Endpoint
+	})
+	return changes
+}
+
+// endpointHost identifies the host of the result in the reports: the host name the
+// address was resolved from, if any, otherwise the address
+func endpointHost(result pqcscan.ScanResult) string {
+	if result.Hostname != "" {
+		return result.Hostname
+	}
+	return result.Address
+}
+
+// resultsByEndpoint maps the results by endpointKey. The results of the addresses of a
+// host name are combined by worstResult, so a regression on any address shows up.
+func resultsByEndpoint(results []pqcscan.ScanResult) map[string]pqcscan.ScanResult {
+	byKey := make(map[string]pqcscan.ScanResult, len(results))
+	for _, r := range results {
+		key := endpointKey(r)
+		if o, ok := byKey[key]; ok {
+			r = worstResult(o, r)
+		}
+		byKey[key] = r
+	}
+	return byKey
+}
+
+// worstResult combines the results of two addresses of an endpoint: post-quantum key
+// exchange and groups only if both have them, classic key exchange if either accepts
+// it, the certificate chain with the weaker leaf and the higher quantum risk.
+func worstResult(a, b pqcscan.ScanResult) pqcscan.ScanResult {
+	w := a
+	w.IsPQKexSupported = a.IsPQKexSupported && b.IsPQKexSupported
+	w.IsNonPQKexSupported = a.IsNonPQKexSupported || b.IsNonPQKexSupported
+
+	switch {
+	case a.TLSGroups == nil:
+		w.TLSGroups = b.TLSGroups
+	case b.TLSGroups != nil:
+		groups := *a.TLSGroups
+		groups.Supported = slices.DeleteFunc(slices.Clone(a.TLSGroups.Supported), func(name string) bool {
+			return !slices.Contains(b.TLSGroups.Supported, name)
+		})
+		w.TLSGroups = &groups
+	}
+
+	if len(b.CertChain) > 0 && (len(a.CertChain) == 0 || pqLeafRank(b.CertChain[0]) < pqLeafRank(a.CertChain[0])) {
+		w.CertChain = b.CertChain
+	}
+	if riskRank(riskLevel(b.QuantumRisk)) > riskRank(riskLevel(a.QuantumRisk)) {
+		w.QuantumRisk = b.QuantumRisk
+	}
+	return w
+}
+
+// pqLeafRank counts the post-quantum algorithms of a certificate
+func pqLeafRank(leaf pqcscan.CertInfo) int {
+	rank := 0
+	if leaf.PQKey {
+		rank++
+	}
+	if leaf.PQSignature {
+		rank++
+	}
+	return rank
+}
+
+// diffResult compares the two scans of an endpoint
+func diffResult(key string, o, n pqcscan.ScanResult) []Change {
+	var changes []Change
+	add := func(kind ChangeKind, old, new string, regression bool) {
+		changes = append(changes, Change{Endpoint: key, Kind: kind, Old: old, New: new, Regression: regression})
+	}
+
+	if portTypeLabel(o) != portTypeLabel(n) {
+		add(PortTypeChanged, portTypeLabel(o), portTypeLabel(n), o.IsPQKexSupported && !n.IsPQKexSupported)
+	}
+	if o.IsPQKexSupported && !n.IsPQKexSupported {
+		add(PQKexLost, "", "", true)
+	} else if !o.IsPQKexSupported && n.IsPQKexSupported {
+		add(PQKexGained, "", "", false)
+	}
+	if !o.IsNonPQKexSupported && n.IsNonPQKexSupported {
+		add(NonPQKexEnabled, "", "", true)
+	} else if o.IsNonPQKexSupported && !n.IsNonPQKexSupported {
+		add(NonPQKexDisabled, "", "", false)
+	}
+
+	oldGroups, newGroups := supportedGroups(o), supportedGroups(n)
+	if !slices.Equal(oldGroups, newGroups) {
+		var removedPQ bool
+		for _, name := range oldGroups {
+			if pqcscan.IsPQGroupName(name) && !slices.Contains(newGroups, name) {
+				removedPQ = true
+			}
+		}
+		kind := GroupsChanged
+		if removedPQ {
+			kind = PQGroupRemoved
+		}
+		add(kind, strings.Join(oldGroups, ","), strings.Join(newGroups, ","), removedPQ)
+	}
+
+	if len(o.CertChain) > 0 && len(n.CertChain) > 0 {
+		ol, nl := o.CertChain[0], n.CertChain[0]
+		if ol.KeyType != nl.KeyType || ol.KeyBits != nl.KeyBits {
+			add(CertKeyChanged, certKeyLabel(ol), certKeyLabel(nl), ol.PQKey && !nl.PQKey)
+		}
+		if ol.SignatureAlgorithm != nl.SignatureAlgorithm {
+			add(CertSignatureChanged, ol.SignatureAlgorithm, nl.SignatureAlgorithm, ol.PQSignature && !nl.PQSignature)
+		}
+	}
+
+	if oldRisk, newRisk := riskLevel(o.QuantumRisk), riskLevel(n.QuantumRisk); oldRisk != newRisk {
+		add(RiskChanged, oldRisk, newRisk, riskRank(newRisk) > riskRank(oldRisk))
+	}
+	return changes
+}
+
+func supportedGroups(result pqcscan.ScanResult) []string {
+	if result.TLSGroups == nil {
+		return nil
+	}
+	return result.TLSGroups.Supported
+}
+
+func certKeyLabel(cert pqcscan.CertInfo) string {
+	if cert.KeyBits > 0 {
+		return fmt.Sprintf("%s %d", cert.KeyType, cert.KeyBits)
+	}
+	return cert.KeyType
+}
+
+// riskRank orders the risk levels, unknown is below low
+func riskRank(level string) int {
+	switch level {
+	case pqcscan.RiskLow:
+		return 1
+	case pqcscan.RiskMedium:
+		return 2
+	case pqcscan.RiskHigh:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// outputDiffText prints the changes, regressions marked with !
+func outputDiffText(w io.Writer, changes []Change) {
+	if len(changes) == 0 {
+		fmt.Fprintf(w, "No changes.\n")
+		return
+	}
+	regressions := 0
+	for _, c := range changes {
+		fmt.Fprintln(w, c)
+		if c.Regression {
+			regressions++
+		}
+	}
+	fmt.Fprintf(w, "\n%d changes, %d regressions\n", len(changes), regressions)
+}
+
+func outputDiffJSON(w io.Writer, changes []Change) {
+	output := struct {
+		Regression bool     `json:"regression"`
+		Changes    []Change `json:"changes"`
+	}{
+		Regression: hasRegression(changes),
+		Changes:    changes,
+	}
+	if output.Changes == nil {
+		output.Changes = []Change{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(output)
+}
+
+// runDiff implements "pqctlsscan diff [-format text|json] old.json new.json".
+// It returns the exit code: exitCodeRegression if there is a regression.
+func runDiff(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	formatPtr := fs.String("format", "text", "Output format: text or json")
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: pqctlsscan diff [-format text|json] baseline.json current.json\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 2 || (*formatPtr != "text" && *formatPtr != "json") {
+		fs.Usage()
+		return 2
+	}
+
+	baseline, err := readScanReport(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+	current, err := readScanReport(fs.Arg(1))
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	changes := diffResults(baseline.Results, current.Results)
+	if *formatPtr == "json" {
+		outputDiffJSON(stdout, changes)
+	} else {
+		outputDiffText(stdout, changes)
+	}
+	if hasRegression(changes) {
+		return exitCodeRegression
+	}
+	return 0
+}
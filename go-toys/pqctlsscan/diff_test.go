@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bukodi/playground/pqctlsscan/pqcscan"
+	"github.com/stretchr/testify/assert"
+)
+
+func diffTestResults() (baseline, current []pqcscan.ScanResult) {
+	pqLeaf := pqcscan.CertInfo{KeyType: "ML-DSA-65", SignatureAlgorithm: "ML-DSA-65", PQKey: true, PQSignature: true}
+	classicLeaf := pqcscan.CertInfo{KeyType: "ECDSA", KeyBits: 256, SignatureAlgorithm: "ECDSA-SHA256"}
+	baseline = []pqcscan.ScanResult{
+		{Address: "10.0.0.1", Port: 443, PortType: pqcscan.TLS, IsPQKexSupported: true,
+			TLSGroups:   &pqcscan.TLSGroupInfo{Supported: []string{"X25519MLKEM768", "SecP256r1MLKEM768"}},
+			CertChain:   []pqcscan.CertInfo{pqLeaf},
+			QuantumRisk: &pqcscan.QuantumRisk{Level: pqcscan.RiskLow}},
+		{Address: "10.0.0.1", Port: 22, PortType: pqcscan.SSH, IsPQKexSupported: true, IsNonPQKexSupported: true},
+		{Address: "10.0.0.2", Port: 993, PortType: pqcscan.TLS, IsNonPQKexSupported: true},
+	}
+	current = []pqcscan.ScanResult{
+		{Address: "10.0.0.1", Port: 443, PortType: pqcscan.TLS, IsPQKexSupported: true, IsNonPQKexSupported: true,
+			TLSGroups:   &pqcscan.TLSGroupInfo{Supported: []string{"X25519MLKEM768", "X25519"}},
+			CertChain:   []pqcscan.CertInfo{classicLeaf},
+			QuantumRisk: &pqcscan.QuantumRisk{Level: pqcscan.RiskMedium}},
+		{Address: "10.0.0.1", Port: 22, PortType: pqcscan.SSH, IsPQKexSupported: true, IsNonPQKexSupported: true},
+		{Address: "10.0.0.3", Port: 8443, PortType: pqcscan.TLS, IsNonPQKexSupported: true},
+	}
+	return baseline, current
+}
+
+func TestDiffResults(t *testing.T) {
+	baseline, current := diffTestResults()
+	changes := diffResults(baseline, current)
+	assert.Equal(t, []Change{
+		{Endpoint: "10.0.0.1:443", Kind: NonPQKexEnabled, Regression: true},
+		{Endpoint: "10.0.0.1:443", Kind: PQGroupRemoved, Old: "X25519MLKEM768,SecP256r1MLKEM768", New: "X25519MLKEM768,X25519", Regression: true},
+		{Endpoint: "10.0.0.1:443", Kind: CertKeyChanged, Old: "ML-DSA-65", New: "ECDSA 256", Regression: true},
+		{Endpoint: "10.0.0.1:443", Kind: CertSignatureChanged, Old: "ML-DSA-65", New: "ECDSA-SHA256", Regression: true},
+		{Endpoint: "10.0.0.1:443", Kind: RiskChanged, Old: pqcscan.RiskLow, New: pqcscan.RiskMedium, Regression: true},
+		{Endpoint: "10.0.0.2:993", Kind: PortClosed, Old: "TLS"},
+		{Endpoint: "10.0.0.3:8443", Kind: PortOpened, New: "TLS", Regression: true},
+	}, changes)
+	assert.True(t, hasRegression(changes))
+
+	// Improvements only
+	changes = diffResults(current[:2], baseline[:2])
+	assert.False(t, hasRegression(changes), "%v", changes)
+	assert.Empty(t, diffResults(baseline, baseline))
+
+	lost := baseline[1]
+	lost.IsPQKexSupported = false
+	changes = diffResults(baseline[1:2], []pqcscan.ScanResult{lost})
+	assert.Equal(t, []Change{{Endpoint: "10.0.0.1:22", Kind: PQKexLost, Regression: true}}, changes)
+
+	// QUIC shares the port number with TCP
+	quic := pqcscan.ScanResult{Address: "10.0.0.1", Port: 443, PortType: pqcscan.QUIC}
+	changes = diffResults(baseline[:1], []pqcscan.ScanResult{baseline[0], quic})
+	assert.Equal(t, []Change{{Endpoint: "10.0.0.1:443/udp", Kind: PortOpened, New: "QUIC", Regression: true}}, changes)
+
+	// A host name resolved to another address is the same endpoint
+	named := baseline[1]
+	named.Hostname = "ssh.example.com"
+	moved := named
+	moved.Address = "10.0.0.9"
+	moved.IsPQKexSupported = false
+	changes = diffResults([]pqcscan.ScanResult{named}, []pqcscan.ScanResult{moved})
+	assert.Equal(t, []Change{{Endpoint: "ssh.example.com:22", Kind: PQKexLost, Regression: true}}, changes)
+
+	// A regression on any address of a host name shows up, not only on the last one
+	v6 := pqcscan.ScanResult{Address: "2001:db8::1", Hostname: "www.example.com", Port: 443, PortType: pqcscan.TLS,
+		IsPQKexSupported: true, TLSGroups: &pqcscan.TLSGroupInfo{Supported: []string{"X25519MLKEM768"}},
+		QuantumRisk: &pqcscan.QuantumRisk{Level: pqcscan.RiskLow}}
+	v4 := v6
+	v4.Address = "93.184.216.34"
+	lostV6 := v6
+	lostV6.IsPQKexSupported = false
+	lostV6.IsNonPQKexSupported = true
+	lostV6.TLSGroups = &pqcscan.TLSGroupInfo{Supported: []string{"X25519"}}
+	lostV6.QuantumRisk = &pqcscan.QuantumRisk{Level: pqcscan.RiskHigh}
+	current = []pqcscan.ScanResult{lostV6, v4}
+	pqcscan.SortResults(current)
+	assert.Equal(t, "93.184.216.34", current[len(current)-1].Address)
+	changes = diffResults([]pqcscan.ScanResult{v6, v4}, current)
+	assert.Equal(t, []Change{
+		{Endpoint: "www.example.com:443", Kind: PQKexLost, Regression: true},
+		{Endpoint: "www.example.com:443", Kind: NonPQKexEnabled, Regression: true},
+		{Endpoint: "www.example.com:443", Kind: PQGroupRemoved, Old: "X25519MLKEM768", New: "", Regression: true},
+		{Endpoint: "www.example.com:443", Kind: RiskChanged, Old: pqcscan.RiskLow, New: pqcscan.RiskHigh, Regression: true},
+	}, changes)
+}
+
+func TestRunDiff(t *testing.T) {
+	baseline, current := diffTestResults()
+	dir := t.TempDir()
+	writeReport := func(name string, results []pqcscan.ScanResult) string {
+		path := filepath.Join(dir, name)
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+		defer f.Close()
+		outputJSON(f, results, 0)
+		return path
+	}
+	baselinePath := writeReport("baseline.json", baseline)
+	currentPath := writeReport("current.json", current)
+
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, exitCodeRegression, runDiff([]string{baselinePath, currentPath}, &stdout, &stderr))
+	assert.Contains(t, stdout.String(), "! 10.0.0.1:443")
+	assert.Contains(t, stdout.String(), "7 changes, 6 regressions")
+
+	stdout.Reset()
+	assert.Equal(t, 0, runDiff([]string{"-format", "json", baselinePath, baselinePath}, &stdout, &stderr))
+	var output struct {
+		Regression bool
+		Changes    []Change
+	}
+	assert.NoError(t, json.Unmarshal(stdout.Bytes(), &output))
+	assert.False(t, output.Regression)
+	assert.Empty(t, output.Changes)
+
+	assert.Equal(t, 2, runDiff([]string{baselinePath}, &stdout, &stderr))
+	assert.Equal(t, 1, runDiff([]string{baselinePath, filepath.Join(dir, "missing.json")}, &stdout, &stderr))
+}
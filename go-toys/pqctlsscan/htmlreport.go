@@ -0,0 +1,100 @@
+package main
+
+import (
+	"html/template"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/bukodi/playground/pqctlsscan/pqcscan"
+)
+
+// htmlReportTemplate is a self-contained page: no scripts, no external styles
+var htmlReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"yesNo":     yesNo,
+	"riskLevel": riskLevel,
+	"typeLabel": portTypeLabel,
+	"join":      strings.Join,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>PQC TLS Scan report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { background: #eee; }
+td.yes { color: #176f2c; }
+td.no { color: #a31515; }
+.low { background: #d7f5dd; }
+.medium { background: #fff1c2; }
+.high { background: #f9d0d0; }
+ul { margin: 0; padding-left: 1.2em; }
+.summary td { text-align: right; }
+</style>
+</head>
+<body>
+<h1>PQC TLS Scan report</h1>
+<p>Generated {{.Generated}}, scan took {{.Elapsed}}, {{len .Results}} open ports on {{len .Hosts}} hosts.</p>
+
+<h2>Summary</h2>
+<table class="summary">
+<tr><th>Quantum risk</th><th>Endpoints</th></tr>
+<tr class="low"><th>low</th><td>{{.Summary.low}}</td></tr>
+<tr class="medium"><th>medium</th><td>{{.Summary.medium}}</td></tr>
+<tr class="high"><th>high</th><td>{{.Summary.high}}</td></tr>
+<tr><th>not assessed</th><td>{{index .Summary "-"}}</td></tr>
+</table>
+
+{{range .Hosts}}
+<h2>{{.Host}}</h2>
+<table>
+<tr><th>Port</th><th>Address</th><th>Type</th><th>PQ kex</th><th>Classic kex</th><th>Groups</th><th>Certificate</th><th>Quantum risk</th><th>Findings</th></tr>
+{{range .Results}}
+<tr>
+<td>{{.Port}}</td>
+<td>{{.Address}}</td>
+<td>{{typeLabel .}}</td>
+<td class="{{yesNo .IsPQKexSupported}}">{{yesNo .IsPQKexSupported}}</td>
+<td>{{yesNo .IsNonPQKexSupported}}</td>
+<td>{{with .TLSGroups}}{{join .Supported ", "}}{{end}}</td>
+<td>{{with .CertChain}}{{with index . 0}}{{.Subject}}<br>{{.KeyType}}{{if .KeyBits}} {{.KeyBits}}{{end}}, {{.SignatureAlgorithm}}<br>expires {{.NotAfter.Format "2006-01-02"}}{{end}}{{end}}</td>
+<td class="{{riskLevel .QuantumRisk}}">{{riskLevel .QuantumRisk}}</td>
+<td>{{with .QuantumRisk}}{{with .Reasons}}<ul>{{range .}}<li>{{.}}</li>{{end}}</ul>{{end}}{{end}}{{.Error}}</td>
+</tr>
+{{end}}
+</table>
+{{end}}
+</body>
+</html>
+`))
+
+type htmlHost struct {
+	Host    string
+	Results []pqcscan.ScanResult
+}
+
+// outputHTML writes a self-contained HTML page with a PQC readiness table for every host
+func outputHTML(w io.Writer, results []pqcscan.ScanResult, elapsed time.Duration, verbose bool) error {
+	data := struct {
+		Generated string
+		Elapsed   time.Duration
+		Results   []pqcscan.ScanResult
+		Hosts     []htmlHost
+		Summary   map[string]int
+	}{
+		Generated: time.Now().Format(time.RFC3339),
+		Elapsed:   elapsed.Round(time.Millisecond),
+		Results:   results,
+		Summary:   map[string]int{pqcscan.RiskLow: 0, pqcscan.RiskMedium: 0, pqcscan.RiskHigh: 0, "-": 0},
+	}
+	hosts, byHost := resultsByHost(results)
+	for _, host := range hosts {
+		data.Hosts = append(data.Hosts, htmlHost{Host: host, Results: byHost[host]})
+	}
+	for _, result := range results {
+		data.Summary[riskLevel(result.QuantumRisk)]++
+	}
+	return htmlReportTemplate.Execute(w, data)
+}
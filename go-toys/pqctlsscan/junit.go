@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/bukodi/playground/pqctlsscan/pqcscan"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// outputJUnit writes a test suite for every host and a test case for every endpoint.
+// An endpoint fails if it violates an error level rule, warnings go to system-out.
+// Ports that are neither TLS nor SSH are skipped. The hosts are named like endpointKey,
+// the test cases of a host name also have the address.
+func outputJUnit(w io.Writer, results []pqcscan.ScanResult, elapsed time.Duration, verbose bool) error {
+	report := junitTestSuites{Name: "pqctlsscan", Time: junitSeconds(elapsed)}
+	hosts, byHost := resultsByHost(results)
+	for _, host := range hosts {
+		suite := junitTestSuite{Name: host}
+		var suiteTime time.Duration
+		for _, result := range byHost[host] {
+			name := fmt.Sprintf("%d/%s", result.Port, portTypeLabel(result))
+			if result.Hostname != "" {
+				name += " " + result.Address
+			}
+			tc := junitTestCase{
+				Name:      name,
+				ClassName: "pqctlsscan." + host,
+				Time:      junitSeconds(result.TestDuration),
+			}
+			suiteTime += result.TestDuration
+
+			if result.QuantumRisk == nil {
+				tc.Skipped = &junitSkipped{Message: fmt.Sprintf("%s port is not assessed", result.PortType)}
+				suite.Skipped++
+			}
+			var failures, warnings []string
+			for _, f := range resultFindings(result) {
+				line := fmt.Sprintf("%s %s: %s", f.Rule.ID, f.Rule.Name, f.Message)
+				if f.Rule.Level == levelError {
+					failures = append(failures, line)
+				} else {
+					warnings = append(warnings, line)
+				}
+			}
+			if len(failures) > 0 {
+				tc.Failure = &junitFailure{
+					Message: failures[0],
+					Type:    "quantum-risk-" + result.QuantumRisk.Level,
+					Text:    strings.Join(append(failures, warnings...), "\n"),
+				}
+				suite.Failures++
+			} else if len(warnings) > 0 {
+				tc.SystemOut = strings.Join(warnings, "\n")
+			}
+			suite.TestCases = append(suite.TestCases, tc)
+		}
+		suite.Tests = len(suite.TestCases)
+		suite.Time = junitSeconds(suiteTime)
+
+		report.Suites = append(report.Suites, suite)
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+		report.Skipped += suite.Skipped
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,232 @@
+package pqcscan
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// CertInfo describes a certificate of the chain presented by a TLS server
+type CertInfo struct {
+	Subject            string    `json:"subject"`
+	Issuer             string    `json:"issuer"`
+	KeyType            string    `json:"keyType"`
+	KeyBits            int       `json:"keyBits,omitempty"`
+	SignatureAlgorithm string    `json:"signatureAlgorithm"`
+	NotBefore          time.Time `json:"notBefore"`
+	NotAfter           time.Time `json:"notAfter"`
+	DNSNames           []string  `json:"dnsNames,omitempty"`
+	IPAddresses        []string  `json:"ipAddresses,omitempty"`
+	SelfSigned         bool      `json:"selfSigned"`
+	PQKey              bool      `json:"pqKey"`       // ML-DSA, SLH-DSA or composite public key
+	PQSignature        bool      `json:"pqSignature"` // Signed with ML-DSA, SLH-DSA or a composite
+}
+
+// pqAlgorithmNames names the post-quantum signature OIDs (FIPS 204, FIPS 205, CSOR)
+var pqAlgorithmNames = map[string]string{
+	"2.16.840.1.101.3.4.3.17": "ML-DSA-44",
+	"2.16.840.1.101.3.4.3.18": "ML-DSA-65",
+	"2.16.840.1.101.3.4.3.19": "ML-DSA-87",
+	"2.16.840.1.101.3.4.3.20": "SLH-DSA-SHA2-128s",
+	"2.16.840.1.101.3.4.3.21": "SLH-DSA-SHA2-128f",
+	"2.16.840.1.101.3.4.3.22": "SLH-DSA-SHA2-192s",
+	"2.16.840.1.101.3.4.3.23": "SLH-DSA-SHA2-192f",
+	"2.16.840.1.101.3.4.3.24": "SLH-DSA-SHA2-256s",
+	"2.16.840.1.101.3.4.3.25": "SLH-DSA-SHA2-256f",
+	"2.16.840.1.101.3.4.3.26": "SLH-DSA-SHAKE-128s",
+	"2.16.840.1.101.3.4.3.27": "SLH-DSA-SHAKE-128f",
+	"2.16.840.1.101.3.4.3.28": "SLH-DSA-SHAKE-192s",
+	"2.16.840.1.101.3.4.3.29": "SLH-DSA-SHAKE-192f",
+	"2.16.840.1.101.3.4.3.30": "SLH-DSA-SHAKE-256s",
+	"2.16.840.1.101.3.4.3.31": "SLH-DSA-SHAKE-256f",
+}
+
+// compositeAlgorithmNames names the composite ML-DSA signature OIDs of draft-ietf-lamps-pq-composite-sigs.
+// The other algorithms of the PKIX id-alg arc are classic.
+var compositeAlgorithmNames = map[string]string{
+	"1.3.6.1.5.5.7.6.37": "MLDSA44-RSA2048-PSS-SHA256",
+	"1.3.6.1.5.5.7.6.38": "MLDSA44-RSA2048-PKCS15-SHA256",
+	"1.3.6.1.5.5.7.6.39": "MLDSA44-Ed25519-SHA512",
+	"1.3.6.1.5.5.7.6.40": "MLDSA44-ECDSA-P256-SHA256",
+	"1.3.6.1.5.5.7.6.41": "MLDSA65-RSA3072-PSS-SHA512",
+	"1.3.6.1.5.5.7.6.42": "MLDSA65-RSA3072-PKCS15-SHA512",
+	"1.3.6.1.5.5.7.6.43": "MLDSA65-RSA4096-PSS-SHA512",
+	"1.3.6.1.5.5.7.6.44": "MLDSA65-RSA4096-PKCS15-SHA512",
+	"1.3.6.1.5.5.7.6.45": "MLDSA65-ECDSA-P256-SHA512",
+	"1.3.6.1.5.5.7.6.46": "MLDSA65-ECDSA-P384-SHA512",
+	"1.3.6.1.5.5.7.6.47": "MLDSA65-ECDSA-brainpoolP256r1-SHA512",
+	"1.3.6.1.5.5.7.6.48": "MLDSA65-Ed25519-SHA512",
+	"1.3.6.1.5.5.7.6.49": "MLDSA87-ECDSA-P384-SHA512",
+	"1.3.6.1.5.5.7.6.50": "MLDSA87-ECDSA-brainpoolP384r1-SHA512",
+	"1.3.6.1.5.5.7.6.51": "MLDSA87-Ed448-SHAKE256",
+	"1.3.6.1.5.5.7.6.52": "MLDSA87-RSA3072-PSS-SHA512",
+	"1.3.6.1.5.5.7.6.53": "MLDSA87-RSA4096-PSS-SHA512",
+	"1.3.6.1.5.5.7.6.54": "MLDSA87-ECDSA-P521-SHA512",
+}
+
+// entrustCompositeOIDPrefix is the pre-standard arc of the composite signatures, used by Entrust
+const entrustCompositeOIDPrefix = "2.16.840.1.114027.80.8.1."
+
+// pqAlgorithmName names a post-quantum or composite signature algorithm OID.
+// ok is false for classic and unknown algorithms.
+func pqAlgorithmName(oid asn1.ObjectIdentifier) (name string, ok bool) {
+	s := oid.String()
+	if name, ok := pqAlgorithmNames[s]; ok {
+		return name, true
+	}
+	if name, ok := compositeAlgorithmNames[s]; ok {
+		return name, true
+	}
+	if strings.HasPrefix(s, entrustCompositeOIDPrefix) {
+		return "Composite-ML-DSA (" + s + ")", true
+	}
+	return "", false
+}
+
+// newCertInfo describes the certificate. Algorithms unknown to crypto/x509 are
+// read from the raw DER, so post-quantum certificates are described too.
+func newCertInfo(cert *x509.Certificate) CertInfo {
+	info := CertInfo{
+		Subject:            cert.Subject.String(),
+		Issuer:             cert.Issuer.String(),
+		KeyType:            cert.PublicKeyAlgorithm.String(),
+		SignatureAlgorithm: cert.SignatureAlgorithm.String(),
+		NotBefore:          cert.NotBefore,
+		NotAfter:           cert.NotAfter,
+		DNSNames:           cert.DNSNames,
+		SelfSigned:         bytes.Equal(cert.RawSubject, cert.RawIssuer),
+	}
+	for _, ip := range cert.IPAddresses {
+		info.IPAddresses = append(info.IPAddresses, ip.String())
+	}
+
+	switch pub := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		info.KeyBits = pub.N.BitLen()
+	case *ecdsa.PublicKey:
+		info.KeyBits = pub.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		info.KeyBits = 256
+	}
+
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(cert.RawSubjectPublicKeyInfo, &spki); err == nil {
+		if name, ok := pqAlgorithmName(spki.Algorithm.Algorithm); ok {
+			info.KeyType = name
+			info.KeyBits = spki.PublicKey.BitLength
+			info.PQKey = true
+		} else if cert.PublicKeyAlgorithm == x509.UnknownPublicKeyAlgorithm {
+			info.KeyType = spki.Algorithm.Algorithm.String()
+		}
+	}
+
+	var outer struct {
+		TBSCertificate     asn1.RawValue
+		SignatureAlgorithm pkix.AlgorithmIdentifier
+		SignatureValue     asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(cert.Raw, &outer); err == nil {
+		if name, ok := pqAlgorithmName(outer.SignatureAlgorithm.Algorithm); ok {
+			info.SignatureAlgorithm = name
+			info.PQSignature = true
+		} else if cert.SignatureAlgorithm == x509.UnknownSignatureAlgorithm {
+			info.SignatureAlgorithm = outer.SignatureAlgorithm.Algorithm.String()
+		}
+	}
+	return info
+}
+
+// newCertChain describes the certificates presented by the server, leaf first
+func newCertChain(certs []*x509.Certificate) []CertInfo {
+	chain := make([]CertInfo, 0, len(certs))
+	for _, cert := range certs {
+		chain = append(chain, newCertInfo(cert))
+	}
+	return chain
+}
+
+// Quantum risk levels
+const (
+	RiskLow    = "low"    // Post-quantum key exchange only, post-quantum authentication
+	RiskMedium = "medium" // Post-quantum key exchange, but a classic fallback or classic authentication remains
+	RiskHigh   = "high"   // No post-quantum key exchange: recorded traffic can be decrypted later
+)
+
+// QuantumRisk is the verdict on an endpoint against a cryptographically relevant quantum computer
+type QuantumRisk struct {
+	Level string `json:"level"`
+
+	// HarvestNowDecryptLater is true if a client can negotiate a classic key exchange,
+	// so recorded traffic can be decrypted later
+	HarvestNowDecryptLater bool `json:"harvestNowDecryptLater"`
+
+	// ForgedAuthentication is true if the server is authenticated with a classic signature,
+	// so the server can be impersonated once the key or a CA key is broken
+	ForgedAuthentication bool `json:"forgedAuthentication"`
+
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// AssessQuantumRisk combines the key exchange and the authentication of the result.
+// Authentication is assessed from the certificate chain or the SSH host key; without them it isn't known.
+func AssessQuantumRisk(result *ScanResult) *QuantumRisk {
+	risk := &QuantumRisk{Level: RiskLow}
+	raise := func(level string) {
+		if level == RiskHigh || risk.Level == RiskLow {
+			risk.Level = level
+		}
+	}
+
+	switch {
+	case !result.IsPQKexSupported:
+		risk.HarvestNowDecryptLater = true
+		risk.Reasons = append(risk.Reasons, "no post-quantum key exchange")
+		raise(RiskHigh)
+	case result.IsNonPQKexSupported:
+		risk.HarvestNowDecryptLater = true
+		risk.Reasons = append(risk.Reasons, "classic key exchange is still accepted")
+		raise(RiskMedium)
+	}
+
+	if result.SSH != nil && result.SSH.HostKeyType != "" {
+		// There is no post-quantum SSH host key algorithm in use yet
+		risk.ForgedAuthentication = true
+		risk.Reasons = append(risk.Reasons, fmt.Sprintf("host key is %s", result.SSH.HostKeyType))
+		raise(RiskMedium)
+		return risk
+	}
+	if len(result.CertChain) == 0 {
+		risk.Reasons = append(risk.Reasons, "authentication not assessed")
+		raise(RiskMedium)
+		return risk
+	}
+	leaf := result.CertChain[0]
+	if !leaf.PQKey {
+		risk.ForgedAuthentication = true
+		risk.Reasons = append(risk.Reasons, fmt.Sprintf("server key is %s", leaf.KeyType))
+	}
+	for _, cert := range result.CertChain {
+		// A self-signature proves nothing, the trust comes from the trust store
+		if cert.SelfSigned {
+			continue
+		}
+		if !cert.PQSignature {
+			risk.ForgedAuthentication = true
+			risk.Reasons = append(risk.Reasons, fmt.Sprintf("%q is signed with %s", cert.Subject, cert.SignatureAlgorithm))
+		}
+	}
+	if risk.ForgedAuthentication {
+		raise(RiskMedium)
+	}
+	return risk
+}
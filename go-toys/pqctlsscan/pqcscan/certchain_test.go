@@ -0,0 +1,180 @@
+package pqcscan
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newPQTestCert creates a certificate with an ML-DSA-65 key signed with ML-DSA-87.
+// Neither the key nor the signature is real, only the algorithm identifiers matter.
+func newPQTestCert(t *testing.T) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "pq.example.com"},
+		Issuer:       pkix.Name{CommonName: "PQ CA"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"pq.example.com"},
+	}
+	parent := &x509.Certificate{Subject: pkix.Name{CommonName: "PQ CA"}}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	var cert struct {
+		TBS                asn1.RawValue
+		SignatureAlgorithm pkix.AlgorithmIdentifier
+		Signature          asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(der, &cert); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	var tbs struct {
+		Version            asn1.RawValue
+		SerialNumber       asn1.RawValue
+		SignatureAlgorithm pkix.AlgorithmIdentifier
+		Issuer             asn1.RawValue
+		Validity           asn1.RawValue
+		Subject            asn1.RawValue
+		PublicKey          struct {
+			Algorithm pkix.AlgorithmIdentifier
+			PublicKey asn1.BitString
+		}
+		Extensions asn1.RawValue
+	}
+	if _, err := asn1.Unmarshal(cert.TBS.FullBytes, &tbs); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	mldsa65 := asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 3, 18}
+	mldsa87 := asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 3, 19}
+	tbs.PublicKey.Algorithm = pkix.AlgorithmIdentifier{Algorithm: mldsa65}
+	tbs.PublicKey.PublicKey = asn1.BitString{Bytes: make([]byte, 1952), BitLength: 8 * 1952}
+	tbs.SignatureAlgorithm = pkix.AlgorithmIdentifier{Algorithm: mldsa87}
+	tbsDER, err := asn1.Marshal(tbs)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	cert.TBS = asn1.RawValue{FullBytes: tbsDER}
+	cert.SignatureAlgorithm = tbs.SignatureAlgorithm
+	cert.Signature = asn1.BitString{Bytes: make([]byte, 4627), BitLength: 8 * 4627}
+	der, err = asn1.Marshal(cert)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	pqCert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	return pqCert
+}
+
+func TestNewCertInfo(t *testing.T) {
+	info := newCertInfo(newPQTestCert(t))
+	assert.Equal(t, "CN=pq.example.com", info.Subject)
+	assert.Equal(t, "CN=PQ CA", info.Issuer)
+	assert.Equal(t, "ML-DSA-65", info.KeyType)
+	assert.Equal(t, 8*1952, info.KeyBits)
+	assert.Equal(t, "ML-DSA-87", info.SignatureAlgorithm)
+	assert.Equal(t, []string{"pq.example.com"}, info.DNSNames)
+	assert.True(t, info.PQKey)
+	assert.True(t, info.PQSignature)
+	assert.False(t, info.SelfSigned)
+
+	cert, err := generateSelfSignedCert()
+	if !assert.NoError(t, err) {
+		return
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if !assert.NoError(t, err) {
+		return
+	}
+	info = newCertInfo(leaf)
+	assert.Equal(t, "ECDSA", info.KeyType)
+	assert.Equal(t, 256, info.KeyBits)
+	assert.Equal(t, "ECDSA-SHA256", info.SignatureAlgorithm)
+	assert.True(t, info.SelfSigned)
+	assert.False(t, info.PQKey)
+	assert.False(t, info.PQSignature)
+
+	name, ok := pqAlgorithmName(asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 6, 45})
+	assert.True(t, ok)
+	assert.Equal(t, "MLDSA65-ECDSA-P256-SHA512", name)
+	name, ok = pqAlgorithmName(asn1.ObjectIdentifier{2, 16, 840, 1, 114027, 80, 8, 1, 28})
+	assert.True(t, ok)
+	assert.Contains(t, name, "Composite-ML-DSA")
+	_, ok = pqAlgorithmName(asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2})
+	assert.False(t, ok)
+	// Classic algorithms of the PKIX id-alg arc
+	for _, arc := range []int{30, 32} {
+		_, ok = pqAlgorithmName(asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 6, arc})
+		assert.False(t, ok, "id-alg %d", arc)
+	}
+}
+
+func TestAssessQuantumRisk(t *testing.T) {
+	pqLeaf := CertInfo{Subject: "CN=leaf", KeyType: "ML-DSA-65", SignatureAlgorithm: "ML-DSA-87", PQKey: true, PQSignature: true}
+	root := CertInfo{Subject: "CN=root", KeyType: "ECDSA", SignatureAlgorithm: "ECDSA-SHA256", SelfSigned: true}
+	classicLeaf := CertInfo{Subject: "CN=leaf", KeyType: "RSA", SignatureAlgorithm: "SHA256-RSA"}
+
+	testCases := []struct {
+		name          string
+		result        ScanResult
+		level         string
+		hndl, forgery bool
+	}{
+		{"PQ_only", ScanResult{IsPQKexSupported: true, CertChain: []CertInfo{pqLeaf, root}}, RiskLow, false, false},
+		{"PQ_and_classic_kex", ScanResult{IsPQKexSupported: true, IsNonPQKexSupported: true, CertChain: []CertInfo{pqLeaf}}, RiskMedium, true, false},
+		{"PQ_kex_classic_auth", ScanResult{IsPQKexSupported: true, CertChain: []CertInfo{classicLeaf}}, RiskMedium, false, true},
+		{"Classic_only", ScanResult{IsNonPQKexSupported: true, CertChain: []CertInfo{classicLeaf}}, RiskHigh, true, true},
+		{"No_chain", ScanResult{IsPQKexSupported: true}, RiskMedium, false, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			risk := AssessQuantumRisk(&tc.result)
+			assert.Equal(t, tc.level, risk.Level, "%v", risk.Reasons)
+			assert.Equal(t, tc.hndl, risk.HarvestNowDecryptLater, "harvest now, decrypt later")
+			assert.Equal(t, tc.forgery, risk.ForgedAuthentication, "forged authentication")
+		})
+	}
+}
+
+func TestScanPortCertChain(t *testing.T) {
+	srv := TLSServer{
+		ListenAddr:        fmt.Sprintf("%s:%d", serverHost, serverPort),
+		AllowPQCipher:     true,
+		AllowNonPQCiphers: false,
+	}
+	if err := srv.Start(t.Context()); err != nil {
+		t.Fatalf("failed to start TLS server: %+v", err)
+	}
+	defer srv.Stop()
+
+	scanner := Scanner{Timeout: time.Second, StartTLS: StartTLSAuto}
+	result := scanner.ScanTarget(t.Context(), Target{Host: serverHost, Port: serverPort})
+	assert.Equal(t, TLS, result.PortType)
+	if assert.Len(t, result.CertChain, 1) {
+		assert.Equal(t, "ECDSA", result.CertChain[0].KeyType)
+		assert.True(t, result.CertChain[0].SelfSigned)
+	}
+	if assert.NotNil(t, result.QuantumRisk) {
+		assert.Equal(t, RiskMedium, result.QuantumRisk.Level)
+		assert.False(t, result.QuantumRisk.HarvestNowDecryptLater)
+		assert.True(t, result.QuantumRisk.ForgedAuthentication)
+	}
+}
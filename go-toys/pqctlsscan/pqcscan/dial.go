@@ -0,0 +1,30 @@
+package pqcscan
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// dialContext connects like net.Dialer with the timeout. The connection is closed
+// when ctx is done, so a cancelled scan doesn't wait for the probes' deadlines.
+func dialContext(ctx context.Context, network, address string, timeout time.Duration) (net.Conn, error) {
+	d := net.Dialer{Timeout: timeout}
+	conn, err := d.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	return &ctxConn{Conn: conn, stop: stop}, nil
+}
+
+// ctxConn is a connection closed by its context, see dialContext
+type ctxConn struct {
+	net.Conn
+	stop func() bool
+}
+
+func (c *ctxConn) Close() error {
+	c.stop()
+	return c.Conn.Close()
+}
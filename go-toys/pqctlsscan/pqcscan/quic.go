@@ -0,0 +1,385 @@
+package pqcscan
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// The QUIC v1 Initial packets (RFC 9000 17.2.2), protected with keys derived from
+// the client's first Destination Connection ID (RFC 9001 5.2). That is all of QUIC
+// a scan needs: the TLS ClientHello and ServerHello travel in Initial packets.
+
+const quicVersion1 = 0x00000001
+
+// quicV1InitialSalt is the salt of the Initial secret (RFC 9001 5.2)
+var quicV1InitialSalt = []byte{
+	0x38, 0x76, 0x2c, 0xf7, 0xf5, 0x59, 0x34, 0xb3, 0x4d, 0x17,
+	0x9a, 0xe6, 0xa4, 0xc8, 0x0c, 0xad, 0xcc, 0xbb, 0x7f, 0x0a,
+}
+
+// Long header packet types (RFC 9000 17.2)
+const (
+	quicPacketInitial   = 0
+	quicPacketZeroRTT   = 1
+	quicPacketHandshake = 2
+	quicPacketRetry     = 3
+)
+
+// Frame types (RFC 9000 19)
+const (
+	quicFramePadding            = 0x00
+	quicFramePing               = 0x01
+	quicFrameAck                = 0x02
+	quicFrameAckECN             = 0x03
+	quicFrameCrypto             = 0x06
+	quicFrameConnectionClose    = 0x1c
+	quicFrameConnectionCloseApp = 0x1d
+)
+
+// quicCryptoErrorBase is the CONNECTION_CLOSE error code of TLS alert zero (RFC 9001 4.8)
+const quicCryptoErrorBase = 0x0100
+
+const (
+	quicMinInitialDatagramSize    = 1200 // Client Initial datagrams are padded to this (RFC 9000 14.1)
+	quicMaxCryptoDataPerPacket    = 1000 // Keeps the datagrams below the minimum QUIC MTU
+	quicPacketNumberLength        = 4
+	quicAEADOverhead              = 16
+	quicHeaderProtectionSampleLen = 16
+)
+
+var errMalformedQUICPacket = errors.New("malformed QUIC packet")
+
+// quicInitialKeys protect the Initial packets of one direction
+type quicInitialKeys struct {
+	aead cipher.AEAD
+	iv   []byte
+	hp   cipher.Block
+}
+
+// newQUICInitialKeys derives the Initial keys of the client or the server
+// from the Destination Connection ID of the client's first Initial packet
+func newQUICInitialKeys(dcid []byte, server bool) (*quicInitialKeys, error) {
+	initialSecret, err := hkdf.Extract(sha256.New, dcid, quicV1InitialSalt)
+	if err != nil {
+		return nil, err
+	}
+	label := "client in"
+	if server {
+		label = "server in"
+	}
+	secret, err := hkdfExpandLabel(initialSecret, label, sha256.Size)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hkdfExpandLabel(secret, "quic key", 16)
+	if err != nil {
+		return nil, err
+	}
+	iv, err := hkdfExpandLabel(secret, "quic iv", 12)
+	if err != nil {
+		return nil, err
+	}
+	hpKey, err := hkdfExpandLabel(secret, "quic hp", 16)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	hp, err := aes.NewCipher(hpKey)
+	if err != nil {
+		return nil, err
+	}
+	return &quicInitialKeys{aead: aead, iv: iv, hp: hp}, nil
+}
+
+// hkdfExpandLabel is HKDF-Expand-Label with an empty context (RFC 8446 7.1)
+func hkdfExpandLabel(secret []byte, label string, length int) ([]byte, error) {
+	label = "tls13 " + label
+	info := binary.BigEndian.AppendUint16(nil, uint16(length))
+	info = append(info, byte(len(label)))
+	info = append(info, label...)
+	info = append(info, 0)
+	return hkdf.Expand(sha256.New, secret, string(info), length)
+}
+
+func (k *quicInitialKeys) nonce(pn uint64) []byte {
+	nonce := make([]byte, len(k.iv))
+	copy(nonce, k.iv)
+	for i := range 8 {
+		nonce[len(nonce)-1-i] ^= byte(pn >> (8 * i))
+	}
+	return nonce
+}
+
+// headerProtectionMask is the AES-ECB encrypted sample of the ciphertext (RFC 9001 5.4.3)
+func (k *quicInitialKeys) headerProtectionMask(sample []byte) []byte {
+	mask := make([]byte, aes.BlockSize)
+	k.hp.Encrypt(mask, sample)
+	return mask
+}
+
+// quicInitialPacket is a decrypted Initial packet, or the header of another long header packet
+type quicInitialPacket struct {
+	Type    int
+	Version uint32
+	DCID    []byte
+	SCID    []byte
+	Token   []byte // Initial and Retry packets
+	Number  uint64
+	Payload []byte // Frames of an Initial packet
+}
+
+// sealQUICInitial builds a protected Initial packet. The payload is padded with
+// PADDING frames to minSize bytes.
+func sealQUICInitial(keys *quicInitialKeys, dcid, scid, token []byte, pn uint64, payload []byte, minSize int) []byte {
+	header := []byte{0xc0 | quicPacketInitial<<4 | (quicPacketNumberLength - 1)}
+	header = binary.BigEndian.AppendUint32(header, quicVersion1)
+	header = append(header, byte(len(dcid)))
+	header = append(header, dcid...)
+	header = append(header, byte(len(scid)))
+	header = append(header, scid...)
+	header = appendQUICVarint(header, uint64(len(token)))
+	header = append(header, token...)
+
+	// The length field is always two bytes, so the padding is known in advance
+	if padding := minSize - (len(header) + 2 + quicPacketNumberLength + len(payload) + quicAEADOverhead); padding > 0 {
+		payload = append(payload, make([]byte, padding)...)
+	}
+	header = appendQUICVarint2(header, uint64(quicPacketNumberLength+len(payload)+quicAEADOverhead))
+	pnOffset := len(header)
+	header = binary.BigEndian.AppendUint32(header, uint32(pn))
+
+	packet := keys.aead.Seal(append([]byte(nil), header...), keys.nonce(pn), payload, header)
+	sample := packet[pnOffset+4 : pnOffset+4+quicHeaderProtectionSampleLen]
+	mask := keys.headerProtectionMask(sample)
+	packet[0] ^= mask[0] & 0x0f
+	for i := range quicPacketNumberLength {
+		packet[pnOffset+i] ^= mask[1+i]
+	}
+	return packet
+}
+
+// openQUICPacket parses the first long header packet of a datagram and decrypts it if it's
+// an Initial packet. It returns the coalesced packets after it. keys may be nil, then only
+// the header is parsed.
+func openQUICPacket(keys *quicInitialKeys, datagram []byte) (*quicInitialPacket, []byte, error) {
+	if len(datagram) < 7 || datagram[0]&0x80 == 0 {
+		// Short header packets can't be decrypted without the 1-RTT keys
+		return nil, nil, errMalformedQUICPacket
+	}
+	p := &quicInitialPacket{
+		Type:    int(datagram[0]>>4) & 0x03,
+		Version: binary.BigEndian.Uint32(datagram[1:]),
+	}
+	b := datagram[5:]
+	var ok bool
+	if p.DCID, b, ok = readQUICConnID(b); !ok {
+		return nil, nil, errMalformedQUICPacket
+	}
+	if p.SCID, b, ok = readQUICConnID(b); !ok {
+		return nil, nil, errMalformedQUICPacket
+	}
+	if p.Version == 0 {
+		// Version Negotiation packet (RFC 9000 17.2.1)
+		return p, nil, nil
+	}
+	if p.Type == quicPacketRetry {
+		// Retry token followed by the integrity tag, to the end of the datagram
+		if len(b) < quicAEADOverhead {
+			return nil, nil, errMalformedQUICPacket
+		}
+		p.Token = b[:len(b)-quicAEADOverhead]
+		return p, nil, nil
+	}
+	if p.Type == quicPacketInitial {
+		tokenLen, n := readQUICVarint(b)
+		if n == 0 || uint64(len(b)-n) < tokenLen {
+			return nil, nil, errMalformedQUICPacket
+		}
+		p.Token = b[n : n+int(tokenLen)]
+		b = b[n+int(tokenLen):]
+	}
+	length, n := readQUICVarint(b)
+	if n == 0 || uint64(len(b)-n) < length {
+		return nil, nil, errMalformedQUICPacket
+	}
+	pnOffset := len(datagram) - len(b) + n
+	end := pnOffset + int(length)
+	rest := datagram[end:]
+	if p.Type != quicPacketInitial || keys == nil {
+		return p, rest, nil
+	}
+
+	// Remove the header protection on a copy
+	if int(length) < 4+quicHeaderProtectionSampleLen {
+		return nil, nil, errMalformedQUICPacket
+	}
+	packet := append([]byte(nil), datagram[:end]...)
+	mask := keys.headerProtectionMask(packet[pnOffset+4 : pnOffset+4+quicHeaderProtectionSampleLen])
+	packet[0] ^= mask[0] & 0x0f
+	pnLen := int(packet[0]&0x03) + 1
+	for i := range pnLen {
+		packet[pnOffset+i] ^= mask[1+i]
+		p.Number = p.Number<<8 | uint64(packet[pnOffset+i])
+	}
+	header := packet[:pnOffset+pnLen]
+	payload, err := keys.aead.Open(nil, keys.nonce(p.Number), packet[pnOffset+pnLen:], header)
+	if err != nil {
+		return nil, nil, fmt.Errorf("decrypting QUIC Initial packet: %w", err)
+	}
+	p.Payload = payload
+	return p, rest, nil
+}
+
+func readQUICConnID(b []byte) (id, rest []byte, ok bool) {
+	if len(b) < 1 || len(b) < 1+int(b[0]) || b[0] > 20 {
+		return nil, nil, false
+	}
+	return b[1 : 1+int(b[0])], b[1+int(b[0]):], true
+}
+
+// readQUICVarint decodes a variable-length integer (RFC 9000 16). n is zero if b is too short.
+func readQUICVarint(b []byte) (v uint64, n int) {
+	if len(b) == 0 {
+		return 0, 0
+	}
+	n = 1 << (b[0] >> 6)
+	if len(b) < n {
+		return 0, 0
+	}
+	v = uint64(b[0] & 0x3f)
+	for _, c := range b[1:n] {
+		v = v<<8 | uint64(c)
+	}
+	return v, n
+}
+
+// appendQUICVarint encodes v in the shortest form
+func appendQUICVarint(b []byte, v uint64) []byte {
+	switch {
+	case v < 1<<6:
+		return append(b, byte(v))
+	case v < 1<<14:
+		return appendQUICVarint2(b, v)
+	case v < 1<<30:
+		return binary.BigEndian.AppendUint32(b, uint32(v)|0x80000000)
+	default:
+		return binary.BigEndian.AppendUint64(b, v|0xc000000000000000)
+	}
+}
+
+// appendQUICVarint2 encodes v, below 2^14, in two bytes
+func appendQUICVarint2(b []byte, v uint64) []byte {
+	return binary.BigEndian.AppendUint16(b, uint16(v)|0x4000)
+}
+
+// appendQUICCryptoFrame appends a CRYPTO frame carrying data at the offset of the TLS stream
+func appendQUICCryptoFrame(b []byte, offset uint64, data []byte) []byte {
+	b = append(b, quicFrameCrypto)
+	b = appendQUICVarint(b, offset)
+	b = appendQUICVarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+// quicFrames are the frames of Initial packets the scan cares about
+type quicFrames struct {
+	crypto     map[uint64][]byte // Data of the CRYPTO frames by offset
+	closed     bool              // CONNECTION_CLOSE received
+	closeError uint64            // Error code of the CONNECTION_CLOSE
+	closeText  string
+}
+
+// parseQUICFrames parses the frames of an Initial packet. Only the frame types allowed
+// in Initial packets are known (RFC 9000 12.4).
+func parseQUICFrames(payload []byte, frames *quicFrames) error {
+	for len(payload) > 0 {
+		frameType := payload[0]
+		payload = payload[1:]
+		switch frameType {
+		case quicFramePadding, quicFramePing:
+		case quicFrameAck, quicFrameAckECN:
+			// Largest Acknowledged, ACK Delay, ACK Range Count, First ACK Range
+			var fields [4]uint64
+			for i := range fields {
+				v, n := readQUICVarint(payload)
+				if n == 0 {
+					return errMalformedQUICPacket
+				}
+				fields[i], payload = v, payload[n:]
+			}
+			skip := 2 * fields[2] // Gap and ACK Range Length pairs
+			if frameType == quicFrameAckECN {
+				skip += 3
+			}
+			for range skip {
+				_, n := readQUICVarint(payload)
+				if n == 0 {
+					return errMalformedQUICPacket
+				}
+				payload = payload[n:]
+			}
+		case quicFrameCrypto:
+			offset, n := readQUICVarint(payload)
+			if n == 0 {
+				return errMalformedQUICPacket
+			}
+			payload = payload[n:]
+			length, n := readQUICVarint(payload)
+			if n == 0 || uint64(len(payload)-n) < length {
+				return errMalformedQUICPacket
+			}
+			if frames.crypto == nil {
+				frames.crypto = make(map[uint64][]byte)
+			}
+			frames.crypto[offset] = payload[n : n+int(length)]
+			payload = payload[n+int(length):]
+		case quicFrameConnectionClose, quicFrameConnectionCloseApp:
+			code, n := readQUICVarint(payload)
+			if n == 0 {
+				return errMalformedQUICPacket
+			}
+			payload = payload[n:]
+			if frameType == quicFrameConnectionClose {
+				if _, n = readQUICVarint(payload); n == 0 {
+					return errMalformedQUICPacket
+				}
+				payload = payload[n:]
+			}
+			reasonLen, n := readQUICVarint(payload)
+			if n == 0 || uint64(len(payload)-n) < reasonLen {
+				return errMalformedQUICPacket
+			}
+			frames.closed = true
+			frames.closeError = code
+			frames.closeText = string(payload[n : n+int(reasonLen)])
+			payload = payload[n+int(reasonLen):]
+		default:
+			return fmt.Errorf("unexpected QUIC frame type 0x%x in Initial packet", frameType)
+		}
+	}
+	return nil
+}
+
+// cryptoStream returns the contiguous CRYPTO data from offset zero
+func (f *quicFrames) cryptoStream() []byte {
+	var stream []byte
+	for {
+		data, ok := f.crypto[uint64(len(stream))]
+		if !ok || len(data) == 0 {
+			return stream
+		}
+		stream = append(stream, data...)
+	}
+}
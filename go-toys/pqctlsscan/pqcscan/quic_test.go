@@ -0,0 +1,166 @@
+package pqcscan
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// The client Initial keys of RFC 9001 Appendix A.1
+func TestQUICInitialKeys(t *testing.T) {
+	dcid, _ := hex.DecodeString("8394c8f03e515708")
+	keys, err := newQUICInitialKeys(dcid, false)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "fa044b2f42a3fd3b46fb255c", hex.EncodeToString(keys.iv))
+	mask := keys.headerProtectionMask(mustHex("d1b1c98dd7689fb8ec11d242b123dc9b"))
+	assert.Equal(t, "437b9aec36", hex.EncodeToString(mask[:5]))
+}
+
+func mustHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestQUICPacketRoundTrip(t *testing.T) {
+	dcid, scid := []byte{1, 2, 3, 4, 5, 6, 7, 8}, []byte{9, 10}
+	clientKeys, _ := newQUICInitialKeys(dcid, false)
+	payload := appendQUICCryptoFrame(nil, 0, []byte("hello"))
+	payload = appendQUICCryptoFrame(payload, 5, []byte(" world"))
+	packet := sealQUICInitial(clientKeys, dcid, scid, []byte("tok"), 7, payload, quicMinInitialDatagramSize)
+	assert.Len(t, packet, quicMinInitialDatagramSize)
+
+	// Coalesced with a Handshake packet
+	datagram := append(packet, 0xe0, 0, 0, 0, 1, 0, 0, 0x01, 0)
+	p, rest, err := openQUICPacket(clientKeys, datagram)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, uint64(7), p.Number)
+	assert.Equal(t, dcid, p.DCID)
+	assert.Equal(t, scid, p.SCID)
+	assert.Equal(t, []byte("tok"), p.Token)
+	var frames quicFrames
+	assert.NoError(t, parseQUICFrames(p.Payload, &frames))
+	assert.Equal(t, []byte("hello world"), frames.cryptoStream())
+
+	p, rest, err = openQUICPacket(clientKeys, rest)
+	if assert.NoError(t, err) {
+		assert.Equal(t, quicPacketHandshake, p.Type)
+		assert.Empty(t, rest)
+	}
+
+	// Wrong keys
+	serverKeys, _ := newQUICInitialKeys(dcid, true)
+	_, _, err = openQUICPacket(serverKeys, packet)
+	assert.Error(t, err)
+}
+
+func TestQUICVarint(t *testing.T) {
+	for _, v := range []uint64{0, 63, 64, 16383, 16384, 1<<30 - 1, 1 << 30, 151288809941952652} {
+		b := appendQUICVarint(nil, v)
+		got, n := readQUICVarint(b)
+		assert.Equal(t, v, got)
+		assert.Equal(t, len(b), n)
+	}
+	// RFC 9000 A.1
+	v, n := readQUICVarint(mustHex("c2197c5eff14e88c"))
+	assert.Equal(t, uint64(151288809941952652), v)
+	assert.Equal(t, 8, n)
+	_, n = readQUICVarint([]byte{0x40})
+	assert.Zero(t, n)
+}
+
+func TestQUICKexAlgos(t *testing.T) {
+	testCases := []struct {
+		name              string
+		srvAllowPQCKex    bool
+		srvAllowNonPQCKex bool
+		retry             bool
+	}{
+		{"Server_nonPQC_only", false, true, false},
+		{"Server_PQC_only", true, false, false},
+		{"Server_Both_PQC_and_nonPQC", true, true, false},
+		{"Server_Both_with_Retry", true, true, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := QUICServer{
+				ListenAddr:        fmt.Sprintf("%s:%d", serverHost, serverPort),
+				AllowPQCipher:     tc.srvAllowPQCKex,
+				AllowNonPQCiphers: tc.srvAllowNonPQCKex,
+				Retry:             tc.retry,
+			}
+			if err := srv.Start(t.Context()); err != nil {
+				t.Fatalf("failed to start QUIC server: %+v", err)
+			}
+			defer srv.Stop()
+
+			result := checkQUICPort(t.Context(), serverHost, "quic.example", serverPort, time.Second)
+			assert.Empty(t, result.Error)
+			assert.Equal(t, QUIC, result.PortType)
+			assert.Equal(t, tc.srvAllowPQCKex, result.IsPQKexSupported, "PQ kex")
+			assert.Equal(t, tc.srvAllowNonPQCKex, result.IsNonPQKexSupported, "non-PQ kex")
+			if tc.srvAllowPQCKex && assert.NotNil(t, result.TLSGroups) {
+				assert.Equal(t, "X25519MLKEM768", result.TLSGroups.Supported[0])
+			}
+			assert.Equal(t, []string{"quic.example"}, srv.ServerNames())
+		})
+	}
+}
+
+func TestQUICNoResponse(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen error: %+v", err)
+	}
+	defer pc.Close()
+
+	port := pc.LocalAddr().(*net.UDPAddr).Port
+	result := checkQUICPort(t.Context(), "127.0.0.1", "", port, 200*time.Millisecond)
+	assert.Equal(t, NoConn, result.PortType)
+	assert.Equal(t, errNoQUICResponse.Error(), result.Error)
+
+	// The client pads its Initial datagrams
+	buf := make([]byte, 2048)
+	_ = pc.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if assert.NoError(t, err) {
+		assert.GreaterOrEqual(t, n, quicMinInitialDatagramSize)
+		assert.True(t, bytes.Equal(buf[1:5], []byte{0, 0, 0, 1}), "QUIC version 1")
+	}
+}
+
+func TestScannerQUIC(t *testing.T) {
+	srv := QUICServer{
+		ListenAddr:        fmt.Sprintf("%s:%d", serverHost, serverPort),
+		AllowPQCipher:     true,
+		AllowNonPQCiphers: false,
+	}
+	if err := srv.Start(t.Context()); err != nil {
+		t.Fatalf("failed to start QUIC server: %+v", err)
+	}
+	defer srv.Stop()
+
+	scanner := Scanner{Timeout: 500 * time.Millisecond, QUIC: true}
+	results, err := scanner.ScanAll(t.Context(), []Target{{Host: serverHost, Port: serverPort, Hostname: "quic.test"}})
+	assert.NoError(t, err)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, QUIC, results[0].PortType)
+		assert.Equal(t, "quic.test", results[0].Hostname)
+		assert.True(t, results[0].IsPQKexSupported)
+		if assert.NotNil(t, results[0].QuantumRisk) {
+			assert.Equal(t, RiskMedium, results[0].QuantumRisk.Level)
+		}
+	}
+}
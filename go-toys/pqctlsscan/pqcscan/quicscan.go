@@ -0,0 +1,244 @@
+package pqcscan
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// QUIC is a UDP port answering a QUIC v1 handshake, usually HTTP/3
+const QUIC = PortType("QUIC")
+
+// quicALPN is offered in the ClientHello, QUIC servers reject handshakes without ALPN
+var quicALPN = []string{"h3"}
+
+// errNoQUICResponse means the UDP port stayed silent. UDP can't tell a closed port from a filtered one.
+var errNoQUICResponse = errors.New("no QUIC response")
+
+// maxQUICRetries limits the Retry packets followed in a handshake
+const maxQUICRetries = 2
+
+// checkQUICPort probes the key exchanges of a QUIC port, like checkTLSPort does over TCP.
+// serverName is sent in the SNI extension, if not empty.
+func checkQUICPort(ctx context.Context, host, serverName string, port int, timeout time.Duration) (result ScanResult) {
+	result.Address = host
+	result.Port = port
+	result.PortType = QUIC
+	now := time.Now()
+	defer func() {
+		result.TestDuration = time.Since(now)
+	}()
+
+	nonPQ, err := checkQUICPortOnce(ctx, host, serverName, port, false, true, timeout)
+	if err != nil {
+		if isNetworkError(err) || errors.Is(err, errNoQUICResponse) {
+			result.PortType = NoConn
+		}
+		result.Error = err.Error()
+		return
+	}
+	pq, err := checkQUICPortOnce(ctx, host, serverName, port, true, false, timeout)
+	if err != nil {
+		result.Error = err.Error()
+		return
+	}
+
+	result.IsNonPQKexSupported = !nonPQ.rejected
+	result.IsPQKexSupported = !pq.rejected
+	var supported []string
+	for _, reply := range []*serverHelloReply{pq, nonPQ} {
+		if !reply.rejected {
+			supported = append(supported, curveName(reply.group))
+		}
+	}
+	if len(supported) > 0 {
+		result.TLSGroups = &TLSGroupInfo{TLS13: true, Supported: supported}
+	}
+	return
+}
+
+// checkQUICPortOnce sends a QUIC Initial with a ClientHello restricted to the groups
+// of selectCurves, and reads the ServerHello from the server's Initial packets.
+// The reply is rejected if the server closes the connection, or selects a group not offered.
+func checkQUICPortOnce(ctx context.Context, host, serverName string, port int, allowPQCKex bool, allowNonPQCKex bool, timeout time.Duration) (*serverHelloReply, error) {
+	curves, err := selectCurves(allowPQCKex, allowNonPQCKex)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: true,
+		MinVersion:         tls.VersionTLS13,
+		NextProtos:         quicALPN,
+		CurvePreferences:   curves,
+		ServerName:         serverName,
+	}
+
+	conn, err := dialContext(ctx, "udp", net.JoinHostPort(host, strconv.Itoa(port)), timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+
+	dcid, scid := make([]byte, 8), make([]byte, 8)
+	_, _ = rand.Read(dcid)
+	_, _ = rand.Read(scid)
+
+	qc := tls.QUICClient(&tls.QUICConfig{TLSConfig: tlsConfig})
+	defer qc.Close()
+	qc.SetTransportParameters(marshalQUICTransportParameters(scid, nil))
+	if err := qc.Start(ctx); err != nil {
+		return nil, err
+	}
+	var clientHello []byte
+	for e := qc.NextEvent(); e.Kind != tls.QUICNoEvent; e = qc.NextEvent() {
+		if e.Kind == tls.QUICWriteData && e.Level == tls.QUICEncryptionLevelInitial {
+			clientHello = append(clientHello, e.Data...)
+		}
+	}
+
+	var token []byte
+	var pn uint64
+	for range maxQUICRetries + 1 {
+		clientKeys, err := newQUICInitialKeys(dcid, false)
+		if err != nil {
+			return nil, err
+		}
+		serverKeys, err := newQUICInitialKeys(dcid, true)
+		if err != nil {
+			return nil, err
+		}
+		for offset := 0; offset < len(clientHello); offset += quicMaxCryptoDataPerPacket {
+			chunk := clientHello[offset:min(offset+quicMaxCryptoDataPerPacket, len(clientHello))]
+			payload := appendQUICCryptoFrame(nil, uint64(offset), chunk)
+			if _, err := conn.Write(sealQUICInitial(clientKeys, dcid, scid, token, pn, payload, quicMinInitialDatagramSize)); err != nil {
+				return nil, err
+			}
+			pn++
+		}
+
+		reply, retry, err := readQUICServerHello(conn, serverKeys, scid)
+		if err != nil {
+			return nil, err
+		}
+		if retry == nil {
+			if !reply.rejected && !slices.Contains(curves, reply.group) {
+				reply.rejected = true
+			}
+			return reply, nil
+		}
+		// The handshake restarts with the Destination Connection ID chosen by the server
+		dcid, token = retry.SCID, retry.Token
+	}
+	return nil, errors.New("too many QUIC Retry packets")
+}
+
+// readQUICServerHello reads datagrams until the ServerHello is complete in the CRYPTO
+// stream of the server's Initial packets. A Retry packet is returned instead of a reply.
+func readQUICServerHello(conn net.Conn, keys *quicInitialKeys, scid []byte) (*serverHelloReply, *quicInitialPacket, error) {
+	var frames quicFrames
+	buf := make([]byte, 65536)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return nil, nil, errNoQUICResponse
+			}
+			return nil, nil, err
+		}
+
+		datagram := buf[:n]
+		for len(datagram) > 0 {
+			packet, rest, err := openQUICPacket(keys, datagram)
+			if err != nil {
+				// Short header packets and garbage end the datagram
+				break
+			}
+			datagram = rest
+			switch {
+			case packet.Version == 0:
+				return nil, nil, errors.New("server doesn't support QUIC version 1")
+			case packet.Type == quicPacketRetry:
+				return nil, packet, nil
+			case packet.Type != quicPacketInitial:
+				continue
+			}
+			if err := parseQUICFrames(packet.Payload, &frames); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		if msg, ok := completeHandshakeMessage(frames.cryptoStream()); ok {
+			if msg[0] != 2 { // server_hello
+				return nil, nil, errMalformedServerHello
+			}
+			reply, err := parseServerHello(msg[4:])
+			return reply, nil, err
+		}
+		if frames.closed {
+			if frames.closeError < quicCryptoErrorBase || frames.closeError > quicCryptoErrorBase+0xff {
+				return nil, nil, fmt.Errorf("QUIC connection closed with error 0x%x: %s", frames.closeError, frames.closeText)
+			}
+			// A TLS alert, like handshake_failure for no common group
+			return &serverHelloReply{rejected: true, tls13: true}, nil, nil
+		}
+	}
+}
+
+// completeHandshakeMessage returns the first TLS handshake message of the stream, if it's complete
+func completeHandshakeMessage(stream []byte) ([]byte, bool) {
+	if len(stream) < 4 {
+		return nil, false
+	}
+	length := int(stream[1])<<16 | int(stream[2])<<8 | int(stream[3])
+	if len(stream) < 4+length {
+		return nil, false
+	}
+	return stream[:4+length], true
+}
+
+// QUIC transport parameter IDs (RFC 9000 18.2)
+const (
+	quicParamOriginalDestinationConnectionID = 0x00
+	quicParamMaxIdleTimeout                  = 0x01
+	quicParamInitialMaxData                  = 0x04
+	quicParamInitialMaxStreamDataBidiLocal   = 0x05
+	quicParamInitialMaxStreamDataBidiRemote  = 0x06
+	quicParamInitialMaxStreamDataUni         = 0x07
+	quicParamInitialMaxStreamsBidi           = 0x08
+	quicParamInitialMaxStreamsUni            = 0x09
+	quicParamInitialSourceConnectionID       = 0x0f
+)
+
+// marshalQUICTransportParameters encodes the transport parameters of a plain HTTP/3 endpoint.
+// originalDCID is only sent by servers.
+func marshalQUICTransportParameters(scid, originalDCID []byte) []byte {
+	var params []byte
+	appendParam := func(id uint64, value []byte) {
+		params = appendQUICVarint(params, id)
+		params = appendQUICVarint(params, uint64(len(value)))
+		params = append(params, value...)
+	}
+	appendIntParam := func(id, value uint64) {
+		appendParam(id, appendQUICVarint(nil, value))
+	}
+	if originalDCID != nil {
+		appendParam(quicParamOriginalDestinationConnectionID, originalDCID)
+	}
+	appendIntParam(quicParamMaxIdleTimeout, 30000)
+	appendIntParam(quicParamInitialMaxData, 1<<20)
+	appendIntParam(quicParamInitialMaxStreamDataBidiLocal, 1<<18)
+	appendIntParam(quicParamInitialMaxStreamDataBidiRemote, 1<<18)
+	appendIntParam(quicParamInitialMaxStreamDataUni, 1<<18)
+	appendIntParam(quicParamInitialMaxStreamsBidi, 100)
+	appendIntParam(quicParamInitialMaxStreamsUni, 100)
+	appendParam(quicParamInitialSourceConnectionID, scid)
+	return params
+}
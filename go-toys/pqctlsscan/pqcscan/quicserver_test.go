@@ -0,0 +1,194 @@
+package pqcscan
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"sync"
+)
+
+// QUICServer answers QUIC Initial packets with the ServerHello of a real crypto/tls
+// handshake. It never gets further than the Initial packets, that's enough for the scan.
+type QUICServer struct {
+	ListenAddr        string
+	AllowPQCipher     bool
+	AllowNonPQCiphers bool
+	Retry             bool // Send a Retry packet first, like servers validating the client address
+	pc                net.PacketConn
+	serveCh           chan struct{}
+	mu                sync.Mutex
+	conns             map[string]*quicServerConn
+	serverNames       []string // SNI of the ClientHellos, without duplicates
+}
+
+// quicServerConn is the state of a client, by its address
+type quicServerConn struct {
+	originalDCID []byte
+	dcid         []byte // Initial keys are derived from this
+	clientSCID   []byte
+	scid         []byte
+	retried      bool
+	frames       quicFrames
+	handled      int
+	tls          *tls.QUICConn
+	pn           uint64
+	closed       bool
+}
+
+func (s *QUICServer) Start(ctx context.Context) error {
+	tlsServer := TLSServer{AllowPQCipher: s.AllowPQCipher, AllowNonPQCiphers: s.AllowNonPQCiphers}
+	curves, err := tlsServer.selectCurves()
+	if err != nil {
+		return err
+	}
+	cert, err := generateSelfSignedCert()
+	if err != nil {
+		return fmt.Errorf("failed to generate self-signed cert: %w", err)
+	}
+	tlsCfg := &tls.Config{
+		MinVersion:       tls.VersionTLS13,
+		Certificates:     []tls.Certificate{cert},
+		CurvePreferences: curves,
+		NextProtos:       quicALPN,
+		// Called from handleDatagram, with mu held
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			if !slices.Contains(s.serverNames, hello.ServerName) {
+				s.serverNames = append(s.serverNames, hello.ServerName)
+			}
+			return nil, nil
+		},
+	}
+
+	pc, err := net.ListenPacket("udp", s.ListenAddr)
+	if err != nil {
+		return fmt.Errorf("listen error: %w", err)
+	}
+	s.pc = pc
+	s.conns = make(map[string]*quicServerConn)
+	s.serveCh = make(chan struct{})
+
+	go func() {
+		<-ctx.Done()
+		_ = pc.Close()
+	}()
+	go func() {
+		defer close(s.serveCh)
+		buf := make([]byte, 65536)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			s.handleDatagram(tlsCfg, addr, buf[:n])
+		}
+	}()
+	return nil
+}
+
+// ServerNames returns the SNI of the ClientHellos received, without duplicates
+func (s *QUICServer) ServerNames() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.serverNames)
+}
+
+func (s *QUICServer) Stop() {
+	if s.pc != nil {
+		_ = s.pc.Close()
+	}
+	if s.serveCh != nil {
+		<-s.serveCh
+	}
+}
+
+func (s *QUICServer) handleDatagram(tlsCfg *tls.Config, addr net.Addr, datagram []byte) {
+	header, _, err := openQUICPacket(nil, datagram)
+	if err != nil || header.Type != quicPacketInitial {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.conns[addr.String()]
+	if !ok {
+		c = &quicServerConn{originalDCID: header.DCID, dcid: header.DCID, clientSCID: header.SCID, scid: make([]byte, 8)}
+		_, _ = rand.Read(c.scid)
+		s.conns[addr.String()] = c
+		if s.Retry {
+			// The Retry integrity tag isn't checked by the scanner, zeros will do
+			retry := []byte{0xc0 | quicPacketRetry<<4, 0, 0, 0, 1}
+			retry = append(retry, byte(len(c.clientSCID)))
+			retry = append(retry, c.clientSCID...)
+			retry = append(retry, byte(len(c.scid)))
+			retry = append(retry, c.scid...)
+			retry = append(retry, "retry-token"...)
+			retry = append(retry, make([]byte, quicAEADOverhead)...)
+			_, _ = s.pc.WriteTo(retry, addr)
+			c.dcid = c.scid
+			c.retried = true
+			return
+		}
+	}
+	if c.closed || (c.retried && string(header.Token) != "retry-token") {
+		return
+	}
+
+	clientKeys, err := newQUICInitialKeys(c.dcid, false)
+	if err != nil {
+		return
+	}
+	packet, _, err := openQUICPacket(clientKeys, datagram)
+	if err != nil {
+		return
+	}
+	if err := parseQUICFrames(packet.Payload, &c.frames); err != nil {
+		return
+	}
+
+	if c.tls == nil {
+		c.tls = tls.QUICServer(&tls.QUICConfig{TLSConfig: tlsCfg})
+		c.tls.SetTransportParameters(marshalQUICTransportParameters(c.scid, c.originalDCID))
+		if err := c.tls.Start(context.Background()); err != nil {
+			return
+		}
+	}
+	stream := c.frames.cryptoStream()
+	if len(stream) == c.handled {
+		return
+	}
+	err = c.tls.HandleData(tls.QUICEncryptionLevelInitial, stream[c.handled:])
+	c.handled = len(stream)
+
+	var serverHello []byte
+	for e := c.tls.NextEvent(); e.Kind != tls.QUICNoEvent; e = c.tls.NextEvent() {
+		if e.Kind == tls.QUICWriteData && e.Level == tls.QUICEncryptionLevelInitial {
+			serverHello = append(serverHello, e.Data...)
+		}
+	}
+
+	serverKeys, keyErr := newQUICInitialKeys(c.dcid, true)
+	if keyErr != nil {
+		return
+	}
+	var alert tls.AlertError
+	if errors.As(err, &alert) {
+		c.closed = true
+		payload := []byte{quicFrameConnectionClose}
+		payload = appendQUICVarint(payload, quicCryptoErrorBase+uint64(alert))
+		payload = appendQUICVarint(payload, quicFrameCrypto)
+		payload = appendQUICVarint(payload, 0)
+		_, _ = s.pc.WriteTo(sealQUICInitial(serverKeys, c.clientSCID, c.scid, nil, c.pn, payload, 0), addr)
+		c.pn++
+		return
+	}
+	for offset := 0; offset < len(serverHello); offset += quicMaxCryptoDataPerPacket {
+		chunk := serverHello[offset:min(offset+quicMaxCryptoDataPerPacket, len(serverHello))]
+		payload := appendQUICCryptoFrame(nil, uint64(offset), chunk)
+		_, _ = s.pc.WriteTo(sealQUICInitial(serverKeys, c.clientSCID, c.scid, nil, c.pn, payload, 0), addr)
+		c.pn++
+	}
+}
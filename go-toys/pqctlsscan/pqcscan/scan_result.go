@@ -1,4 +1,4 @@
-package main
+package pqcscan
 
 import (
 	"context"
@@ -17,14 +17,20 @@ const NoConn = PortType("NoConn")
 
 type ScanResult struct {
 	Address             string        `json:"address"`
+	Hostname            string        `json:"hostname,omitempty"`
 	Port                int           `json:"port"`
 	PortType            PortType      `json:"portType"`
+	StartTLS            string        `json:"starttls,omitempty"` // Protocol of the STARTTLS upgrade, if TLS wasn't implicit
 	IsPQKexSupported    bool          `json:"isPQKexSupported"`
 	IsNonPQKexSupported bool          `json:"isNonPQKexSupported"`
 	Error               string        `json:"error,omitempty"`
 	TestDuration        time.Duration `json:"testDuration"`
 
-	ServerCertKeyAlgo string `json:"serverCertKeyAlgo"`
+	ServerCertKeyAlgo string        `json:"serverCertKeyAlgo"`
+	TLSGroups         *TLSGroupInfo `json:"tlsGroups,omitempty"`
+	SSH               *SSHInfo      `json:"ssh,omitempty"`
+	CertChain         []CertInfo    `json:"certChain,omitempty"` // Presented by the server, leaf first
+	QuantumRisk       *QuantumRisk  `json:"quantumRisk,omitempty"`
 }
 
 func isNetworkError(err error) bool {
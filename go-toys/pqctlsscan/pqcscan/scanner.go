@@ -0,0 +1,320 @@
+// Package pqcscan scans TLS and SSH endpoints for post-quantum key exchange support,
+// and assesses their certificate chains and quantum risk.
+//
+// A Scanner sniffs the protocol of every target port, then runs its probes on it.
+// Results can be streamed with Scan or ScanFunc, or collected with ScanAll.
+package pqcscan
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Scanner defaults
+const (
+	DefaultTimeout     = time.Second
+	DefaultConcurrency = 100
+)
+
+// Scanner scans targets concurrently. The zero value is ready to use with the defaults.
+// The fields must not be changed while a scan is running.
+type Scanner struct {
+	Timeout     time.Duration // Timeout of a single connection. Defaults to DefaultTimeout.
+	Concurrency int           // Number of targets scanned at the same time. Defaults to DefaultConcurrency.
+	RatePerHost float64       // Maximum number of new scans per second on a single host. Zero means unlimited.
+	StartTLS    string        // STARTTLS mode: StartTLSAuto (the default), StartTLSNone or a protocol name
+	QUIC        bool          // Also probe the UDP port of every target with a QUIC handshake
+
+	// Probes examine the endpoints after their protocol is sniffed. The first probe
+	// applying to an endpoint makes its result. Defaults to DefaultProbes.
+	Probes []Probe
+
+	// IncludeClosed also reports targets that couldn't be connected, or whose probe failed
+	IncludeClosed bool
+
+	// Progress is called after every target, from a single goroutine
+	Progress func(Progress)
+}
+
+// Progress is the state of a running scan
+type Progress struct {
+	Total   int           // Number of targets, twice with QUIC
+	Done    int           // Number of scanned targets
+	Open    int           // Number of open ports found
+	Elapsed time.Duration // Since the scan started
+}
+
+// Endpoint is a target whose protocol was sniffed, passed to the probes
+type Endpoint struct {
+	Target
+	PortType PortType      // Sniffed protocol: TLS, SSH or Other
+	Timeout  time.Duration // Timeout of a single connection
+	StartTLS string        // STARTTLS mode of the Scanner
+}
+
+// Probe examines an endpoint
+type Probe interface {
+	// Probe returns false if the probe doesn't apply to the endpoint
+	Probe(ctx context.Context, ep Endpoint) (ScanResult, bool)
+}
+
+// ProbeFunc adapts a function to the Probe interface
+type ProbeFunc func(ctx context.Context, ep Endpoint) (ScanResult, bool)
+
+func (f ProbeFunc) Probe(ctx context.Context, ep Endpoint) (ScanResult, bool) {
+	return f(ctx, ep)
+}
+
+// DefaultProbes are the TLS, SSH and STARTTLS probes
+func DefaultProbes() []Probe {
+	return []Probe{ProbeFunc(probeTLS), ProbeFunc(probeSSH), ProbeFunc(probeStartTLS)}
+}
+
+// probeTLS checks implicit TLS ports
+func probeTLS(ctx context.Context, ep Endpoint) (ScanResult, bool) {
+	if ep.PortType != TLS {
+		return ScanResult{}, false
+	}
+	result := checkTLSPort(ctx, ep.Host, ep.ServerName(), ep.Port, "", ep.Timeout)
+	if result.PortType == TLS {
+		result.QuantumRisk = AssessQuantumRisk(&result)
+	}
+	return result, true
+}
+
+// probeSSH checks SSH ports
+func probeSSH(ctx context.Context, ep Endpoint) (ScanResult, bool) {
+	if ep.PortType != SSH {
+		return ScanResult{}, false
+	}
+	result := checkSSHPortResult(ctx, ep.Host, ep.Port, ep.Timeout)
+	if result.PortType == SSH && result.Error == "" {
+		result.QuantumRisk = AssessQuantumRisk(&result)
+	}
+	return result, true
+}
+
+// probeStartTLS checks plaintext ports with the STARTTLS protocol selected by the mode
+func probeStartTLS(ctx context.Context, ep Endpoint) (ScanResult, bool) {
+	if ep.PortType != Other {
+		return ScanResult{}, false
+	}
+	starttls := starttlsProtocolFor(ep.Port, ep.StartTLS)
+	if starttls == "" {
+		return ScanResult{}, false
+	}
+	result := checkTLSPort(ctx, ep.Host, ep.ServerName(), ep.Port, starttls, ep.Timeout)
+	if result.PortType != TLS {
+		return ScanResult{}, false
+	}
+	result.StartTLS = starttls
+	result.QuantumRisk = AssessQuantumRisk(&result)
+	return result, true
+}
+
+func (s *Scanner) timeout() time.Duration {
+	if s.Timeout <= 0 {
+		return DefaultTimeout
+	}
+	return s.Timeout
+}
+
+func (s *Scanner) concurrency() int {
+	if s.Concurrency <= 0 {
+		return DefaultConcurrency
+	}
+	return s.Concurrency
+}
+
+func (s *Scanner) probes() []Probe {
+	if s.Probes == nil {
+		return DefaultProbes()
+	}
+	return s.Probes
+}
+
+// ScanTarget sniffs the protocol of a single target and runs the probes on it
+func (s *Scanner) ScanTarget(ctx context.Context, target Target) ScanResult {
+	result := s.scanTarget(ctx, target, s.probes())
+	result.Hostname = target.Hostname
+	return result
+}
+
+func (s *Scanner) scanTarget(ctx context.Context, target Target, probes []Probe) ScanResult {
+	now := time.Now()
+	timeout := s.timeout()
+	portType, err := sniffPort(ctx, target.Host, target.Port, timeout)
+	if err != nil {
+		return ScanResult{Address: target.Host, Port: target.Port, PortType: NoConn, Error: err.Error(), TestDuration: time.Since(now)}
+	}
+	ep := Endpoint{Target: target, PortType: portType, Timeout: timeout, StartTLS: s.StartTLS}
+	for _, probe := range probes {
+		if result, ok := probe.Probe(ctx, ep); ok {
+			return result
+		}
+	}
+	return ScanResult{Address: target.Host, Port: target.Port, PortType: portType, TestDuration: time.Since(now)}
+}
+
+// ScanQUIC probes the UDP port of a single target with a QUIC handshake
+func (s *Scanner) ScanQUIC(ctx context.Context, target Target) ScanResult {
+	result := checkQUICPort(ctx, target.Host, target.ServerName(), target.Port, s.timeout())
+	if result.PortType == QUIC && result.Error == "" {
+		result.QuantumRisk = AssessQuantumRisk(&result)
+	}
+	result.Hostname = target.Hostname
+	return result
+}
+
+// scanJob is a target to scan over TCP, or over UDP with QUIC
+type scanJob struct {
+	target Target
+	quic   bool
+}
+
+// jobsByHost groups the jobs by host, in the order of the first job of every host
+func jobsByHost(jobs []scanJob) [][]scanJob {
+	index := make(map[string]int)
+	var groups [][]scanJob
+	for _, job := range jobs {
+		i, ok := index[job.target.Host]
+		if !ok {
+			i = len(groups)
+			index[job.target.Host] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], job)
+	}
+	return groups
+}
+
+// Scan scans the targets and streams the results. The channel is closed when all
+// targets are done, or after ctx is done. The connections of the targets being
+// probed are closed when ctx is done.
+func (s *Scanner) Scan(ctx context.Context, targets []Target) <-chan ScanResult {
+	out := make(chan ScanResult)
+	go func() {
+		defer close(out)
+		_ = s.ScanFunc(ctx, targets, func(result ScanResult) {
+			select {
+			case out <- result:
+			case <-ctx.Done():
+			}
+		})
+	}()
+	return out
+}
+
+// ScanFunc scans the targets and calls fn with every result, from a single goroutine.
+// It returns when all targets are done, or with the error of ctx when ctx is done.
+func (s *Scanner) ScanFunc(ctx context.Context, targets []Target, fn func(ScanResult)) error {
+	start := time.Now()
+	probes := s.probes()
+	limiter := newHostRateLimiter(s.RatePerHost)
+	results := make(chan ScanResult)
+	semaphore := make(chan struct{}, s.concurrency())
+
+	jobs := make([]scanJob, 0, len(targets))
+	for _, target := range targets {
+		jobs = append(jobs, scanJob{target: target})
+		if s.QUIC {
+			jobs = append(jobs, scanJob{target: target, quic: true})
+		}
+	}
+
+	var wg sync.WaitGroup
+	// dispatch starts the job when a slot is free. It returns false when ctx is done.
+	dispatch := func(job scanJob) bool {
+		select {
+		case semaphore <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+		wg.Add(1)
+		go func(job scanJob) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			if job.quic {
+				results <- s.ScanQUIC(ctx, job.target)
+				return
+			}
+			result := s.scanTarget(ctx, job.target, probes)
+			result.Hostname = job.target.Hostname
+			results <- result
+		}(job)
+		return true
+	}
+
+	go func() {
+		defer close(results)
+		if limiter.limited() {
+			// Every host waits for its turns separately, so a rate limited host doesn't hold up the others
+			var hosts sync.WaitGroup
+			for _, hostJobs := range jobsByHost(jobs) {
+				hosts.Add(1)
+				go func(hostJobs []scanJob) {
+					defer hosts.Done()
+					for _, job := range hostJobs {
+						// Wait for the host's turn before taking a slot
+						if err := limiter.wait(ctx, job.target.Host); err != nil || !dispatch(job) {
+							return
+						}
+					}
+				}(hostJobs)
+			}
+			hosts.Wait()
+		} else {
+			for _, job := range jobs {
+				if !dispatch(job) {
+					break
+				}
+			}
+		}
+		wg.Wait()
+	}()
+
+	progress := Progress{Total: len(jobs)}
+	for result := range results {
+		progress.Done++
+		open := result.Error == ""
+		if open {
+			progress.Open++
+		}
+		if open || s.IncludeClosed {
+			fn(result)
+		}
+		if s.Progress != nil {
+			progress.Elapsed = time.Since(start)
+			s.Progress(progress)
+		}
+	}
+	return ctx.Err()
+}
+
+// ScanAll scans the targets and returns the results sorted by address and port, TCP first.
+// If ctx is done, the results so far are returned with the error of ctx.
+func (s *Scanner) ScanAll(ctx context.Context, targets []Target) ([]ScanResult, error) {
+	var results []ScanResult
+	err := s.ScanFunc(ctx, targets, func(result ScanResult) {
+		results = append(results, result)
+	})
+	SortResults(results)
+	return results, err
+}
+
+// SortResults sorts the results by address and port, a QUIC result after the TCP one
+func SortResults(results []ScanResult) {
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Address != results[j].Address {
+			return results[i].Address < results[j].Address
+		}
+		if results[i].Port != results[j].Port {
+			return results[i].Port < results[j].Port
+		}
+		return results[i].PortType != QUIC && results[j].PortType == QUIC
+	})
+}
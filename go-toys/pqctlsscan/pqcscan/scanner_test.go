@@ -0,0 +1,140 @@
+package pqcscan
+
+import (
+	"context"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// bannerServer accepts connections and greets them like a plaintext protocol
+func bannerServer(t *testing.T) int {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %+v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			_, _ = conn.Write([]byte("220 hello\r\n"))
+			conn.Close()
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+// closedPort returns a port with no listener
+func closedPort(t *testing.T) int {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %+v", err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+	return port
+}
+
+// bannerProbe marks the plaintext ports, to tell its results apart
+var bannerProbe = ProbeFunc(func(ctx context.Context, ep Endpoint) (ScanResult, bool) {
+	if ep.PortType != Other {
+		return ScanResult{}, false
+	}
+	return ScanResult{Address: ep.Host, Port: ep.Port, PortType: ep.PortType, StartTLS: "custom"}, true
+})
+
+func TestScannerCustomProbe(t *testing.T) {
+	port := bannerServer(t)
+	scanner := Scanner{Timeout: time.Second, Probes: []Probe{bannerProbe}}
+	result := scanner.ScanTarget(t.Context(), Target{Host: "127.0.0.1", Port: port, Hostname: "localhost"})
+	assert.Equal(t, Other, result.PortType)
+	assert.Equal(t, "custom", result.StartTLS)
+	assert.Equal(t, "localhost", result.Hostname)
+
+	// No probe applies
+	scanner.Probes = []Probe{}
+	result = scanner.ScanTarget(t.Context(), Target{Host: "127.0.0.1", Port: port})
+	assert.Equal(t, Other, result.PortType)
+	assert.Empty(t, result.StartTLS)
+	assert.Empty(t, result.Error)
+}
+
+func TestScannerStreamAndProgress(t *testing.T) {
+	open, closed := bannerServer(t), closedPort(t)
+	targets := []Target{{Host: "127.0.0.1", Port: open}, {Host: "127.0.0.1", Port: closed}, {Host: "127.0.0.1", Port: open}}
+
+	var progress []Progress
+	scanner := Scanner{Timeout: time.Second, Concurrency: 2, Probes: []Probe{}, Progress: func(p Progress) {
+		progress = append(progress, p)
+	}}
+	var results []ScanResult
+	for result := range scanner.Scan(t.Context(), targets) {
+		results = append(results, result)
+	}
+	assert.Len(t, results, 2)
+	if assert.Len(t, progress, 3) {
+		last := progress[2]
+		assert.Equal(t, 3, last.Total)
+		assert.Equal(t, 3, last.Done)
+		assert.Equal(t, 2, last.Open)
+		assert.Positive(t, last.Elapsed)
+	}
+
+	scanner.IncludeClosed = true
+	scanner.Progress = nil
+	results, err := scanner.ScanAll(t.Context(), targets)
+	assert.NoError(t, err)
+	if assert.Len(t, results, 3) {
+		i := slices.IndexFunc(results, func(r ScanResult) bool { return r.Port == closed })
+		assert.Equal(t, NoConn, results[i].PortType)
+		assert.NotEmpty(t, results[i].Error)
+	}
+}
+
+func TestScannerRatePerHostDoesNotBlockOtherHosts(t *testing.T) {
+	port := bannerServer(t)
+	var targets []Target
+	for range 10 {
+		targets = append(targets, Target{Host: "127.0.0.1", Port: port})
+	}
+	// Another host name of the same server has its own rate limit
+	targets = append(targets, Target{Host: "localhost", Port: port})
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	scanner := Scanner{Timeout: time.Second, RatePerHost: 2, Probes: []Probe{}}
+	var hosts []string
+	_ = scanner.ScanFunc(ctx, targets, func(result ScanResult) {
+		hosts = append(hosts, result.Address)
+		if result.Address == "localhost" {
+			cancel()
+		}
+	})
+	assert.Contains(t, hosts, "localhost")
+	assert.Less(t, len(hosts), 4, "%v", hosts)
+}
+
+func TestScannerCancel(t *testing.T) {
+	port := bannerServer(t)
+	var targets []Target
+	for range 20 {
+		targets = append(targets, Target{Host: "127.0.0.1", Port: port})
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	scanner := Scanner{Timeout: time.Second, Concurrency: 1, RatePerHost: 10, Probes: []Probe{}}
+	var n int
+	err := scanner.ScanFunc(ctx, targets, func(ScanResult) {
+		if n++; n == 2 {
+			cancel()
+		}
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, n, len(targets))
+}
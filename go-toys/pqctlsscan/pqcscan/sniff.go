@@ -0,0 +1,80 @@
+package pqcscan
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"strconv"
+	"time"
+)
+
+// sniffBannerWait is the longest time to wait for a server-first banner, like the SSH identification string
+const sniffBannerWait = 300 * time.Millisecond
+
+// sniffPort detects the protocol of a TCP port.
+// It first waits for a banner sent by the server. An SSH identification string means SSH,
+// any other banner means a plaintext protocol. If the server stays silent, a TLS ClientHello
+// is sent, and an answer in TLS record format means TLS.
+// A network error is returned if the port can't be connected.
+func sniffPort(ctx context.Context, host string, port int, timeout time.Duration) (PortType, error) {
+	conn, err := dialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(port)), timeout)
+	if err != nil {
+		return NoConn, err
+	}
+	defer conn.Close()
+
+	// Server-first protocols
+	bannerWait := sniffBannerWait
+	if timeout < bannerWait {
+		bannerWait = timeout
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(bannerWait))
+	banner := make([]byte, 4)
+	n, err := conn.Read(banner)
+	if n > 0 {
+		// A short read may hold only the beginning of the identification string
+		if bytes.HasPrefix([]byte("SSH-"), banner[:n]) {
+			return SSH, nil
+		}
+		return Other, nil
+	}
+	var netErr net.Error
+	if err != nil && !(errors.As(err, &netErr) && netErr.Timeout()) {
+		// Closed without a word
+		return Other, nil
+	}
+
+	// Client-first protocols
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+	sc := &sniffConn{Conn: conn}
+	_ = tls.Client(sc, &tls.Config{InsecureSkipVerify: true}).Handshake()
+	if isTLSRecordHeader(sc.first) {
+		return TLS, nil
+	}
+	return Other, nil
+}
+
+// isTLSRecordHeader reports whether the bytes start a TLS handshake or alert record (RFC 8446 5.1)
+func isTLSRecordHeader(b []byte) bool {
+	if len(b) < 3 {
+		return false
+	}
+	const recordTypeAlert, recordTypeHandshake = 0x15, 0x16
+	return (b[0] == recordTypeAlert || b[0] == recordTypeHandshake) && b[1] == 0x03
+}
+
+// sniffConn records the first bytes received
+type sniffConn struct {
+	net.Conn
+	first []byte
+}
+
+func (c *sniffConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if missing := 3 - len(c.first); missing > 0 && n > 0 {
+		c.first = append(c.first, b[:min(n, missing)]...)
+	}
+	return n, err
+}
@@ -0,0 +1,127 @@
+package pqcscan
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSniffPort(t *testing.T) {
+	sshSrv := SSHServer{
+		ListenAddr:      fmt.Sprintf("%s:%d", serverHost, serverPort),
+		AllowedUser:     "username",
+		AllowedPassword: "Passw0rd",
+		AllowPQCKex:     true,
+		AllowNonPQCKex:  true,
+	}
+	if err := sshSrv.Start(t.Context()); err != nil {
+		t.Fatalf("failed to start SSH server: %+v", err)
+	}
+	defer sshSrv.Stop()
+
+	tlsSrv := TLSServer{
+		ListenAddr:        fmt.Sprintf("%s:%d", serverHost, serverPort+2),
+		AllowPQCipher:     true,
+		AllowNonPQCiphers: false,
+		MutualTLSRequired: true,
+	}
+	if err := tlsSrv.Start(t.Context()); err != nil {
+		t.Fatalf("failed to start TLS server: %+v", err)
+	}
+	defer tlsSrv.Stop()
+
+	httpSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("world"))
+	}))
+	defer httpSrv.Close()
+	httpAddr := httpSrv.Listener.Addr().(*net.TCPAddr)
+
+	portType, err := sniffPort(t.Context(), serverHost, serverPort, time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, SSH, portType)
+
+	// Even a server requiring a client certificate answers the ClientHello
+	portType, err = sniffPort(t.Context(), serverHost, serverPort+2, time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, TLS, portType)
+
+	portType, err = sniffPort(t.Context(), httpAddr.IP.String(), httpAddr.Port, time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, Other, portType)
+
+	_, err = sniffPort(t.Context(), serverHost, serverPort+1, time.Second)
+	assert.True(t, isNetworkError(err), "expected network error, got %v", err)
+}
+
+func TestScanAllTLSAndSSH(t *testing.T) {
+	sshSrv := SSHServer{
+		ListenAddr:      fmt.Sprintf("%s:%d", serverHost, serverPort),
+		AllowedUser:     "username",
+		AllowedPassword: "Passw0rd",
+		AllowPQCKex:     true,
+		AllowNonPQCKex:  false,
+	}
+	if err := sshSrv.Start(t.Context()); err != nil {
+		t.Fatalf("failed to start SSH server: %+v", err)
+	}
+	defer sshSrv.Stop()
+
+	tlsSrv := TLSServer{
+		ListenAddr:        fmt.Sprintf("%s:%d", serverHost, serverPort+2),
+		AllowPQCipher:     false,
+		AllowNonPQCiphers: true,
+	}
+	if err := tlsSrv.Start(t.Context()); err != nil {
+		t.Fatalf("failed to start TLS server: %+v", err)
+	}
+	defer tlsSrv.Stop()
+
+	scanner := Scanner{Timeout: time.Second, Concurrency: 4}
+	results, err := scanner.ScanAll(t.Context(), CrossTargets([]string{serverHost}, []int{serverPort, serverPort + 1, serverPort + 2}))
+	assert.NoError(t, err)
+	if !assert.Len(t, results, 2) {
+		return
+	}
+
+	assert.Equal(t, serverPort, results[0].Port)
+	assert.Equal(t, SSH, results[0].PortType)
+	assert.True(t, results[0].IsPQKexSupported, "SSH PQ kex")
+	assert.False(t, results[0].IsNonPQKexSupported, "SSH non-PQ kex")
+
+	assert.Equal(t, serverPort+2, results[1].Port)
+	assert.Equal(t, TLS, results[1].PortType)
+	assert.False(t, results[1].IsPQKexSupported, "TLS PQ kex")
+	assert.True(t, results[1].IsNonPQKexSupported, "TLS non-PQ kex")
+}
+
+func TestProbeCancel(t *testing.T) {
+	// A server accepting connections but never answering
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %+v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	ctx, cancel := context.WithTimeout(t.Context(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = checkTLSPortOnce(ctx, "127.0.0.1", "", port, "", true, true, 10*time.Second)
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
@@ -0,0 +1,211 @@
+package pqcscan
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	serverHost = "localhost"
+	serverPort = 2201
+	timeout    = time.Hour * 100
+)
+
+func TestSSHKexAlgos(t *testing.T) {
+	testCases := []struct {
+		name              string
+		srvAllowPQCKex    bool
+		srvAllowNonPQCKex bool
+		expectedPqcOk     bool
+		expectedNonPqcOk  bool
+	}{
+		{
+			name:              "Server_nonPQC_only",
+			srvAllowPQCKex:    false,
+			srvAllowNonPQCKex: true,
+			expectedPqcOk:     false,
+			expectedNonPqcOk:  true,
+		},
+		{
+			name:              "Server_PQC_only",
+			srvAllowPQCKex:    true,
+			srvAllowNonPQCKex: false,
+			expectedPqcOk:     true,
+			expectedNonPqcOk:  false,
+		},
+		{
+			name:              "Server_Both_PQC_and_nonPQC",
+			srvAllowPQCKex:    true,
+			srvAllowNonPQCKex: true,
+			expectedPqcOk:     true,
+			expectedNonPqcOk:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := SSHServer{
+				ListenAddr:      fmt.Sprintf("%s:%d", serverHost, serverPort),
+				AllowedUser:     "username",
+				AllowedPassword: "Passw0rd",
+				AllowPQCKex:     tc.srvAllowPQCKex,
+				AllowNonPQCKex:  tc.srvAllowNonPQCKex,
+			}
+			if err := srv.Start(t.Context()); err != nil {
+				t.Fatalf("failed to start SSH server: %+v (%+v)", err, srv)
+				return
+			} else {
+				defer srv.Stop()
+			}
+
+			pqcKexCompleted, nonPqcKexCompleted, _, err := checkSSHPort(t.Context(), serverHost, serverPort, timeout)
+			if err != nil {
+				t.Errorf("failed to connect SSH port: %+v", err)
+				return
+			} else {
+				assert.Equal(t, tc.expectedPqcOk, pqcKexCompleted, "PQCKex completed")
+				assert.Equal(t, tc.expectedNonPqcOk, nonPqcKexCompleted, "NonPQCKex completed")
+			}
+		})
+	}
+}
+
+func TestSSHTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", fmt.Sprintf("%s:%d", serverHost, serverPort))
+	if err != nil {
+		t.Fatalf("listen error: %+v", err)
+	}
+	defer ln.Close()
+
+	_, _, _, err = checkSSHPort(t.Context(), serverHost, serverPort, time.Millisecond*100)
+	if !isNetworkError(err) {
+		t.Errorf("expected network error")
+		return
+	}
+}
+
+func TestSSHNetworkError(t *testing.T) {
+	_, _, _, err := checkSSHPort(t.Context(), serverHost, serverPort+1, time.Millisecond*100)
+	if !isNetworkError(err) {
+		t.Errorf("expected network error")
+		return
+	}
+}
+
+func TestSSHInventory(t *testing.T) {
+	srv := SSHServer{
+		ListenAddr:      fmt.Sprintf("%s:%d", serverHost, serverPort),
+		AllowedUser:     "username",
+		AllowedPassword: "Passw0rd",
+		AllowPQCKex:     true,
+		AllowNonPQCKex:  true,
+	}
+	if err := srv.Start(t.Context()); err != nil {
+		t.Fatalf("failed to start SSH server: %+v", err)
+	}
+	defer srv.Stop()
+
+	result := checkSSHPortResult(t.Context(), serverHost, serverPort, time.Second)
+	assert.Empty(t, result.Error)
+	info := result.SSH
+	if !assert.NotNil(t, info) {
+		return
+	}
+	assert.Equal(t, "SSH-2.0-GoMiniSSH", info.Banner)
+	assert.Contains(t, info.KexAlgorithms, sshKexMLKEM768X25519)
+	assert.True(t, info.MLKEM768X25519)
+	assert.False(t, info.SNTRUP761X25519)
+	assert.Equal(t, []string{"ssh-ed25519"}, info.HostKeyAlgorithms)
+	assert.NotEmpty(t, info.CiphersClientServer)
+	assert.Equal(t, info.CiphersClientServer, info.CiphersServerClient)
+	assert.NotEmpty(t, info.MACsServerClient)
+	assert.Equal(t, []string{"none"}, info.CompressionClientServer)
+	assert.Equal(t, "ssh-ed25519", info.HostKeyType)
+	assert.True(t, strings.HasPrefix(info.HostKeyFingerprint, "SHA256:"), info.HostKeyFingerprint)
+	assert.True(t, info.PQKexOffered)
+	assert.True(t, result.IsPQKexSupported)
+
+	risk := AssessQuantumRisk(&result)
+	assert.Equal(t, RiskMedium, risk.Level)
+	assert.True(t, risk.ForgedAuthentication)
+	assert.Contains(t, risk.Reasons, "host key is ssh-ed25519")
+}
+
+// marshalKexInit builds an unencrypted KEXINIT packet with the name-lists
+func marshalKexInit(lists ...[]string) []byte {
+	payload := append([]byte{sshMsgKexInit}, make([]byte, 16)...)
+	for _, list := range lists {
+		payload = binary.BigEndian.AppendUint32(payload, uint32(len(strings.Join(list, ","))))
+		payload = append(payload, strings.Join(list, ",")...)
+	}
+	payload = append(payload, 0, 0, 0, 0, 0) // first_kex_packet_follows, reserved
+	padding := 8 - (len(payload)+5)%8 + 8
+	packet := binary.BigEndian.AppendUint32(nil, uint32(1+len(payload)+padding))
+	packet = append(packet, byte(padding))
+	packet = append(packet, payload...)
+	return append(packet, make([]byte, padding)...)
+}
+
+func TestReadSSHInventorySNTRUP(t *testing.T) {
+	kexInit := marshalKexInit(
+		[]string{sshKexSNTRUP761X25519OpenSSH, "curve25519-sha256"},
+		[]string{"rsa-sha2-512", "ssh-ed25519"},
+		[]string{"chacha20-poly1305@openssh.com"},
+		[]string{"chacha20-poly1305@openssh.com", "aes256-gcm@openssh.com"},
+		[]string{"umac-128-etm@openssh.com"},
+		[]string{"hmac-sha2-256-etm@openssh.com"},
+		[]string{"none", "zlib@openssh.com"},
+		[]string{"none"},
+		nil,
+		nil,
+	)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen error: %+v", err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = conn.Write([]byte("Welcome\r\nSSH-2.0-OpenSSH_9.9 Debian\r\n"))
+		_, _ = conn.Write(kexInit)
+		_, _ = io.Copy(io.Discard, conn)
+	}()
+
+	port := ln.Addr().(*net.TCPAddr).Port
+	info, err := readSSHInventory(t.Context(), "127.0.0.1", port, time.Second)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "SSH-2.0-OpenSSH_9.9 Debian", info.Banner)
+	assert.True(t, info.SNTRUP761X25519)
+	assert.False(t, info.MLKEM768X25519)
+	assert.True(t, info.hasPQKex())
+	assert.Equal(t, []string{"rsa-sha2-512", "ssh-ed25519"}, info.HostKeyAlgorithms)
+	assert.Equal(t, []string{"aes256-gcm@openssh.com"}, info.CiphersServerClient[1:])
+	assert.Equal(t, []string{"umac-128-etm@openssh.com"}, info.MACsClientServer)
+	assert.Equal(t, []string{"hmac-sha2-256-etm@openssh.com"}, info.MACsServerClient)
+	assert.Equal(t, []string{"none", "zlib@openssh.com"}, info.CompressionClientServer)
+	assert.Equal(t, []string{"none"}, info.CompressionServerClient)
+}
+
+func TestParseKexInitMalformed(t *testing.T) {
+	_, err := parseKexInit([]byte{sshMsgKexInit, 1, 2})
+	assert.ErrorIs(t, err, errMalformedKexInit)
+
+	payload := append([]byte{sshMsgKexInit}, make([]byte, 16)...)
+	payload = append(payload, 0, 0, 0, 100, 'x')
+	_, err = parseKexInit(payload)
+	assert.ErrorIs(t, err, errMalformedKexInit)
+}
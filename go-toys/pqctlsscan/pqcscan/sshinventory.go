@@ -0,0 +1,164 @@
+package pqcscan
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Post-quantum hybrid SSH key exchanges
+const (
+	sshKexMLKEM768X25519         = "mlkem768x25519-sha256"
+	sshKexSNTRUP761X25519        = "sntrup761x25519-sha512"
+	sshKexSNTRUP761X25519OpenSSH = "sntrup761x25519-sha512@openssh.com"
+)
+
+// sshClientVersion is the identification string sent by the inventory probe
+const sshClientVersion = "SSH-2.0-pqctlsscan"
+
+// SSHInfo is the algorithm inventory of an SSH server, from its KEXINIT message (RFC 4253 7.1)
+type SSHInfo struct {
+	Banner string `json:"banner"` // Identification string, like SSH-2.0-OpenSSH_9.9
+
+	KexAlgorithms           []string `json:"kexAlgorithms"`
+	HostKeyAlgorithms       []string `json:"hostKeyAlgorithms"`
+	CiphersClientServer     []string `json:"ciphersClientServer"`
+	CiphersServerClient     []string `json:"ciphersServerClient"`
+	MACsClientServer        []string `json:"macsClientServer"`
+	MACsServerClient        []string `json:"macsServerClient"`
+	CompressionClientServer []string `json:"compressionClientServer"`
+	CompressionServerClient []string `json:"compressionServerClient"`
+
+	HostKeyType        string `json:"hostKeyType,omitempty"`        // Key presented in the handshake, like ssh-ed25519
+	HostKeyFingerprint string `json:"hostKeyFingerprint,omitempty"` // SHA256:base64, as printed by ssh-keygen
+
+	MLKEM768X25519  bool `json:"mlkem768x25519"`  // mlkem768x25519-sha256 is offered
+	SNTRUP761X25519 bool `json:"sntrup761x25519"` // sntrup761x25519-sha512, or its @openssh.com name is offered
+
+	// PQKexOffered is true if a post-quantum hybrid key exchange is offered. Only
+	// mlkem768x25519 can be negotiated by the scanner, see ScanResult.IsPQKexSupported.
+	PQKexOffered bool `json:"pqKexOffered"`
+}
+
+// hasPQKex reports whether the server offers a post-quantum hybrid key exchange
+func (info *SSHInfo) hasPQKex() bool {
+	return info.MLKEM768X25519 || info.SNTRUP761X25519
+}
+
+// maxSSHPacketLength is the packet size every implementation must accept (RFC 4253 6.1)
+const maxSSHPacketLength = 35000
+
+// maxSSHBannerLines limits the lines a server may send before its identification string (RFC 4253 4.2)
+const maxSSHBannerLines = 32
+
+const sshMsgKexInit = 20
+
+var errMalformedKexInit = errors.New("malformed SSH KEXINIT")
+
+// readSSHInventory connects to the port, exchanges the identification strings
+// and reads the algorithm lists of the server's KEXINIT
+func readSSHInventory(ctx context.Context, host string, port int, timeout time.Duration) (*SSHInfo, error) {
+	conn, err := dialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(port)), timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+
+	if _, err := io.WriteString(conn, sshClientVersion+"\r\n"); err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(conn)
+	banner, err := readSSHBanner(r)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := readSSHPacket(r)
+	if err != nil {
+		return nil, err
+	}
+	info, err := parseKexInit(payload)
+	if err != nil {
+		return nil, err
+	}
+	info.Banner = banner
+	return info, nil
+}
+
+// readSSHBanner skips the lines before the identification string and returns it
+func readSSHBanner(r *bufio.Reader) (string, error) {
+	for range maxSSHBannerLines {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if strings.HasPrefix(line, "SSH-") {
+			return line, nil
+		}
+	}
+	return "", errors.New("no SSH identification string")
+}
+
+// readSSHPacket reads an unencrypted binary packet and returns its payload
+func readSSHPacket(r io.Reader) ([]byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(header[:4])
+	padding := uint32(header[4])
+	if length > maxSSHPacketLength || length < padding+1 {
+		return nil, fmt.Errorf("invalid SSH packet length %d", length)
+	}
+	rest := make([]byte, length-1)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return nil, err
+	}
+	return rest[:len(rest)-int(padding)], nil
+}
+
+// parseKexInit parses the name-lists of a KEXINIT payload
+func parseKexInit(payload []byte) (*SSHInfo, error) {
+	if len(payload) < 17 || payload[0] != sshMsgKexInit {
+		return nil, errMalformedKexInit
+	}
+	b := payload[17:] // Message number and cookie
+	var lists [10][]string
+	for i := range lists {
+		if len(b) < 4 {
+			return nil, errMalformedKexInit
+		}
+		n := binary.BigEndian.Uint32(b)
+		if uint32(len(b)-4) < n {
+			return nil, errMalformedKexInit
+		}
+		if n > 0 {
+			lists[i] = strings.Split(string(b[4:4+n]), ",")
+		}
+		b = b[4+n:]
+	}
+
+	info := &SSHInfo{
+		KexAlgorithms:           lists[0],
+		HostKeyAlgorithms:       lists[1],
+		CiphersClientServer:     lists[2],
+		CiphersServerClient:     lists[3],
+		MACsClientServer:        lists[4],
+		MACsServerClient:        lists[5],
+		CompressionClientServer: lists[6],
+		CompressionServerClient: lists[7],
+	}
+	info.MLKEM768X25519 = slices.Contains(info.KexAlgorithms, sshKexMLKEM768X25519)
+	info.SNTRUP761X25519 = slices.Contains(info.KexAlgorithms, sshKexSNTRUP761X25519) ||
+		slices.Contains(info.KexAlgorithms, sshKexSNTRUP761X25519OpenSSH)
+	return info, nil
+}
@@ -0,0 +1,129 @@
+package pqcscan
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var pqKexAlogs = []string{ssh.KeyExchangeMLKEM768X25519}
+var nonPqKeyAlogs = []string{
+	ssh.KeyExchangeCurve25519,
+	ssh.KeyExchangeECDHP256,
+	ssh.KeyExchangeECDHP384,
+	ssh.KeyExchangeECDHP521,
+	ssh.KeyExchangeDH14SHA256,
+	ssh.InsecureKeyExchangeDH14SHA1,
+}
+var allKexAlgos = append(pqKexAlogs, nonPqKeyAlogs...)
+
+// checkSSHPort tries the post-quantum and the classic key exchanges separately.
+// The host key is the one presented in either handshake, or nil.
+func checkSSHPort(ctx context.Context, host string, port int, timeout time.Duration) (pqcKexCompleted bool, nonPqcKexCompleted bool, hostKey ssh.PublicKey, err error) {
+	nonPqcKexCompleted, hostKey, err = checkSSHPortOnce(ctx, host, port, false, true, timeout)
+	if err != nil {
+		return false, false, nil, err
+	}
+	pqcKexCompleted, pqcHostKey, err := checkSSHPortOnce(ctx, host, port, true, false, timeout)
+	if err != nil {
+		return false, false, nil, err
+	}
+	if hostKey == nil {
+		hostKey = pqcHostKey
+	}
+	return pqcKexCompleted, nonPqcKexCompleted, hostKey, nil
+}
+
+// checkSSHPortResult reads the algorithm inventory of an SSH port and probes its key exchanges.
+// IsPQKexSupported is set only if the post-quantum key exchange was negotiated; an offered
+// sntrup761x25519, which can't be negotiated here, is reported by SSHInfo.PQKexOffered.
+func checkSSHPortResult(ctx context.Context, host string, port int, timeout time.Duration) (result ScanResult) {
+	result.Address = host
+	result.Port = port
+	result.PortType = SSH
+	now := time.Now()
+	defer func() {
+		result.TestDuration = time.Since(now)
+	}()
+
+	info, err := readSSHInventory(ctx, host, port, timeout)
+	if err != nil {
+		if isNetworkError(err) {
+			result.PortType = NoConn
+		}
+		result.Error = err.Error()
+		return
+	}
+	info.PQKexOffered = info.hasPQKex()
+	result.SSH = info
+
+	pqcKexCompleted, nonPqcKexCompleted, hostKey, err := checkSSHPort(ctx, host, port, timeout)
+	if err != nil {
+		if isNetworkError(err) {
+			result.PortType = NoConn
+		}
+		result.Error = err.Error()
+		return
+	}
+	if hostKey != nil {
+		info.HostKeyType = hostKey.Type()
+		info.HostKeyFingerprint = ssh.FingerprintSHA256(hostKey)
+		result.ServerCertKeyAlgo = hostKey.Type()
+	}
+	result.IsPQKexSupported = pqcKexCompleted
+	result.IsNonPQKexSupported = nonPqcKexCompleted
+	return
+}
+
+func checkSSHPortOnce(ctx context.Context, host string, port int, allowPQCKex bool, allowNonPQCKex bool, timeout time.Duration) (kexCompleted bool, hostKey ssh.PublicKey, err error) {
+
+	// Create an SSH configuration. The host key callback is called after the key exchange.
+	clientCfg := &ssh.ClientConfig{
+		Config: ssh.Config{},
+		User:   "cica",
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			hostKey = key
+			return nil
+		},
+	}
+	if allowPQCKex && !allowNonPQCKex {
+		clientCfg.Config.KeyExchanges = pqKexAlogs
+	} else if !allowPQCKex && allowNonPQCKex {
+		clientCfg.Config.KeyExchanges = nonPqKeyAlogs
+	} else if allowPQCKex && allowNonPQCKex {
+		clientCfg.Config.KeyExchanges = allKexAlgos
+	} else {
+		return false, nil, errors.New("invalid argument combination")
+	}
+	clientCfg.SetDefaults()
+
+	// Connect and run the SSH handshake
+	target := net.JoinHostPort(host, strconv.Itoa(port))
+
+	rawConn, err := dialContext(ctx, "tcp", target, timeout)
+	if err != nil {
+		return false, nil, err
+	}
+	// Optional: cap total time for SSH handshake as well
+	_ = rawConn.SetDeadline(time.Now().Add(timeout))
+
+	sshConn, _, _, err := ssh.NewClientConn(rawConn, target, clientCfg)
+	if err != nil {
+		rawConn.Close()
+		kexInitErr := &ssh.AlgorithmNegotiationError{}
+		if errors.As(err, &kexInitErr) {
+			return false, nil, nil
+		} else if hostKey != nil {
+			// We got a host key callback, but the authentication failed.
+			return true, hostKey, nil
+		} else {
+			return false, nil, err
+		}
+	}
+	defer sshConn.Close()
+	return true, hostKey, nil
+}
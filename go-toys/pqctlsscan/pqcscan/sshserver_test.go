@@ -1,4 +1,4 @@
-package main
+package pqcscan
 
 import (
 	"bytes"
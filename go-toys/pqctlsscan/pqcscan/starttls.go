@@ -0,0 +1,345 @@
+package pqcscan
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// STARTTLS modes of the Scanner besides the protocol names
+const (
+	StartTLSAuto = "auto" // Selected by the well-known port
+	StartTLSNone = "none" // Implicit TLS only
+)
+
+// starttlsClientName is sent in SMTP EHLO
+const starttlsClientName = "pqctlsscan"
+
+// starttlsUpgrade runs the plaintext part of a protocol until the server is ready for the TLS handshake.
+// serverName is the host name of the target, or its address if it has none.
+type starttlsUpgrade func(conn net.Conn, serverName string) error
+
+// starttlsProtocols are the supported STARTTLS protocols
+var starttlsProtocols = map[string]starttlsUpgrade{
+	"smtp":     starttlsSMTP,
+	"imap":     starttlsIMAP,
+	"pop3":     starttlsPOP3,
+	"ldap":     starttlsLDAP,
+	"postgres": starttlsPostgres,
+	"xmpp":     starttlsXMPP,
+}
+
+// starttlsPorts select the STARTTLS protocol in StartTLSAuto mode
+var starttlsPorts = map[int]string{
+	25:   "smtp",
+	587:  "smtp",
+	143:  "imap",
+	110:  "pop3",
+	389:  "ldap",
+	5432: "postgres",
+	5222: "xmpp",
+}
+
+// StartTLSProtocolNames lists the protocol names for the usage text
+func StartTLSProtocolNames() string {
+	names := make([]string, 0, len(starttlsProtocols))
+	for name := range starttlsProtocols {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// ParseStartTLSMode checks the value of the -starttls flag
+func ParseStartTLSMode(mode string) (string, error) {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	if mode == "" {
+		return StartTLSAuto, nil
+	}
+	if _, ok := starttlsProtocols[mode]; ok || mode == StartTLSAuto || mode == StartTLSNone {
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown STARTTLS protocol %q: must be auto, none or one of %s", mode, StartTLSProtocolNames())
+}
+
+// starttlsProtocolFor gets the STARTTLS protocol to use on the port, or "" for none
+func starttlsProtocolFor(port int, mode string) string {
+	switch mode {
+	case "", StartTLSAuto:
+		return starttlsPorts[port]
+	case StartTLSNone:
+		return ""
+	default:
+		return mode
+	}
+}
+
+// dialTLSPort connects to the port and runs the STARTTLS upgrade, if any.
+// serverName is the host name passed to the upgrade; host is used if it's empty.
+// The deadline of the returned connection is set to now + timeout.
+func dialTLSPort(ctx context.Context, host, serverName string, port int, starttls string, timeout time.Duration) (net.Conn, error) {
+	conn, err := dialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(port)), timeout)
+	if err != nil {
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+	if starttls == "" {
+		return conn, nil
+	}
+	upgrade, ok := starttlsProtocols[starttls]
+	if !ok {
+		conn.Close()
+		return nil, fmt.Errorf("unknown STARTTLS protocol %q", starttls)
+	}
+	if serverName == "" {
+		serverName = host
+	}
+	if err := upgrade(conn, serverName); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("%s STARTTLS: %w", starttls, err)
+	}
+	// The handshake gets a full timeout too
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+	return conn, nil
+}
+
+// starttlsSMTP implements RFC 3207
+func starttlsSMTP(conn net.Conn, serverName string) error {
+	tp := textproto.NewConn(conn)
+	if _, _, err := tp.ReadResponse(220); err != nil {
+		return err
+	}
+	if err := tp.PrintfLine("EHLO %s", starttlsClientName); err != nil {
+		return err
+	}
+	_, msg, err := tp.ReadResponse(250)
+	if err != nil {
+		return err
+	}
+	if !containsLine(msg, "STARTTLS") {
+		return errors.New("STARTTLS not offered")
+	}
+	if err := tp.PrintfLine("STARTTLS"); err != nil {
+		return err
+	}
+	_, _, err = tp.ReadResponse(220)
+	return err
+}
+
+// containsLine reports whether a line of the multi-line response starts with the keyword
+func containsLine(msg, keyword string) bool {
+	for _, line := range strings.Split(msg, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && strings.EqualFold(fields[0], keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// starttlsIMAP implements RFC 3501 6.2.1
+func starttlsIMAP(conn net.Conn, serverName string) error {
+	tp := textproto.NewConn(conn)
+	greeting, err := tp.ReadLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(greeting, "* OK") {
+		return fmt.Errorf("unexpected greeting: %q", greeting)
+	}
+	if err := tp.PrintfLine("a1 STARTTLS"); err != nil {
+		return err
+	}
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(line, "a1 ") {
+			// Untagged response
+			continue
+		}
+		if !strings.HasPrefix(line, "a1 OK") {
+			return fmt.Errorf("STARTTLS refused: %q", line)
+		}
+		return nil
+	}
+}
+
+// starttlsPOP3 implements RFC 2595 4
+func starttlsPOP3(conn net.Conn, serverName string) error {
+	tp := textproto.NewConn(conn)
+	greeting, err := tp.ReadLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(greeting, "+OK") {
+		return fmt.Errorf("unexpected greeting: %q", greeting)
+	}
+	if err := tp.PrintfLine("STLS"); err != nil {
+		return err
+	}
+	line, err := tp.ReadLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "+OK") {
+		return fmt.Errorf("STLS refused: %q", line)
+	}
+	return nil
+}
+
+// ldapStartTLSOID is the requestName of the StartTLS extended operation (RFC 4511 4.14)
+const ldapStartTLSOID = "1.3.6.1.4.1.1466.20037"
+
+// starttlsLDAP sends a StartTLS ExtendedRequest and checks the resultCode of the ExtendedResponse
+func starttlsLDAP(conn net.Conn, serverName string) error {
+	request, err := asn1.Marshal(struct {
+		MessageID int
+		Request   asn1.RawValue
+	}{1, asn1.RawValue{
+		Class: asn1.ClassApplication, Tag: 23, IsCompound: true,
+		Bytes: append([]byte{0x80, byte(len(ldapStartTLSOID))}, ldapStartTLSOID...),
+	}})
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Write(request); err != nil {
+		return err
+	}
+
+	var message struct {
+		MessageID int
+		Response  asn1.RawValue
+		Controls  asn1.RawValue `asn1:"optional"`
+	}
+	if err := readBERElement(conn, &message); err != nil {
+		return err
+	}
+	if message.Response.Class != asn1.ClassApplication || message.Response.Tag != 24 {
+		return fmt.Errorf("unexpected LDAP response [APPLICATION %d]", message.Response.Tag)
+	}
+	var resultCode asn1.Enumerated
+	if _, err := asn1.Unmarshal(message.Response.Bytes, &resultCode); err != nil {
+		return err
+	}
+	if resultCode != 0 {
+		return fmt.Errorf("StartTLS refused with resultCode %d", resultCode)
+	}
+	return nil
+}
+
+// readBERElement reads a single definite length BER element from r and parses it
+func readBERElement(r io.Reader, v any) error {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return err
+	}
+	element := header
+	length := int(header[1])
+	if header[1]&0x80 != 0 {
+		lenBytes := make([]byte, header[1]&0x7f)
+		if len(lenBytes) == 0 || len(lenBytes) > 3 {
+			return errors.New("unsupported BER length")
+		}
+		if _, err := io.ReadFull(r, lenBytes); err != nil {
+			return err
+		}
+		element = append(element, lenBytes...)
+		length = 0
+		for _, b := range lenBytes {
+			length = length<<8 | int(b)
+		}
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return err
+	}
+	_, err := asn1.Unmarshal(append(element, body...), v)
+	return err
+}
+
+// postgresSSLRequestCode is the protocol version number of the SSLRequest message
+const postgresSSLRequestCode = 80877103
+
+// starttlsPostgres sends an SSLRequest, answered with a single S or N
+func starttlsPostgres(conn net.Conn, serverName string) error {
+	request := binary.BigEndian.AppendUint32(nil, 8)
+	request = binary.BigEndian.AppendUint32(request, postgresSSLRequestCode)
+	if _, err := conn.Write(request); err != nil {
+		return err
+	}
+	answer := make([]byte, 1)
+	if _, err := io.ReadFull(conn, answer); err != nil {
+		return err
+	}
+	switch answer[0] {
+	case 'S':
+		return nil
+	case 'N':
+		return errors.New("SSL refused")
+	default:
+		return fmt.Errorf("unexpected answer %q", answer)
+	}
+}
+
+// starttlsXMPP implements RFC 6120 5.4
+func starttlsXMPP(conn net.Conn, serverName string) error {
+	// The name comes from the targets, escape it in the attribute
+	var to strings.Builder
+	if err := xml.EscapeText(&to, []byte(serverName)); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(conn, "<?xml version='1.0'?><stream:stream to='%s' xmlns='jabber:client' "+
+		"xmlns:stream='http://etherx.jabber.org/streams' version='1.0'>", to.String())
+	if err != nil {
+		return err
+	}
+	r := bufio.NewReader(conn)
+	features, err := readUntil(r, "</stream:features>")
+	if err != nil {
+		return err
+	}
+	if !bytes.Contains(features, []byte("urn:ietf:params:xml:ns:xmpp-tls")) {
+		return errors.New("STARTTLS not offered")
+	}
+	if _, err := io.WriteString(conn, "<starttls xmlns='urn:ietf:params:xml:ns:xmpp-tls'/>"); err != nil {
+		return err
+	}
+	answer, err := readUntil(r, "/>")
+	if err != nil {
+		return err
+	}
+	if !bytes.Contains(answer, []byte("<proceed")) {
+		return fmt.Errorf("STARTTLS refused: %q", answer)
+	}
+	return nil
+}
+
+// readUntil reads from r until the data ends with the suffix. At most 64 KiB is read.
+func readUntil(r *bufio.Reader, suffix string) ([]byte, error) {
+	var data []byte
+	for !bytes.HasSuffix(data, []byte(suffix)) {
+		if len(data) > 64*1024 {
+			return nil, fmt.Errorf("no %q in the first 64 KiB", suffix)
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, b)
+	}
+	return data, nil
+}
@@ -0,0 +1,229 @@
+package pqcscan
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// startSTARTTLSServer serves the plaintext dialog on every connection, then a TLS handshake if the dialog succeeds
+func startSTARTTLSServer(t *testing.T, dialog func(conn net.Conn, r *bufio.Reader) bool) {
+	t.Helper()
+	cert, err := generateSelfSignedCert()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	tlsCfg := &tls.Config{
+		Certificates:     []tls.Certificate{cert},
+		CurvePreferences: []tls.CurveID{tls.X25519MLKEM768, tls.X25519},
+	}
+	ln, err := net.Listen("tcp", fmt.Sprintf("%s:%d", serverHost, serverPort))
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	var wg sync.WaitGroup
+	t.Cleanup(func() {
+		ln.Close()
+		wg.Wait()
+	})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer conn.Close()
+				_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+				r := bufio.NewReader(conn)
+				if !dialog(conn, r) {
+					return
+				}
+				// Nothing is buffered, clients wait for the go-ahead
+				_ = tls.Server(conn, tlsCfg).Handshake()
+			}()
+		}
+	}()
+}
+
+func readLine(r *bufio.Reader) string {
+	line, _ := r.ReadString('\n')
+	return strings.TrimRight(line, "\r\n")
+}
+
+var starttlsDialogs = map[string]func(conn net.Conn, r *bufio.Reader) bool{
+	"smtp": func(conn net.Conn, r *bufio.Reader) bool {
+		io.WriteString(conn, "220 mail.example.com ESMTP\r\n")
+		if !strings.HasPrefix(readLine(r), "EHLO ") {
+			return false
+		}
+		io.WriteString(conn, "250-mail.example.com\r\n250-PIPELINING\r\n250 STARTTLS\r\n")
+		if readLine(r) != "STARTTLS" {
+			return false
+		}
+		io.WriteString(conn, "220 Ready to start TLS\r\n")
+		return true
+	},
+	"imap": func(conn net.Conn, r *bufio.Reader) bool {
+		io.WriteString(conn, "* OK [CAPABILITY IMAP4rev1 STARTTLS] ready\r\n")
+		if readLine(r) != "a1 STARTTLS" {
+			return false
+		}
+		io.WriteString(conn, "* BYE not really\r\na1 OK Begin TLS negotiation now\r\n")
+		return true
+	},
+	"pop3": func(conn net.Conn, r *bufio.Reader) bool {
+		io.WriteString(conn, "+OK POP3 ready\r\n")
+		if readLine(r) != "STLS" {
+			return false
+		}
+		io.WriteString(conn, "+OK Begin TLS\r\n")
+		return true
+	},
+	"ldap": func(conn net.Conn, r *bufio.Reader) bool {
+		header := make([]byte, 2)
+		if _, err := io.ReadFull(r, header); err != nil {
+			return false
+		}
+		request := make([]byte, header[1])
+		if _, err := io.ReadFull(r, request); err != nil || !strings.Contains(string(request), ldapStartTLSOID) {
+			return false
+		}
+		// ExtendedResponse with resultCode success
+		conn.Write([]byte{0x30, 0x0c, 0x02, 0x01, 0x01, 0x78, 0x07, 0x0a, 0x01, 0x00, 0x04, 0x00, 0x04, 0x00})
+		return true
+	},
+	"postgres": func(conn net.Conn, r *bufio.Reader) bool {
+		request := make([]byte, 8)
+		if _, err := io.ReadFull(r, request); err != nil || string(request) != "\x00\x00\x00\x08\x04\xd2\x16\x2f" {
+			conn.Write([]byte("N"))
+			return false
+		}
+		conn.Write([]byte("S"))
+		return true
+	},
+	"xmpp": func(conn net.Conn, r *bufio.Reader) bool {
+		if _, err := readUntil(r, "version='1.0'>"); err != nil {
+			return false
+		}
+		io.WriteString(conn, "<?xml version='1.0'?><stream:stream from='example.com' xmlns='jabber:client' "+
+			"xmlns:stream='http://etherx.jabber.org/streams' version='1.0'><stream:features>"+
+			"<starttls xmlns='urn:ietf:params:xml:ns:xmpp-tls'><required/></starttls></stream:features>")
+		if _, err := readUntil(r, "/>"); err != nil {
+			return false
+		}
+		io.WriteString(conn, "<proceed xmlns='urn:ietf:params:xml:ns:xmpp-tls'/>")
+		return true
+	},
+}
+
+func TestStartTLS(t *testing.T) {
+	for protocol, dialog := range starttlsDialogs {
+		t.Run(protocol, func(t *testing.T) {
+			startSTARTTLSServer(t, dialog)
+
+			state, err := checkTLSPortOnce(t.Context(), serverHost, "", serverPort, protocol, true, false, time.Second)
+			if assert.NoError(t, err) {
+				assert.Equal(t, tls.X25519MLKEM768, state.CurveID)
+			}
+
+			scanner := Scanner{Timeout: time.Second, StartTLS: protocol}
+			result := scanner.ScanTarget(t.Context(), Target{Host: serverHost, Port: serverPort})
+			assert.Equal(t, TLS, result.PortType)
+			assert.Equal(t, protocol, result.StartTLS)
+			assert.True(t, result.IsPQKexSupported, "PQ kex")
+			assert.True(t, result.IsNonPQKexSupported, "non-PQ kex")
+			if assert.NotNil(t, result.TLSGroups) {
+				assert.Equal(t, []string{"X25519MLKEM768", "X25519"}, result.TLSGroups.Supported)
+			}
+			assert.Len(t, result.CertChain, 1)
+		})
+	}
+}
+
+func TestStartTLSNotOffered(t *testing.T) {
+	startSTARTTLSServer(t, func(conn net.Conn, r *bufio.Reader) bool {
+		io.WriteString(conn, "220 mail.example.com ESMTP\r\n")
+		readLine(r)
+		io.WriteString(conn, "250-mail.example.com\r\n250 PIPELINING\r\n")
+		readLine(r)
+		return false
+	})
+
+	_, err := checkTLSPortOnce(t.Context(), serverHost, "", serverPort, "smtp", true, true, time.Second)
+	assert.ErrorContains(t, err, "STARTTLS not offered")
+
+	scanner := Scanner{Timeout: time.Second, StartTLS: "smtp"}
+	result := scanner.ScanTarget(t.Context(), Target{Host: serverHost, Port: serverPort})
+	assert.Equal(t, Other, result.PortType)
+	assert.Empty(t, result.StartTLS)
+}
+
+func TestStartTLSXMPPServerName(t *testing.T) {
+	var mu sync.Mutex
+	var headers []string
+	startSTARTTLSServer(t, func(conn net.Conn, r *bufio.Reader) bool {
+		header, err := readUntil(r, "version='1.0'>")
+		if err != nil {
+			return false
+		}
+		mu.Lock()
+		headers = append(headers, string(header))
+		mu.Unlock()
+		io.WriteString(conn, "<?xml version='1.0'?><stream:stream from='xmpp.example' xmlns='jabber:client' "+
+			"xmlns:stream='http://etherx.jabber.org/streams' version='1.0'><stream:features>"+
+			"<starttls xmlns='urn:ietf:params:xml:ns:xmpp-tls'><required/></starttls></stream:features>")
+		if _, err := readUntil(r, "/>"); err != nil {
+			return false
+		}
+		io.WriteString(conn, "<proceed xmlns='urn:ietf:params:xml:ns:xmpp-tls'/>")
+		return true
+	})
+
+	lastHeader := func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(headers) == 0 {
+			return ""
+		}
+		return headers[len(headers)-1]
+	}
+
+	_, err := checkTLSPortOnce(t.Context(), serverHost, "xmpp.example", serverPort, "xmpp", true, true, time.Second)
+	assert.NoError(t, err)
+	assert.Contains(t, lastHeader(), "to='xmpp.example'")
+
+	// A target name can't inject attributes into the stream header
+	_, err = checkTLSPortOnce(t.Context(), serverHost, "x' from='evil<", serverPort, "xmpp", true, true, time.Second)
+	assert.NoError(t, err)
+	assert.Contains(t, lastHeader(), "to='x&#39; from=&#39;evil&lt;'")
+}
+
+func TestStartTLSMode(t *testing.T) {
+	assert.Equal(t, "smtp", starttlsProtocolFor(587, StartTLSAuto))
+	assert.Equal(t, "postgres", starttlsProtocolFor(5432, ""))
+	assert.Equal(t, "", starttlsProtocolFor(443, StartTLSAuto))
+	assert.Equal(t, "", starttlsProtocolFor(25, StartTLSNone))
+	assert.Equal(t, "imap", starttlsProtocolFor(10143, "imap"))
+
+	mode, err := ParseStartTLSMode(" LDAP ")
+	assert.NoError(t, err)
+	assert.Equal(t, "ldap", mode)
+	mode, err = ParseStartTLSMode("")
+	assert.NoError(t, err)
+	assert.Equal(t, StartTLSAuto, mode)
+	_, err = ParseStartTLSMode("ftp")
+	assert.Error(t, err)
+}
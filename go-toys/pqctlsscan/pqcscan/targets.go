@@ -0,0 +1,301 @@
+package pqcscan
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxCIDRHostBits limits the size of a single CIDR block, so a typo like /8 doesn't start a scan of millions of hosts
+const maxCIDRHostBits = 16
+
+// Target is a single host and port to scan
+type Target struct {
+	Host     string // IP address or host name
+	Port     int
+	Hostname string // The name Host was resolved from, if any
+}
+
+func (t Target) String() string {
+	return net.JoinHostPort(t.Host, strconv.Itoa(t.Port))
+}
+
+// ServerName is the name to send in the TLS SNI extension: Hostname, or Host if it isn't an IP address.
+// Empty for targets given by IP address.
+func (t Target) ServerName() string {
+	if t.Hostname != "" {
+		return t.Hostname
+	}
+	if _, err := netip.ParseAddr(t.Host); err != nil {
+		return t.Host
+	}
+	return ""
+}
+
+// namedPortSets are the port sets accepted by ParsePortSpec
+var namedPortSets = map[string][]int{
+	"web":           {80, 443, 8080, 8443},
+	"mail":          {465, 993, 995},
+	"mail-starttls": {25, 110, 143, 587},
+	"ssh":           {22},
+	"ldap":          {389, 636},
+	"db":            {1433, 3306, 5432},
+	"rdp":           {3389},
+}
+
+// PortSetNames lists the names of the port sets for the usage text
+func PortSetNames() string {
+	names := make([]string, 0, len(namedPortSets))
+	for name := range namedPortSets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// ParsePortSpec parses a comma separated list of ports, port ranges like "8000-8100"
+// and named port sets like "web". The result is sorted and has no duplicates.
+func ParsePortSpec(spec string) ([]int, error) {
+	seen := make(map[int]bool)
+	var ports []int
+	add := func(port int) {
+		if !seen[port] {
+			seen[port] = true
+			ports = append(ports, port)
+		}
+	}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if set, ok := namedPortSets[item]; ok {
+			for _, port := range set {
+				add(port)
+			}
+			continue
+		}
+		first, last, isRange := strings.Cut(item, "-")
+		start, err := parsePort(first)
+		if err != nil {
+			return nil, err
+		}
+		end := start
+		if isRange {
+			end, err = parsePort(last)
+			if err != nil {
+				return nil, err
+			}
+			if start > end {
+				return nil, fmt.Errorf("invalid port range %q", item)
+			}
+		}
+		for port := start; port <= end; port++ {
+			add(port)
+		}
+	}
+	if len(ports) == 0 {
+		return nil, errors.New("no ports given")
+	}
+	sort.Ints(ports)
+	return ports, nil
+}
+
+func parsePort(s string) (int, error) {
+	port, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("invalid port %q: must be a number between 1 and 65535 or one of the named sets", s)
+	}
+	return port, nil
+}
+
+// ParseHostSpec parses a comma separated list of IP addresses, CIDR blocks and host names.
+// CIDR blocks are expanded to their addresses, without the network and broadcast address of IPv4 blocks.
+func ParseHostSpec(spec string) ([]string, error) {
+	var hosts []string
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if strings.Contains(item, "/") {
+			addrs, err := expandCIDR(item)
+			if err != nil {
+				return nil, err
+			}
+			hosts = append(hosts, addrs...)
+			continue
+		}
+		hosts = append(hosts, strings.TrimSuffix(strings.TrimPrefix(item, "["), "]"))
+	}
+	if len(hosts) == 0 {
+		return nil, errors.New("no hosts given")
+	}
+	return hosts, nil
+}
+
+// expandCIDR lists the host addresses of a CIDR block
+func expandCIDR(cidr string) ([]string, error) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CIDR block %q: %w", cidr, err)
+	}
+	prefix = prefix.Masked()
+	hostBits := prefix.Addr().BitLen() - prefix.Bits()
+	if hostBits > maxCIDRHostBits {
+		return nil, fmt.Errorf("CIDR block %q is too large: at most %d addresses are allowed", cidr, 1<<maxCIDRHostBits)
+	}
+
+	var addrs []string
+	for addr := prefix.Addr(); prefix.Contains(addr); addr = addr.Next() {
+		addrs = append(addrs, addr.String())
+	}
+	// The network and broadcast addresses of IPv4 blocks are not hosts (RFC 3021 excepted)
+	if prefix.Addr().Is4() && hostBits >= 2 {
+		addrs = addrs[1 : len(addrs)-1]
+	}
+	return addrs, nil
+}
+
+// ReadTargetFile reads targets from lines of "host:port", "[ipv6]:port", or a host spec
+// without a port that gets the default ports. Empty lines and lines starting with # are skipped.
+func ReadTargetFile(r io.Reader, defaultPorts []int) ([]Target, error) {
+	var targets []Target
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		hostSpec, ports := line, defaultPorts
+		if host, port, err := net.SplitHostPort(line); err == nil {
+			p, err := parsePort(port)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			hostSpec, ports = host, []int{p}
+		} else if i := strings.LastIndex(line, ":"); i > 0 && strings.Contains(line, "/") && !strings.Contains(line[:i], ":") {
+			// An IPv4 CIDR block with a port, e.g. 10.0.0.0/30:443
+			p, err := parsePort(line[i+1:])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			hostSpec, ports = line[:i], []int{p}
+		}
+		if len(ports) == 0 {
+			return nil, fmt.Errorf("line %d: no port given and no default ports", lineNo)
+		}
+
+		hosts, err := ParseHostSpec(hostSpec)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		for _, host := range hosts {
+			for _, port := range ports {
+				targets = append(targets, Target{Host: host, Port: port})
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return targets, nil
+}
+
+// CrossTargets creates a target for every host and port
+func CrossTargets(hosts []string, ports []int) []Target {
+	targets := make([]Target, 0, len(hosts)*len(ports))
+	for _, host := range hosts {
+		for _, port := range ports {
+			targets = append(targets, Target{Host: host, Port: port})
+		}
+	}
+	return targets
+}
+
+// ResolveTargets replaces targets given by host name with one target for every A and AAAA record of the name.
+// IP address targets are kept as they are.
+func ResolveTargets(ctx context.Context, resolver *net.Resolver, targets []Target) ([]Target, error) {
+	resolved := make(map[string][]string)
+	var result []Target
+	for _, t := range targets {
+		if _, err := netip.ParseAddr(t.Host); err == nil {
+			result = append(result, t)
+			continue
+		}
+		addrs, ok := resolved[t.Host]
+		if !ok {
+			ipAddrs, err := resolver.LookupIPAddr(ctx, t.Host)
+			if err != nil {
+				return nil, fmt.Errorf("resolving %s: %w", t.Host, err)
+			}
+			for _, ipAddr := range ipAddrs {
+				addrs = append(addrs, ipAddr.IP.String())
+			}
+			resolved[t.Host] = addrs
+		}
+		for _, addr := range addrs {
+			result = append(result, Target{Host: addr, Port: t.Port, Hostname: t.Host})
+		}
+	}
+	return result, nil
+}
+
+// hostRateLimiter spaces the connections to the same host
+type hostRateLimiter struct {
+	interval time.Duration // Zero means unlimited
+
+	mu   sync.Mutex
+	next map[string]time.Time
+}
+
+// newHostRateLimiter allows perSecond new scans per host. Zero or negative means unlimited.
+func newHostRateLimiter(perSecond float64) *hostRateLimiter {
+	l := &hostRateLimiter{next: make(map[string]time.Time)}
+	if perSecond > 0 {
+		l.interval = time.Duration(float64(time.Second) / perSecond)
+	}
+	return l
+}
+
+// limited reports whether the limiter spaces the scans. A nil limiter doesn't.
+func (l *hostRateLimiter) limited() bool {
+	return l != nil && l.interval > 0
+}
+
+// wait blocks until the host may be scanned again. A nil limiter doesn't block.
+// Concurrent waits of a host get consecutive turns.
+func (l *hostRateLimiter) wait(ctx context.Context, host string) error {
+	if !l.limited() {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	slot := l.next[host]
+	if slot.Before(now) {
+		slot = now
+	}
+	l.next[host] = slot.Add(l.interval)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(slot))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
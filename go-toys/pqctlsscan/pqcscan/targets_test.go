@@ -0,0 +1,108 @@
+package pqcscan
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePortSpec(t *testing.T) {
+	ports, err := ParsePortSpec("web, 22,8000-8002,443")
+	assert.NoError(t, err)
+	assert.Equal(t, []int{22, 80, 443, 8000, 8001, 8002, 8080, 8443}, ports)
+
+	ports, err = ParsePortSpec("mail-starttls")
+	assert.NoError(t, err)
+	assert.Equal(t, []int{25, 110, 143, 587}, ports)
+
+	for _, spec := range []string{"", "0", "65536", "http", "90-80", "1-x"} {
+		_, err = ParsePortSpec(spec)
+		assert.Error(t, err, "spec %q", spec)
+	}
+}
+
+func TestParseHostSpec(t *testing.T) {
+	hosts, err := ParseHostSpec("192.168.1.0/30, example.com,[::1],10.0.0.7/32")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"192.168.1.1", "192.168.1.2", "example.com", "::1", "10.0.0.7"}, hosts)
+
+	hosts, err = ParseHostSpec("2001:db8::/127")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2001:db8::", "2001:db8::1"}, hosts)
+
+	_, err = ParseHostSpec("10.0.0.0/8")
+	assert.Error(t, err)
+	_, err = ParseHostSpec("10.0.0.0/33")
+	assert.Error(t, err)
+	_, err = ParseHostSpec(" , ")
+	assert.Error(t, err)
+}
+
+func TestReadTargetFile(t *testing.T) {
+	file := `# Web servers
+example.com:443
+[2001:db8::1]:8443
+
+10.0.0.0/30:22
+mail.example.com
+`
+	targets, err := ReadTargetFile(strings.NewReader(file), []int{25, 587})
+	assert.NoError(t, err)
+	assert.Equal(t, []Target{
+		{Host: "example.com", Port: 443},
+		{Host: "2001:db8::1", Port: 8443},
+		{Host: "10.0.0.1", Port: 22},
+		{Host: "10.0.0.2", Port: 22},
+		{Host: "mail.example.com", Port: 25},
+		{Host: "mail.example.com", Port: 587},
+	}, targets)
+
+	_, err = ReadTargetFile(strings.NewReader("example.com:https\n"), nil)
+	assert.ErrorContains(t, err, "line 1")
+	_, err = ReadTargetFile(strings.NewReader("# no port\nexample.com\n"), nil)
+	assert.ErrorContains(t, err, "line 2")
+}
+
+func TestResolveTargets(t *testing.T) {
+	targets, err := ResolveTargets(t.Context(), net.DefaultResolver, []Target{
+		{Host: "127.0.0.2", Port: 22},
+		{Host: "localhost", Port: 443},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, Target{Host: "127.0.0.2", Port: 22}, targets[0])
+	if assert.Greater(t, len(targets), 1) {
+		for _, target := range targets[1:] {
+			assert.True(t, net.ParseIP(target.Host).IsLoopback(), "%s is not a loopback address", target.Host)
+			assert.Equal(t, 443, target.Port)
+			assert.Equal(t, "localhost", target.Hostname)
+		}
+	}
+}
+
+func TestHostRateLimiter(t *testing.T) {
+	limiter := newHostRateLimiter(20)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, limiter.wait(t.Context(), "a"))
+	}
+	// Other hosts are not delayed
+	assert.NoError(t, limiter.wait(t.Context(), "b"))
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	assert.ErrorIs(t, limiter.wait(ctx, "a"), context.Canceled)
+
+	unlimited := newHostRateLimiter(0)
+	start = time.Now()
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, unlimited.wait(t.Context(), "a"))
+	}
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+}
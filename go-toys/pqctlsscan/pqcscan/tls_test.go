@@ -1,10 +1,12 @@
-package main
+package pqcscan
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 	"testing"
 	"time"
 
@@ -57,11 +59,11 @@ func TestTLSKexAlgos(t *testing.T) {
 				defer srv.Stop()
 			}
 
-			nonPQState, nonPQErr := checkTLSPortOnce(serverHost, serverPort, false, true, timeout)
+			nonPQState, nonPQErr := checkTLSPortOnce(t.Context(), serverHost, "", serverPort, "", false, true, timeout)
 			if nonPQErr == nil {
 				assert.Equal(t, tc.expectedNonPqcOk, nonPQState != nil, "NonPQKex completed")
 			}
-			pqState, pqErr := checkTLSPortOnce(serverHost, serverPort, true, false, timeout)
+			pqState, pqErr := checkTLSPortOnce(t.Context(), serverHost, "", serverPort, "", true, false, timeout)
 			if pqErr == nil {
 				assert.Equal(t, tc.expectedPqcOk, pqState != nil, "PQKex completed")
 			}
@@ -80,12 +82,12 @@ func TestTLSTimeout(t *testing.T) {
 	}
 	defer ln.Close()
 
-	r := checkTLSPort(serverHost, serverPort, time.Millisecond*100)
+	r := checkTLSPort(t.Context(), serverHost, "", serverPort, "", time.Millisecond*100)
 	assert.Equal(t, NoConn, r.PortType)
 }
 
 func TestTLSNetworkError(t *testing.T) {
-	r := checkTLSPort(serverHost, serverPort+1, time.Millisecond*100)
+	r := checkTLSPort(t.Context(), serverHost, "", serverPort+1, "", time.Millisecond*100)
 	assert.Equal(t, NoConn, r.PortType)
 }
 
@@ -97,6 +99,33 @@ func TestNonTLSPort(t *testing.T) {
 
 	tcpAddr := ts.Listener.Addr().(*net.TCPAddr)
 
-	r := checkTLSPort(tcpAddr.IP.String(), tcpAddr.Port, time.Millisecond*100)
+	r := checkTLSPort(t.Context(), tcpAddr.IP.String(), "", tcpAddr.Port, "", time.Millisecond*100)
 	assert.Equal(t, Other, r.PortType)
 }
+
+func TestTLSServerName(t *testing.T) {
+	var mu sync.Mutex
+	var serverNames []string
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.TLS = &tls.Config{GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		mu.Lock()
+		serverNames = append(serverNames, hello.ServerName)
+		mu.Unlock()
+		return nil, nil
+	}}
+	ts.StartTLS()
+	defer ts.Close()
+
+	tcpAddr := ts.Listener.Addr().(*net.TCPAddr)
+	target := Target{Host: tcpAddr.IP.String(), Port: tcpAddr.Port, Hostname: "scan.example"}
+	assert.Equal(t, "scan.example", target.ServerName())
+	r := checkTLSPort(t.Context(), target.Host, target.ServerName(), target.Port, "", time.Second)
+	assert.Equal(t, TLS, r.PortType)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.NotEmpty(t, serverNames)
+	for _, name := range serverNames {
+		assert.Equal(t, "scan.example", name)
+	}
+}
@@ -0,0 +1,385 @@
+package pqcscan
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"time"
+)
+
+// Key exchange groups not defined by crypto/tls of the Go version in go.mod
+const (
+	groupSecP256r1MLKEM768     = tls.CurveID(0x11eb)
+	groupSecP384r1MLKEM1024    = tls.CurveID(0x11ed)
+	groupMLKEM512              = tls.CurveID(0x0200)
+	groupMLKEM768              = tls.CurveID(0x0201)
+	groupMLKEM1024             = tls.CurveID(0x0202)
+	groupX25519Kyber768Draft00 = tls.CurveID(0x6399)
+)
+
+// tlsGroup is a key exchange group probed by enumerateTLSGroups
+type tlsGroup struct {
+	ID tls.CurveID
+	PQ bool // Post-quantum or hybrid
+}
+
+// probedTLSGroups are the groups enumerateTLSGroups checks one by one, post-quantum groups first
+var probedTLSGroups = []tlsGroup{
+	{tls.X25519MLKEM768, true},
+	{groupSecP256r1MLKEM768, true},
+	{groupSecP384r1MLKEM1024, true},
+	{groupX25519Kyber768Draft00, true},
+	{groupMLKEM512, true},
+	{groupMLKEM768, true},
+	{groupMLKEM1024, true},
+	{tls.X25519, false},
+	{tls.CurveP256, false},
+	{tls.CurveP384, false},
+	{tls.CurveP521, false},
+}
+
+func isPQGroup(id tls.CurveID) bool {
+	for _, g := range probedTLSGroups {
+		if g.ID == id {
+			return g.PQ
+		}
+	}
+	return false
+}
+
+// IsPQGroupName reports whether the group name, as in TLSGroupInfo, is a post-quantum or hybrid group
+func IsPQGroupName(name string) bool {
+	for _, g := range probedTLSGroups {
+		if curveName(g.ID) == name {
+			return g.PQ
+		}
+	}
+	return false
+}
+
+// TLSGroupInfo is the key exchange group support of a TLS server
+type TLSGroupInfo struct {
+	TLS13 bool `json:"tls13"` // False if the server answered with TLS 1.2
+
+	// Supported lists every supported group, in the order of probedTLSGroups
+	Supported []string `json:"supported"`
+
+	// Preference is the order the server picks the supported groups in.
+	// Empty if the server follows the client's order, or for TLS 1.2.
+	Preference []string `json:"preference,omitempty"`
+
+	// ServerPreference is true if the server picks by its own order, not by the client's
+	ServerPreference bool `json:"serverPreference"`
+
+	// HelloRetryGroup is the group requested with a HelloRetryRequest when the client
+	// sends only an X25519 key share. Empty if the server accepted the X25519 key share.
+	HelloRetryGroup string `json:"helloRetryGroup,omitempty"`
+}
+
+// hasPQGroup reports whether a post-quantum or hybrid group is supported
+func (info *TLSGroupInfo) hasPQGroup() bool {
+	for _, g := range probedTLSGroups {
+		if g.PQ && slices.Contains(info.Supported, curveName(g.ID)) {
+			return true
+		}
+	}
+	return false
+}
+
+// enumerateTLSGroups checks every group of probedTLSGroups with a separate connection.
+//
+// The ClientHellos carry no key shares, so a TLS 1.3 server either answers with a
+// HelloRetryRequest naming the group it selected, or rejects the handshake. No key
+// exchange is done, so groups unknown to crypto/tls can be probed too.
+func enumerateTLSGroups(ctx context.Context, host, serverName string, port int, starttls string, timeout time.Duration) (*TLSGroupInfo, error) {
+	info := new(TLSGroupInfo)
+	var supported []tls.CurveID
+	for _, g := range probedTLSGroups {
+		if err := ctx.Err(); err != nil {
+			// A closed connection would look like a rejected group
+			return nil, err
+		}
+		reply, err := sendClientHello(ctx, host, serverName, port, starttls, []tls.CurveID{g.ID}, false, timeout)
+		if err != nil {
+			if isNetworkError(err) {
+				return nil, err
+			}
+			continue
+		}
+		if reply.rejected {
+			continue
+		}
+		if reply.tls13 {
+			info.TLS13 = true
+			if reply.group != g.ID {
+				// The server picked a group that wasn't offered
+				continue
+			}
+		} else if isPQGroup(g.ID) {
+			// A TLS 1.2 ServerHello can only use the offered group if it's an elliptic curve
+			continue
+		}
+		supported = append(supported, g.ID)
+		info.Supported = append(info.Supported, curveName(g.ID))
+	}
+	if !info.TLS13 || len(supported) == 0 {
+		return info, nil
+	}
+
+	// Order of preference: offer the remaining groups and see which one is picked
+	remaining := slices.Clone(supported)
+	var order []tls.CurveID
+	for len(remaining) > 1 {
+		reply, err := sendClientHello(ctx, host, serverName, port, starttls, remaining, false, timeout)
+		if err != nil || reply.rejected || !reply.tls13 || !slices.Contains(remaining, reply.group) {
+			order = nil
+			break
+		}
+		order = append(order, reply.group)
+		remaining = slices.DeleteFunc(remaining, func(id tls.CurveID) bool { return id == reply.group })
+	}
+	if order != nil {
+		order = append(order, remaining...)
+		// A server following the client's order picks differently when the offer is reversed
+		reversed := slices.Clone(supported)
+		slices.Reverse(reversed)
+		reply, err := sendClientHello(ctx, host, serverName, port, starttls, reversed, false, timeout)
+		if err == nil && !reply.rejected && reply.tls13 && reply.group == order[0] {
+			info.ServerPreference = true
+			for _, id := range order {
+				info.Preference = append(info.Preference, curveName(id))
+			}
+		}
+	} else if len(supported) == 1 {
+		info.ServerPreference = true
+		info.Preference = info.Supported
+	}
+
+	// HelloRetryRequest behaviour towards a client guessing a classic key share
+	if slices.Contains(supported, tls.X25519) {
+		reply, err := sendClientHello(ctx, host, serverName, port, starttls, supported, true, timeout)
+		if err == nil && !reply.rejected && reply.helloRetry {
+			info.HelloRetryGroup = curveName(reply.group)
+		}
+	}
+	return info, nil
+}
+
+// serverHelloReply is the relevant part of the server's answer to a ClientHello
+type serverHelloReply struct {
+	rejected   bool // Alert or closed connection
+	tls13      bool
+	helloRetry bool
+	group      tls.CurveID // Selected group of a TLS 1.3 ServerHello or HelloRetryRequest
+}
+
+// helloRetryRequestRandom is the special ServerHello.random of a HelloRetryRequest (RFC 8446 4.1.3)
+var helloRetryRequestRandom = []byte{
+	0xcf, 0x21, 0xad, 0x74, 0xe5, 0x9a, 0x61, 0x11, 0xbe, 0x1d, 0x8c, 0x02, 0x1e, 0x65, 0xb8, 0x91,
+	0xc2, 0xa2, 0x11, 0x16, 0x7a, 0xbb, 0x8c, 0x5e, 0x07, 0x9e, 0x09, 0xe2, 0xc8, 0xa8, 0x33, 0x9c,
+}
+
+// TLS extension types (RFC 8446 4.2)
+const (
+	extServerName          = 0
+	extSupportedGroups     = 10
+	extECPointFormats      = 11
+	extSignatureAlgorithms = 13
+	extSupportedVersions   = 43
+	extKeyShare            = 51
+)
+
+// sendClientHello sends a ClientHello offering the groups and reads the ServerHello.
+// serverName is sent in the SNI extension, if not empty.
+// With x25519Share the ClientHello carries a key share for X25519, otherwise none.
+func sendClientHello(ctx context.Context, host, serverName string, port int, starttls string, groups []tls.CurveID, x25519Share bool, timeout time.Duration) (*serverHelloReply, error) {
+	conn, err := dialTLSPort(ctx, host, serverName, port, starttls, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	hello, err := marshalClientHello(serverName, groups, x25519Share)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(hello); err != nil {
+		return nil, err
+	}
+	return readServerHello(conn)
+}
+
+func marshalClientHello(serverName string, groups []tls.CurveID, x25519Share bool) ([]byte, error) {
+	random := make([]byte, 32+32)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+
+	var exts []byte
+	if serverName != "" {
+		name := appendUint16Prefixed(nil, []byte(serverName))
+		exts = appendExtension(exts, extServerName, appendUint16Prefixed(nil, append([]byte{0}, name...)))
+	}
+	var groupList []byte
+	for _, g := range groups {
+		groupList = binary.BigEndian.AppendUint16(groupList, uint16(g))
+	}
+	exts = appendExtension(exts, extSupportedGroups, appendUint16Prefixed(nil, groupList))
+	exts = appendExtension(exts, extECPointFormats, []byte{1, 0})
+	var sigAlgs []byte
+	for _, s := range []tls.SignatureScheme{
+		tls.ECDSAWithP256AndSHA256, tls.ECDSAWithP384AndSHA384, tls.ECDSAWithP521AndSHA512, tls.Ed25519,
+		tls.PSSWithSHA256, tls.PSSWithSHA384, tls.PSSWithSHA512,
+		tls.PKCS1WithSHA256, tls.PKCS1WithSHA384, tls.PKCS1WithSHA512,
+	} {
+		sigAlgs = binary.BigEndian.AppendUint16(sigAlgs, uint16(s))
+	}
+	exts = appendExtension(exts, extSignatureAlgorithms, appendUint16Prefixed(nil, sigAlgs))
+	exts = appendExtension(exts, extSupportedVersions, []byte{4, 0x03, 0x04, 0x03, 0x03})
+	var shares []byte
+	if x25519Share {
+		// Any 32 bytes are a valid X25519 public key; the handshake is never finished
+		shares = binary.BigEndian.AppendUint16(shares, uint16(tls.X25519))
+		shares = appendUint16Prefixed(shares, random[:32])
+	}
+	exts = appendExtension(exts, extKeyShare, appendUint16Prefixed(nil, shares))
+
+	var body []byte
+	body = append(body, 0x03, 0x03) // legacy_version
+	body = append(body, random[:32]...)
+	body = append(body, 32)
+	body = append(body, random[32:]...) // legacy_session_id for middlebox compatibility
+	var suites []byte
+	for _, s := range []uint16{
+		tls.TLS_AES_128_GCM_SHA256, tls.TLS_AES_256_GCM_SHA384, tls.TLS_CHACHA20_POLY1305_SHA256,
+		// Only ECDHE suites, so a TLS 1.2 server has to use one of the offered curves
+		tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384, tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256, tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+	} {
+		suites = binary.BigEndian.AppendUint16(suites, s)
+	}
+	body = appendUint16Prefixed(body, suites)
+	body = append(body, 1, 0) // null compression
+	body = appendUint16Prefixed(body, exts)
+
+	msg := []byte{1, byte(len(body) >> 16), byte(len(body) >> 8), byte(len(body))} // client_hello
+	msg = append(msg, body...)
+	record := []byte{0x16, 0x03, 0x01}
+	return appendUint16Prefixed(record, msg), nil
+}
+
+func appendUint16Prefixed(b, data []byte) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(data)))
+	return append(b, data...)
+}
+
+func appendExtension(b []byte, extType uint16, data []byte) []byte {
+	b = binary.BigEndian.AppendUint16(b, extType)
+	return appendUint16Prefixed(b, data)
+}
+
+var errMalformedServerHello = errors.New("malformed ServerHello")
+
+// maxServerHelloLen limits the buffered handshake data of readServerHello
+const maxServerHelloLen = 64 * 1024
+
+// readServerHello reads the first handshake message of the server.
+// The message may be fragmented into several records (RFC 8446 5.1).
+func readServerHello(r io.Reader) (*serverHelloReply, error) {
+	var stream []byte // Handshake data of the records read so far
+	for {
+		header := make([]byte, 5)
+		if _, err := io.ReadFull(r, header); err != nil {
+			if len(stream) > 0 {
+				return nil, err
+			}
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, net.ErrClosed) {
+				return &serverHelloReply{rejected: true}, nil
+			}
+			var netErr *net.OpError
+			if errors.As(err, &netErr) && !netErr.Timeout() {
+				// Reset after the ClientHello
+				return &serverHelloReply{rejected: true}, nil
+			}
+			return nil, err
+		}
+		if !isTLSRecordHeader(header) {
+			return nil, errors.New("not a TLS server")
+		}
+		if header[0] == 0x15 {
+			return &serverHelloReply{rejected: true}, nil
+		}
+		record := make([]byte, binary.BigEndian.Uint16(header[3:]))
+		if _, err := io.ReadFull(r, record); err != nil {
+			return nil, err
+		}
+		stream = append(stream, record...)
+
+		if msg, ok := completeHandshakeMessage(stream); ok {
+			if msg[0] != 2 { // server_hello
+				return nil, errMalformedServerHello
+			}
+			return parseServerHello(msg[4:])
+		}
+		if len(stream) > maxServerHelloLen {
+			return nil, fmt.Errorf("%w: longer than %d bytes", errMalformedServerHello, maxServerHelloLen)
+		}
+	}
+}
+
+func parseServerHello(msg []byte) (*serverHelloReply, error) {
+	reply := new(serverHelloReply)
+	// legacy_version, random, legacy_session_id_echo
+	if len(msg) < 2+32+1 {
+		return nil, errMalformedServerHello
+	}
+	reply.helloRetry = bytes.Equal(msg[2:34], helloRetryRequestRandom)
+	msg = msg[34:]
+	sessionIDLen := int(msg[0])
+	// session id, cipher_suite, legacy_compression_method
+	if len(msg) < 1+sessionIDLen+3 {
+		return nil, errMalformedServerHello
+	}
+	msg = msg[1+sessionIDLen+3:]
+	if len(msg) < 2 {
+		// TLS 1.2 without extensions
+		return reply, nil
+	}
+	extLen := int(binary.BigEndian.Uint16(msg))
+	exts := msg[2:]
+	if len(exts) < extLen {
+		return nil, errMalformedServerHello
+	}
+	exts = exts[:extLen]
+	for len(exts) >= 4 {
+		extType := binary.BigEndian.Uint16(exts)
+		dataLen := int(binary.BigEndian.Uint16(exts[2:]))
+		if len(exts) < 4+dataLen {
+			return nil, errMalformedServerHello
+		}
+		data := exts[4 : 4+dataLen]
+		exts = exts[4+dataLen:]
+		switch extType {
+		case extSupportedVersions:
+			reply.tls13 = len(data) == 2 && binary.BigEndian.Uint16(data) == tls.VersionTLS13
+		case extKeyShare:
+			// selected_group of a HelloRetryRequest, or the group of the server's KeyShareEntry
+			if len(data) < 2 {
+				return nil, errMalformedServerHello
+			}
+			reply.group = tls.CurveID(binary.BigEndian.Uint16(data))
+		}
+	}
+	if reply.helloRetry && !reply.tls13 {
+		return nil, fmt.Errorf("%w: HelloRetryRequest without TLS 1.3", errMalformedServerHello)
+	}
+	return reply, nil
+}
@@ -0,0 +1,120 @@
+package pqcscan
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnumerateTLSGroups(t *testing.T) {
+	srv := TLSServer{
+		ListenAddr: fmt.Sprintf("%s:%d", serverHost, serverPort),
+		Curves:     []tls.CurveID{groupSecP256r1MLKEM768, tls.X25519, tls.CurveP384},
+	}
+	if err := srv.Start(t.Context()); err != nil {
+		t.Fatalf("failed to start TLS server: %+v", err)
+	}
+	defer srv.Stop()
+
+	info, err := enumerateTLSGroups(t.Context(), serverHost, "", serverPort, "", timeout)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, info.TLS13)
+	assert.Equal(t, []string{"SecP256r1MLKEM768", "X25519", "P-384"}, info.Supported)
+	assert.True(t, info.ServerPreference)
+	assert.Equal(t, []string{"SecP256r1MLKEM768", "X25519", "P-384"}, info.Preference)
+	assert.Equal(t, "SecP256r1MLKEM768", info.HelloRetryGroup)
+	assert.True(t, info.hasPQGroup())
+
+	result := checkTLSPort(t.Context(), serverHost, "", serverPort, "", timeout)
+	assert.Equal(t, TLS, result.PortType)
+	assert.True(t, result.IsPQKexSupported, "the hybrid is not X25519MLKEM768, but still PQ")
+	assert.Equal(t, info, result.TLSGroups)
+}
+
+func TestEnumerateTLSGroupsClassicOnly(t *testing.T) {
+	srv := TLSServer{
+		ListenAddr: fmt.Sprintf("%s:%d", serverHost, serverPort),
+		Curves:     []tls.CurveID{tls.CurveP256},
+	}
+	if err := srv.Start(t.Context()); err != nil {
+		t.Fatalf("failed to start TLS server: %+v", err)
+	}
+	defer srv.Stop()
+
+	info, err := enumerateTLSGroups(t.Context(), serverHost, "", serverPort, "", timeout)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"P-256"}, info.Supported)
+	assert.Equal(t, []string{"P-256"}, info.Preference)
+	assert.Empty(t, info.HelloRetryGroup)
+	assert.False(t, info.hasPQGroup())
+}
+
+func TestParseServerHello(t *testing.T) {
+	// HelloRetryRequest selecting X25519MLKEM768
+	var msg []byte
+	msg = append(msg, 0x03, 0x03)
+	msg = append(msg, helloRetryRequestRandom...)
+	msg = append(msg, 0)          // legacy_session_id_echo
+	msg = append(msg, 0x13, 0x01) // cipher_suite
+	msg = append(msg, 0)          // legacy_compression_method
+	var exts []byte
+	exts = appendExtension(exts, extSupportedVersions, []byte{0x03, 0x04})
+	exts = appendExtension(exts, extKeyShare, []byte{0x11, 0xec})
+	msg = appendUint16Prefixed(msg, exts)
+	record := []byte{0x16, 0x03, 0x03}
+	record = appendUint16Prefixed(record, append([]byte{2, 0, byte(len(msg) >> 8), byte(len(msg))}, msg...))
+
+	reply, err := readServerHello(bytes.NewReader(record))
+	if assert.NoError(t, err) {
+		assert.Equal(t, &serverHelloReply{tls13: true, helloRetry: true, group: tls.X25519MLKEM768}, reply)
+	}
+
+	// Fragmented into two records
+	handshake := record[5:]
+	fragmented := appendUint16Prefixed([]byte{0x16, 0x03, 0x03}, handshake[:10])
+	fragmented = append(fragmented, appendUint16Prefixed([]byte{0x16, 0x03, 0x03}, handshake[10:])...)
+	reply, err = readServerHello(bytes.NewReader(fragmented))
+	if assert.NoError(t, err) {
+		assert.Equal(t, &serverHelloReply{tls13: true, helloRetry: true, group: tls.X25519MLKEM768}, reply)
+	}
+	_, err = readServerHello(bytes.NewReader(fragmented[:15]))
+	assert.Error(t, err)
+
+	// Alert
+	reply, err = readServerHello(bytes.NewReader([]byte{0x15, 0x03, 0x03, 0, 2, 2, 40}))
+	if assert.NoError(t, err) {
+		assert.True(t, reply.rejected)
+	}
+
+	_, err = readServerHello(bytes.NewReader(record[:len(record)-3]))
+	assert.Error(t, err)
+	_, err = readServerHello(bytes.NewReader([]byte("HTTP/1.1 400 Bad Request\r\n")))
+	assert.Error(t, err)
+}
+
+func TestCheckTLSPortUnknownHybridOnly(t *testing.T) {
+	srv := TLSServer{
+		ListenAddr: fmt.Sprintf("%s:%d", serverHost, serverPort),
+		Curves:     []tls.CurveID{groupSecP384r1MLKEM1024},
+	}
+	if err := srv.Start(t.Context()); err != nil {
+		t.Fatalf("failed to start TLS server: %+v", err)
+	}
+	defer srv.Stop()
+
+	// Neither handshake of crypto/tls succeeds, only the enumeration finds the group
+	result := checkTLSPort(t.Context(), serverHost, "", serverPort, "", timeout)
+	assert.Equal(t, TLS, result.PortType)
+	assert.True(t, result.IsPQKexSupported)
+	assert.False(t, result.IsNonPQKexSupported)
+	if assert.NotNil(t, result.TLSGroups) {
+		assert.Equal(t, []string{"SecP384r1MLKEM1024"}, result.TLSGroups.Supported)
+	}
+}
@@ -1,14 +1,17 @@
-package main
+package pqcscan
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
-	"net"
 	"time"
 )
 
-func checkTLSPort(host string, port int, timeout time.Duration) (result ScanResult) {
+// checkTLSPort probes the key exchanges and the certificate chain of a TLS port.
+// serverName is sent in the SNI extension, if not empty.
+// A non-empty starttls names the protocol to upgrade the plaintext connection with.
+func checkTLSPort(ctx context.Context, host, serverName string, port int, starttls string, timeout time.Duration) (result ScanResult) {
 	result.Address = host
 	result.Port = port
 	result.PortType = Other
@@ -24,7 +27,7 @@ func checkTLSPort(host string, port int, timeout time.Duration) (result ScanResu
 		}
 	}()
 
-	tlsState, err := checkTLSPortOnce(host, port, false, true, timeout)
+	tlsState, err := checkTLSPortOnce(ctx, host, serverName, port, starttls, false, true, timeout)
 	if err != nil && isNetworkError(err) {
 		result.PortType = NoConn
 		result.Error = err.Error()
@@ -34,16 +37,29 @@ func checkTLSPort(host string, port int, timeout time.Duration) (result ScanResu
 		result.PortType = TLS
 		result.IsNonPQKexSupported = true
 		result.ServerCertKeyAlgo = tlsState.PeerCertificates[0].PublicKeyAlgorithm.String()
+		result.CertChain = newCertChain(tlsState.PeerCertificates)
 	}
-	tlsState, err = checkTLSPortOnce(host, port, true, false, timeout)
+	tlsState, err = checkTLSPortOnce(ctx, host, serverName, port, starttls, true, false, timeout)
 	if err != nil && !isNetworkError(err) {
-		result.PortType = Other
-		return
-	}
-	if err == nil {
+		// A failed PQ handshake doesn't make a classic TLS port something else
+		if !result.IsNonPQKexSupported {
+			result.PortType = Other
+		}
+	} else if err == nil {
 		result.PortType = TLS
 		result.IsPQKexSupported = true
 		result.ServerCertKeyAlgo = tlsState.PeerCertificates[0].PublicKeyAlgorithm.String()
+		result.CertChain = newCertChain(tlsState.PeerCertificates)
+	}
+
+	// Servers supporting only groups unknown to crypto/tls fail both handshakes above
+	groups, err := enumerateTLSGroups(ctx, host, serverName, port, starttls, timeout)
+	if err == nil && len(groups.Supported) > 0 {
+		result.PortType = TLS
+		result.TLSGroups = groups
+		if groups.hasPQGroup() {
+			result.IsPQKexSupported = true
+		}
 	}
 
 	return
@@ -65,16 +81,11 @@ func selectCurves(allowPQCKex bool, allowNonPQCKex bool) ([]tls.CurveID, error)
 	}
 }
 
-func checkTLSPortOnce(host string, port int, allowPQCKex bool, allowNonPQCKex bool, timeout time.Duration) (*tls.ConnectionState, error) {
-	// Create a Dialer with the specified timeout
-	dialer := &net.Dialer{
-		Timeout: timeout,
-	}
-
+func checkTLSPortOnce(ctx context.Context, host, serverName string, port int, starttls string, allowPQCKex bool, allowNonPQCKex bool, timeout time.Duration) (*tls.ConnectionState, error) {
 	// Create a TLS configuration
 	tlsConfig := &tls.Config{
 		InsecureSkipVerify: true, // Set to true for testing purposes only
-
+		ServerName:         serverName,
 	}
 	c, err := selectCurves(allowPQCKex, allowNonPQCKex)
 	if err != nil {
@@ -82,12 +93,18 @@ func checkTLSPortOnce(host string, port int, allowPQCKex bool, allowNonPQCKex bo
 	}
 	tlsConfig.CurvePreferences = c
 
-	// Establish a TLS connection
-	conn, err := tls.DialWithDialer(dialer, "tcp", fmt.Sprintf("%s:%d", host, port), tlsConfig)
+	// Connect, upgrade with STARTTLS if needed
+	rawConn, err := dialTLSPort(ctx, host, serverName, port, starttls, timeout)
 	if err != nil {
 		return nil, err
 	}
+
+	// Establish a TLS connection
+	conn := tls.Client(rawConn, tlsConfig)
 	defer conn.Close()
+	if err := conn.Handshake(); err != nil {
+		return nil, err
+	}
 	tlsState := conn.ConnectionState()
 	if !tlsState.HandshakeComplete {
 		return nil, errors.New("TLS handshake failed")
@@ -107,7 +124,17 @@ func curveName(curveID tls.CurveID) string {
 		return "X25519"
 	case tls.X25519MLKEM768:
 		return "X25519MLKEM768"
-	case 0x6399:
+	case groupSecP256r1MLKEM768:
+		return "SecP256r1MLKEM768"
+	case groupSecP384r1MLKEM1024:
+		return "SecP384r1MLKEM1024"
+	case groupMLKEM512:
+		return "MLKEM512"
+	case groupMLKEM768:
+		return "MLKEM768"
+	case groupMLKEM1024:
+		return "MLKEM1024"
+	case groupX25519Kyber768Draft00:
 		return "X25519Kyber768Draft00"
 	default:
 		return fmt.Sprintf("Unknown Curve ID: %d", curveID)
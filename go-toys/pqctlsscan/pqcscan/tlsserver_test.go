@@ -1,4 +1,4 @@
-package main
+package pqcscan
 
 import (
 	"context"
@@ -22,6 +22,7 @@ type TLSServer struct {
 	AllowPQCipher     bool
 	AllowNonPQCiphers bool
 	MutualTLSRequired bool
+	Curves            []tls.CurveID // Overrides AllowPQCipher and AllowNonPQCiphers, in order of preference
 	ln                net.Listener
 	tlsLn             net.Listener
 	serveCh           chan struct{}
@@ -109,6 +110,9 @@ func (s *TLSServer) Stop() {
 }
 
 func (s *TLSServer) selectCurves() ([]tls.CurveID, error) {
+	if len(s.Curves) > 0 {
+		return s.Curves, nil
+	}
 	switch {
 	case s.AllowPQCipher && !s.AllowNonPQCiphers:
 		// Force hybrid only
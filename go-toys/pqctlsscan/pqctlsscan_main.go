@@ -1,67 +1,20 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
+	"net"
 	"os"
-	"sort"
 	"strings"
-	"sync"
 	"time"
-)
-
-// scanPorts scans a range of ports using multiple goroutines
-func scanPorts(host string, start, end int, timeout time.Duration, concurrency int) []ScanResult {
-	var results []ScanResult
-	var wg sync.WaitGroup
-
-	// Create a buffered channel to collect results
-	resultChan := make(chan ScanResult, end-start+1)
-
-	// Create a semaphore to limit concurrent goroutines
-	semaphore := make(chan struct{}, concurrency)
-
-	// Launch goroutines for each port
-	for port := start; port <= end; port++ {
-		wg.Add(1)
-		go func(p int) {
-			defer wg.Done()
-
-			// Acquire semaphore
-			semaphore <- struct{}{}
-			defer func() { <-semaphore }()
-
-			result := checkTLSPort(host, p, timeout)
-			resultChan <- result
-		}(port)
-	}
-
-	// Close channel when all goroutines complete
-	go func() {
-		wg.Wait()
-		close(resultChan)
-	}()
-
-	// Collect results from channel
-	for result := range resultChan {
-		if result.Error == "" {
-			results = append(results, result)
-		}
-	}
 
-	// Sort results by port number for better readability
-	sort.Slice(results, func(i, j int) bool {
-		if results[i].Address < results[j].Address {
-			return true
-		}
-		return results[i].Port < results[j].Port
-	})
-
-	return results
-}
+	"github.com/bukodi/playground/pqctlsscan/pqcscan"
+)
 
-func outputText(w *os.File, results []ScanResult, elapsed time.Duration, verbose bool) {
+func outputText(w io.Writer, results []pqcscan.ScanResult, elapsed time.Duration, verbose bool) {
 	fmt.Fprintf(w, "\nScan completed in %s\n", elapsed)
 	fmt.Fprintf(w, "Found %d open ports:\n\n", len(results))
 
@@ -70,25 +23,92 @@ func outputText(w *os.File, results []ScanResult, elapsed time.Duration, verbose
 		return
 	}
 
-	fmt.Fprintf(w, "HOST            \t  PORT\tTYPE  \tERROR \n")
-	fmt.Fprintf(w, "----------------\t------\t-------\t------\n")
+	fmt.Fprintf(w, "HOST            \t  PORT\tTYPE  \tPQ KEX\tNON-PQ KEX\tQ-RISK\tERROR \n")
+	fmt.Fprintf(w, "----------------\t------\t-------\t------\t----------\t------\t------\n")
 
 	for _, result := range results {
-		fmt.Fprintf(w, "%-16s\t%6d\t%s\t%s\n",
+		fmt.Fprintf(w, "%-16s\t%6d\t%s\t%s\t%s\t%s\t%s\n",
 			result.Address,
 			result.Port,
-			result.PortType,
+			portTypeLabel(result),
+			yesNo(result.IsPQKexSupported),
+			yesNo(result.IsNonPQKexSupported),
+			riskLevel(result.QuantumRisk),
 			result.Error)
+		if verbose && result.TLSGroups != nil {
+			outputTLSGroups(w, result.TLSGroups)
+		}
+		if verbose && result.SSH != nil {
+			outputSSHInfo(w, result.SSH)
+		}
+		if verbose {
+			outputCertChain(w, result.CertChain)
+			if result.QuantumRisk != nil && len(result.QuantumRisk.Reasons) > 0 {
+				fmt.Fprintf(w, "    Quantum risk: %s\n", strings.Join(result.QuantumRisk.Reasons, "; "))
+			}
+		}
+	}
+}
+
+// portTypeLabel shows the STARTTLS protocol next to the port type
+func portTypeLabel(result pqcscan.ScanResult) string {
+	if result.StartTLS != "" {
+		return fmt.Sprintf("%s+%s", result.PortType, result.StartTLS)
 	}
+	return string(result.PortType)
 }
 
-func outputJSON(w *os.File, results []ScanResult, elapsed time.Duration) {
-	output := struct {
-		ScanTime    string       `json:"scan_time"`
-		ElapsedTime string       `json:"elapsed_time"`
-		OpenPorts   int          `json:"open_tls_ports"`
-		Results     []ScanResult `json:"results"`
-	}{
+func riskLevel(risk *pqcscan.QuantumRisk) string {
+	if risk == nil {
+		return "-"
+	}
+	return risk.Level
+}
+
+// outputCertChain prints the presented certificates below the row of the port
+func outputCertChain(w io.Writer, chain []pqcscan.CertInfo) {
+	for i, cert := range chain {
+		keyType := cert.KeyType
+		if cert.KeyBits > 0 {
+			keyType = fmt.Sprintf("%s %d", cert.KeyType, cert.KeyBits)
+		}
+		fmt.Fprintf(w, "    Cert %d: %s (issuer: %s, key: %s, signature: %s, expires: %s)\n",
+			i, cert.Subject, cert.Issuer, keyType, cert.SignatureAlgorithm, cert.NotAfter.Format(time.DateOnly))
+	}
+}
+
+// outputTLSGroups prints the group enumeration below the row of the port
+func outputTLSGroups(w io.Writer, groups *pqcscan.TLSGroupInfo) {
+	fmt.Fprintf(w, "    Groups: %s\n", strings.Join(groups.Supported, ", "))
+	switch {
+	case !groups.TLS13:
+		fmt.Fprintf(w, "    TLS 1.3 not supported\n")
+	case groups.ServerPreference:
+		fmt.Fprintf(w, "    Server preference: %s\n", strings.Join(groups.Preference, " > "))
+	default:
+		fmt.Fprintf(w, "    Server follows the client's preference\n")
+	}
+	if groups.HelloRetryGroup != "" {
+		fmt.Fprintf(w, "    HelloRetryRequest for %s when the client sends an X25519 key share\n", groups.HelloRetryGroup)
+	}
+}
+
+// outputSSHInfo prints the SSH algorithm inventory below the row of the port
+func outputSSHInfo(w io.Writer, info *pqcscan.SSHInfo) {
+	fmt.Fprintf(w, "    Banner: %s\n", info.Banner)
+	if info.HostKeyType != "" {
+		fmt.Fprintf(w, "    Host key: %s %s\n", info.HostKeyType, info.HostKeyFingerprint)
+	}
+	fmt.Fprintf(w, "    Kex: %s\n", strings.Join(info.KexAlgorithms, ", "))
+	fmt.Fprintf(w, "    Host key algorithms: %s\n", strings.Join(info.HostKeyAlgorithms, ", "))
+	fmt.Fprintf(w, "    Ciphers: %s\n", strings.Join(info.CiphersServerClient, ", "))
+	fmt.Fprintf(w, "    MACs: %s\n", strings.Join(info.MACsServerClient, ", "))
+	fmt.Fprintf(w, "    Compression: %s\n", strings.Join(info.CompressionServerClient, ", "))
+	fmt.Fprintf(w, "    mlkem768x25519: %s, sntrup761x25519: %s\n", yesNo(info.MLKEM768X25519), yesNo(info.SNTRUP761X25519))
+}
+
+func outputJSON(w io.Writer, results []pqcscan.ScanResult, elapsed time.Duration) error {
+	output := scanReport{
 		ScanTime:    time.Now().Format(time.RFC3339),
 		ElapsedTime: elapsed.String(),
 		OpenPorts:   len(results),
@@ -97,23 +117,52 @@ func outputJSON(w *os.File, results []ScanResult, elapsed time.Duration) {
 
 	encoder := json.NewEncoder(w)
 	encoder.SetIndent("", "  ")
-	encoder.Encode(output)
+	return encoder.Encode(output)
 }
 
-func outputCSV(w *os.File, results []ScanResult, elapsed time.Duration, verbose bool) {
-	fmt.Fprintf(w, "Host,Port,Type\n")
+func outputCSV(w io.Writer, results []pqcscan.ScanResult, elapsed time.Duration, verbose bool) {
+	fmt.Fprintf(w, "Host,Hostname,Port,Type,StartTLS,PQKex,NonPQKex,Groups,GroupPreference,HelloRetryGroup,CertKey,CertSignature,QuantumRisk,Error\n")
 
 	for _, result := range results {
-		fmt.Fprintf(w, "%s,%d,%s\n",
-			result.Address,
+		var groups, preference, helloRetry string
+		if result.TLSGroups != nil {
+			groups = strings.Join(result.TLSGroups.Supported, ";")
+			preference = strings.Join(result.TLSGroups.Preference, ";")
+			helloRetry = result.TLSGroups.HelloRetryGroup
+		}
+		var certKey, certSignature string
+		if len(result.CertChain) > 0 {
+			certKey = result.CertChain[0].KeyType
+			certSignature = result.CertChain[0].SignatureAlgorithm
+		}
+		fmt.Fprintf(w, "%s,%s,%d,%s,%s,%t,%t,%s,%s,%s,%s,%s,%s,%s\n",
+			escapeCSV(result.Address),
+			escapeCSV(result.Hostname),
 			result.Port,
-			result.PortType)
+			result.PortType,
+			result.StartTLS,
+			result.IsPQKexSupported,
+			result.IsNonPQKexSupported,
+			escapeCSV(groups),
+			escapeCSV(preference),
+			escapeCSV(helloRetry),
+			escapeCSV(certKey),
+			escapeCSV(certSignature),
+			riskLevel(result.QuantumRisk),
+			escapeCSV(result.Error))
 	}
 
 	fmt.Fprintf(w, "\n# Scan completed in %s, found %d open ports\n",
 		elapsed, len(results))
 }
 
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
 func escapeCSV(s string) string {
 	if strings.Contains(s, ",") || strings.Contains(s, "\"") || strings.Contains(s, "\n") {
 		return "\"" + strings.ReplaceAll(s, "\"", "\"\"") + "\""
@@ -122,50 +171,128 @@ func escapeCSV(s string) string {
 }
 
 func main2() {
-	hostPtr := flag.String("host", "", "Target host to scan (required)")
+	if len(os.Args) > 1 && os.Args[1] == "diff" {
+		os.Exit(runDiff(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
+	hostPtr := flag.String("host", "", "Target hosts to scan: comma separated IP addresses, CIDR blocks and host names")
+	targetsPtr := flag.String("targets", "", "File with a target on each line: host:port, or a host without port to scan the selected ports")
+	portsPtr := flag.String("ports", "", "Ports to scan: comma separated ports, ranges like 8000-8100 and named sets ("+pqcscan.PortSetNames()+"). Overrides -start and -end.")
 	startPortPtr := flag.Int("start", 1, "Starting port number")
 	endPortPtr := flag.Int("end", 1024, "Ending port number")
 	timeoutPtr := flag.Int("timeout", 100, "Timeout in milliseconds")
 	concurrencyPtr := flag.Int("concurrency", 100, "Number of concurrent scans")
-	formatPtr := flag.String("format", "text", "Output format: text, json, or csv")
+	starttlsPtr := flag.String("starttls", pqcscan.StartTLSAuto, "STARTTLS protocol for plaintext ports: auto (by well-known port), none, or one of "+pqcscan.StartTLSProtocolNames())
+	quicPtr := flag.Bool("quic", false, "Also probe the UDP ports with a QUIC (HTTP/3) handshake")
+	ratePtr := flag.Float64("rate", 0, "Maximum number of new scans per second on a single host (0 means unlimited)")
+	formatPtr := flag.String("format", "text", "Output format: "+reportFormatNames())
 	verbosePtr := flag.Bool("verbose", false, "Show verbose output including banners")
 	outputFilePtr := flag.String("output", "", "Output file (default is stdout)")
+	baselinePtr := flag.String("baseline", "", "JSON result file of an earlier scan to compare with. Regressions set the exit code to 3.")
 
 	flag.Parse()
 
-	if *hostPtr == "" {
-		fmt.Println("Error: host is required")
+	if *hostPtr == "" && *targetsPtr == "" {
+		fmt.Println("Error: host or targets is required")
 		fmt.Println("\nUsage examples:")
 		fmt.Println("  goscan -host example.com")
 		fmt.Println("  goscan -host 192.168.1.1 -start 80 -end 443")
+		fmt.Println("  goscan -host 10.0.0.0/24,example.com -ports web,ssh -rate 5")
+		fmt.Println("  goscan -targets targets.txt -ports mail-starttls")
+		fmt.Println("  goscan -host example.com -ports 443 -quic")
 		fmt.Println("  goscan -host example.com -format json -output results.json")
+		fmt.Println("  goscan -host example.com -baseline results.json")
+		fmt.Println("  goscan diff baseline.json results.json")
 		fmt.Println("\nFor more options:")
 		flag.Usage()
 		os.Exit(1)
 	}
 
-	if *startPortPtr < 1 || *startPortPtr > 65535 {
-		fmt.Println("Error: starting port must be between 1 and 65535")
+	var ports []int
+	if *portsPtr != "" {
+		var err error
+		ports, err = pqcscan.ParsePortSpec(*portsPtr)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	} else {
+		if *startPortPtr < 1 || *startPortPtr > 65535 {
+			fmt.Println("Error: starting port must be between 1 and 65535")
+			os.Exit(1)
+		}
+		if *endPortPtr < 1 || *endPortPtr > 65535 {
+			fmt.Println("Error: ending port must be between 1 and 65535")
+			os.Exit(1)
+		}
+		if *startPortPtr > *endPortPtr {
+			fmt.Println("Error: starting port must be less than or equal to ending port")
+			os.Exit(1)
+		}
+		for port := *startPortPtr; port <= *endPortPtr; port++ {
+			ports = append(ports, port)
+		}
+	}
+
+	if *concurrencyPtr < 1 {
+		fmt.Println("Error: concurrency must be at least 1")
 		os.Exit(1)
 	}
-	if *endPortPtr < 1 || *endPortPtr > 65535 {
-		fmt.Println("Error: ending port must be between 1 and 65535")
+
+	starttlsMode, err := pqcscan.ParseStartTLSMode(*starttlsPtr)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
 		os.Exit(1)
 	}
-	if *startPortPtr > *endPortPtr {
-		fmt.Println("Error: starting port must be less than or equal to ending port")
+
+	if _, ok := reportWriters[*formatPtr]; !ok {
+		fmt.Printf("Error: format must be one of: %s\n", reportFormatNames())
 		os.Exit(1)
 	}
 
-	if *formatPtr != "text" && *formatPtr != "json" && *formatPtr != "csv" {
-		fmt.Println("Error: format must be one of: text, json, or csv")
+	var baseline *scanReport
+	if *baselinePtr != "" {
+		baseline, err = readScanReport(*baselinePtr)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var targets []pqcscan.Target
+	if *hostPtr != "" {
+		hosts, err := pqcscan.ParseHostSpec(*hostPtr)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		targets = append(targets, pqcscan.CrossTargets(hosts, ports)...)
+	}
+	if *targetsPtr != "" {
+		f, err := os.Open(*targetsPtr)
+		if err != nil {
+			fmt.Printf("Error opening targets file: %v\n", err)
+			os.Exit(1)
+		}
+		fileTargets, err := pqcscan.ReadTargetFile(f, ports)
+		f.Close()
+		if err != nil {
+			fmt.Printf("Error reading targets file %s: %v\n", *targetsPtr, err)
+			os.Exit(1)
+		}
+		targets = append(targets, fileTargets...)
+	}
+
+	ctx := context.Background()
+	targets, err = pqcscan.ResolveTargets(ctx, net.DefaultResolver, targets)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
 		os.Exit(1)
 	}
 
 	timeout := time.Duration(*timeoutPtr) * time.Millisecond
 
 	var outputFile *os.File
-	var err error
 
 	if *outputFilePtr != "" {
 		outputFile, err = os.Create(*outputFilePtr)
@@ -178,31 +305,67 @@ func main2() {
 		outputFile = os.Stdout
 	}
 
-	fmt.Fprintf(outputFile, "PQC TLS Scan - Scans whether a TLS server is post quantum safe\n")
-	fmt.Fprintf(outputFile, "======================================\n")
-	fmt.Fprintf(outputFile, "Target: %s\n", *hostPtr)
-	fmt.Fprintf(outputFile, "Port range: %d-%d\n", *startPortPtr, *endPortPtr)
-	fmt.Fprintf(outputFile, "Timeout: %d ms\n", *timeoutPtr)
-	fmt.Fprintf(outputFile, "Concurrency: %d\n", *concurrencyPtr)
-	fmt.Fprintf(outputFile, "======================================\n")
+	// The scan settings go to stderr if the report is machine readable
+	var info io.Writer = os.Stderr
+	if *formatPtr == "text" {
+		info = outputFile
+	}
+	fmt.Fprintf(info, "PQC TLS Scan - Scans whether TLS and SSH servers are post quantum safe\n")
+	fmt.Fprintf(info, "======================================\n")
+	if *hostPtr != "" {
+		fmt.Fprintf(info, "Target: %s\n", *hostPtr)
+	}
+	if *targetsPtr != "" {
+		fmt.Fprintf(info, "Targets file: %s\n", *targetsPtr)
+	}
+	if *portsPtr != "" {
+		fmt.Fprintf(info, "Ports: %s\n", *portsPtr)
+	} else {
+		fmt.Fprintf(info, "Port range: %d-%d\n", *startPortPtr, *endPortPtr)
+	}
+	fmt.Fprintf(info, "Timeout: %d ms\n", *timeoutPtr)
+	fmt.Fprintf(info, "Concurrency: %d\n", *concurrencyPtr)
+	fmt.Fprintf(info, "STARTTLS: %s\n", starttlsMode)
+	if *quicPtr {
+		fmt.Fprintf(info, "QUIC: enabled\n")
+	}
+	if *ratePtr > 0 {
+		fmt.Fprintf(info, "Rate limit: %g scans/s per host\n", *ratePtr)
+	}
+	fmt.Fprintf(info, "======================================\n")
 
-	fmt.Fprintf(outputFile, "Scanning %s from port %d to %d...\n", *hostPtr, *startPortPtr, *endPortPtr)
+	fmt.Fprintf(info, "Scanning %d host:port targets...\n", len(targets))
 	startTime := time.Now()
 
-	results := scanPorts(*hostPtr, *startPortPtr, *endPortPtr, timeout, *concurrencyPtr)
+	scanner := pqcscan.Scanner{
+		Timeout:     timeout,
+		Concurrency: *concurrencyPtr,
+		RatePerHost: *ratePtr,
+		StartTLS:    starttlsMode,
+		QUIC:        *quicPtr,
+	}
+	results, _ := scanner.ScanAll(ctx, targets)
 
 	elapsed := time.Since(startTime)
 
-	switch *formatPtr {
-	case "json":
-		outputJSON(outputFile, results, elapsed)
-	case "csv":
-		outputCSV(outputFile, results, elapsed, *verbosePtr)
-	default:
-		outputText(outputFile, results, elapsed, *verbosePtr)
+	if err := reportWriters[*formatPtr](outputFile, results, elapsed, *verbosePtr); err != nil {
+		fmt.Printf("Error writing report: %v\n", err)
+		os.Exit(1)
 	}
 
 	if *outputFilePtr != "" {
 		fmt.Printf("Scan complete! Results saved to %s\n", *outputFilePtr)
 	}
+
+	if baseline != nil {
+		changes := diffResults(baseline.Results, results)
+		fmt.Fprintf(info, "\nChanges since %s (%s):\n", *baselinePtr, baseline.ScanTime)
+		outputDiffText(info, changes)
+		if hasRegression(changes) {
+			if outputFile != os.Stdout {
+				outputFile.Close()
+			}
+			os.Exit(exitCodeRegression)
+		}
+	}
 }
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bukodi/playground/pqctlsscan/pqcscan"
+)
+
+// reportWriter writes the results of a scan in a report format
+type reportWriter func(w io.Writer, results []pqcscan.ScanResult, elapsed time.Duration, verbose bool) error
+
+// reportWriters are the formats of the -format flag
+var reportWriters = map[string]reportWriter{
+	"text": func(w io.Writer, results []pqcscan.ScanResult, elapsed time.Duration, verbose bool) error {
+		outputText(w, results, elapsed, verbose)
+		return nil
+	},
+	"json": func(w io.Writer, results []pqcscan.ScanResult, elapsed time.Duration, verbose bool) error {
+		return outputJSON(w, results, elapsed)
+	},
+	"csv": func(w io.Writer, results []pqcscan.ScanResult, elapsed time.Duration, verbose bool) error {
+		outputCSV(w, results, elapsed, verbose)
+		return nil
+	},
+	"sarif": outputSARIF,
+	"junit": outputJUnit,
+	"html":  outputHTML,
+}
+
+// reportFormatNames lists the report formats for the usage text
+func reportFormatNames() string {
+	names := make([]string, 0, len(reportWriters))
+	for name := range reportWriters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// Finding levels, named as in SARIF
+const (
+	levelError   = "error"
+	levelWarning = "warning"
+)
+
+// findingRule is a check the endpoints are reported against
+type findingRule struct {
+	ID          string
+	Name        string
+	Description string
+	Level       string
+}
+
+var (
+	ruleNoPQKex = findingRule{
+		ID:          "PQC001",
+		Name:        "NoPostQuantumKeyExchange",
+		Description: "The endpoint doesn't support a post-quantum key exchange. Recorded traffic can be decrypted once a quantum computer is available (harvest now, decrypt later).",
+		Level:       levelError,
+	}
+	ruleClassicKex = findingRule{
+		ID:          "PQC002",
+		Name:        "ClassicKeyExchangeAccepted",
+		Description: "The endpoint still accepts a classic key exchange. Traffic of clients without post-quantum support can be decrypted later.",
+		Level:       levelWarning,
+	}
+	ruleClassicAuth = findingRule{
+		ID:          "PQC003",
+		Name:        "ClassicAuthentication",
+		Description: "The server is authenticated with classic signatures. It can be impersonated once a quantum computer breaks the server or a CA key.",
+		Level:       levelWarning,
+	}
+)
+
+var findingRules = []findingRule{ruleNoPQKex, ruleClassicKex, ruleClassicAuth}
+
+// finding is a rule violated by an endpoint
+type finding struct {
+	Rule    findingRule
+	Message string
+}
+
+// resultFindings lists the rules violated by the endpoint. Only TLS and SSH endpoints are assessed.
+func resultFindings(result pqcscan.ScanResult) []finding {
+	if result.QuantumRisk == nil {
+		return nil
+	}
+	endpoint := endpointKey(result)
+	var findings []finding
+	switch {
+	case !result.IsPQKexSupported:
+		findings = append(findings, finding{ruleNoPQKex, fmt.Sprintf("%s (%s) has no post-quantum key exchange", endpoint, portTypeLabel(result))})
+	case result.IsNonPQKexSupported:
+		findings = append(findings, finding{ruleClassicKex, fmt.Sprintf("%s (%s) accepts a classic key exchange", endpoint, portTypeLabel(result))})
+	}
+	if result.QuantumRisk.ForgedAuthentication {
+		msg := fmt.Sprintf("%s (%s) is authenticated with classic signatures", endpoint, portTypeLabel(result))
+		if len(result.CertChain) > 0 {
+			leaf := result.CertChain[0]
+			msg += fmt.Sprintf(": %s key, %s signature", leaf.KeyType, leaf.SignatureAlgorithm)
+		}
+		findings = append(findings, finding{ruleClassicAuth, msg})
+	}
+	return findings
+}
+
+// resultsByHost groups the results by endpointHost, both in sorted order.
+// The results of a host are sorted by port, then by address.
+func resultsByHost(results []pqcscan.ScanResult) (hosts []string, byHost map[string][]pqcscan.ScanResult) {
+	byHost = make(map[string][]pqcscan.ScanResult)
+	for _, r := range results {
+		host := endpointHost(r)
+		if _, ok := byHost[host]; !ok {
+			hosts = append(hosts, host)
+		}
+		byHost[host] = append(byHost[host], r)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		rs := byHost[host]
+		sort.Slice(rs, func(i, j int) bool {
+			if rs[i].Port != rs[j].Port {
+				return rs[i].Port < rs[j].Port
+			}
+			return rs[i].Address < rs[j].Address
+		})
+	}
+	return hosts, byHost
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bukodi/playground/pqctlsscan/pqcscan"
+	"github.com/stretchr/testify/assert"
+)
+
+func reportTestResults() []pqcscan.ScanResult {
+	classicLeaf := pqcscan.CertInfo{Subject: "CN=<web>", KeyType: "RSA", KeyBits: 2048, SignatureAlgorithm: "SHA256-RSA"}
+	return []pqcscan.ScanResult{
+		{Address: "10.0.0.2", Port: 443, PortType: pqcscan.TLS, IsPQKexSupported: true, IsNonPQKexSupported: true,
+			CertChain: []pqcscan.CertInfo{classicLeaf}, TestDuration: time.Second},
+		{Address: "10.0.0.1", Port: 22, PortType: pqcscan.SSH, IsNonPQKexSupported: true},
+		{Address: "10.0.0.1", Port: 80, PortType: pqcscan.Other},
+		{Address: "10.0.0.1", Port: 5432, PortType: pqcscan.TLS, StartTLS: "postgres", IsPQKexSupported: true,
+			CertChain: []pqcscan.CertInfo{{KeyType: "ML-DSA-65", SignatureAlgorithm: "ML-DSA-65", PQKey: true, PQSignature: true}}},
+	}
+}
+
+func assessedResults() []pqcscan.ScanResult {
+	results := reportTestResults()
+	for i := range results {
+		if results[i].PortType != pqcscan.Other {
+			results[i].QuantumRisk = pqcscan.AssessQuantumRisk(&results[i])
+		}
+	}
+	return results
+}
+
+func TestResultFindings(t *testing.T) {
+	results := assessedResults()
+	ruleIDs := func(r pqcscan.ScanResult) []string {
+		var ids []string
+		for _, f := range resultFindings(r) {
+			ids = append(ids, f.Rule.ID)
+		}
+		return ids
+	}
+	assert.Equal(t, []string{"PQC002", "PQC003"}, ruleIDs(results[0]))
+	assert.Equal(t, []string{"PQC001"}, ruleIDs(results[1]))
+	assert.Empty(t, ruleIDs(results[2]))
+	assert.Empty(t, ruleIDs(results[3]))
+}
+
+func TestOutputSARIF(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, outputSARIF(&buf, assessedResults(), time.Second, false))
+
+	var log sarifLog
+	if !assert.NoError(t, json.Unmarshal(buf.Bytes(), &log)) {
+		return
+	}
+	assert.Equal(t, "2.1.0", log.Version)
+	if !assert.Len(t, log.Runs, 1) {
+		return
+	}
+	run := log.Runs[0]
+	assert.Len(t, run.Tool.Driver.Rules, len(findingRules))
+	if assert.Len(t, run.Results, 3) {
+		assert.Equal(t, "PQC002", run.Results[0].RuleID)
+		assert.Equal(t, levelWarning, run.Results[0].Level)
+		assert.Equal(t, "tls://10.0.0.2:443", run.Results[0].Locations[0].PhysicalLocation.ArtifactLocation.URI)
+		assert.Equal(t, "PQC001", run.Results[2].RuleID)
+		assert.Equal(t, 0, run.Results[2].RuleIndex)
+		assert.Equal(t, levelError, run.Results[2].Level)
+		assert.Equal(t, "ssh://10.0.0.1:22", run.Results[2].Locations[0].PhysicalLocation.ArtifactLocation.URI)
+	}
+}
+
+func TestOutputJUnit(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, outputJUnit(&buf, assessedResults(), time.Second, false))
+	assert.True(t, strings.HasPrefix(buf.String(), "<?xml"))
+
+	var report junitTestSuites
+	if !assert.NoError(t, xml.Unmarshal(buf.Bytes(), &report)) {
+		return
+	}
+	assert.Equal(t, 4, report.Tests)
+	assert.Equal(t, 1, report.Failures)
+	assert.Equal(t, 1, report.Skipped)
+	if assert.Len(t, report.Suites, 2) {
+		host1 := report.Suites[0]
+		assert.Equal(t, "10.0.0.1", host1.Name)
+		if assert.Len(t, host1.TestCases, 3) {
+			assert.Equal(t, "22/SSH", host1.TestCases[0].Name)
+			assert.NotNil(t, host1.TestCases[0].Failure)
+			assert.NotNil(t, host1.TestCases[1].Skipped)
+			assert.Equal(t, "5432/TLS+postgres", host1.TestCases[2].Name)
+			assert.Nil(t, host1.TestCases[2].Failure)
+		}
+		host2 := report.Suites[1]
+		if assert.Len(t, host2.TestCases, 1) {
+			assert.Nil(t, host2.TestCases[0].Failure)
+			assert.Contains(t, host2.TestCases[0].SystemOut, "PQC003")
+			assert.Equal(t, "1.000", host2.TestCases[0].Time)
+		}
+	}
+}
+
+func TestOutputHTML(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, outputHTML(&buf, assessedResults(), time.Second, false))
+	page := buf.String()
+	assert.Contains(t, page, "<h2>10.0.0.1</h2>")
+	assert.Contains(t, page, "<h2>10.0.0.2</h2>")
+	assert.Contains(t, page, "CN=&lt;web&gt;")
+	assert.Contains(t, page, "TLS&#43;postgres")
+	assert.Contains(t, page, `<tr class="high"><th>high</th><td>1</td></tr>`)
+	assert.Contains(t, page, `<tr><th>not assessed</th><td>1</td></tr>`)
+	assert.NotContains(t, page, "<script")
+}
+
+func TestOutputCSVEscapes(t *testing.T) {
+	var buf bytes.Buffer
+	results := []pqcscan.ScanResult{{Address: "10.0.0.1", Port: 443, PortType: pqcscan.TLS, Error: `tls: "bad", really`,
+		TLSGroups: &pqcscan.TLSGroupInfo{Supported: []string{"X25519MLKEM768", "X25519"}}}}
+	assert.NoError(t, reportWriters["csv"](&buf, results, time.Second, false))
+	lines := strings.Split(buf.String(), "\n")
+	assert.True(t, strings.HasSuffix(lines[0], ",QuantumRisk,Error"))
+	assert.Equal(t, `10.0.0.1,,443,TLS,,false,false,X25519MLKEM768;X25519,,,,,-,"tls: ""bad"", really"`, lines[1])
+}
+
+func TestReportsUseHostname(t *testing.T) {
+	results := []pqcscan.ScanResult{
+		{Address: "93.184.216.34", Hostname: "www.example.com", Port: 443, PortType: pqcscan.TLS, IsNonPQKexSupported: true},
+		{Address: "2001:db8::1", Hostname: "www.example.com", Port: 443, PortType: pqcscan.TLS, IsNonPQKexSupported: true},
+	}
+	for i := range results {
+		results[i].QuantumRisk = pqcscan.AssessQuantumRisk(&results[i])
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, outputSARIF(&buf, results, time.Second, false))
+	var log sarifLog
+	if assert.NoError(t, json.Unmarshal(buf.Bytes(), &log)) && assert.NotEmpty(t, log.Runs[0].Results) {
+		r := log.Runs[0].Results[0]
+		assert.Equal(t, "tls://www.example.com:443", r.Locations[0].PhysicalLocation.ArtifactLocation.URI)
+		assert.Equal(t, "tls://www.example.com:443/"+r.RuleID, r.PartialFingerprints["endpoint/v1"])
+		assert.Equal(t, "93.184.216.34", r.Properties["address"])
+		assert.Contains(t, r.Message.Text, "www.example.com:443")
+	}
+
+	buf.Reset()
+	assert.NoError(t, outputJUnit(&buf, results, time.Second, false))
+	var report junitTestSuites
+	if assert.NoError(t, xml.Unmarshal(buf.Bytes(), &report)) && assert.Len(t, report.Suites, 1) {
+		suite := report.Suites[0]
+		assert.Equal(t, "www.example.com", suite.Name)
+		if assert.Len(t, suite.TestCases, 2) {
+			assert.Equal(t, "pqctlsscan.www.example.com", suite.TestCases[0].ClassName)
+			assert.Equal(t, "443/TLS 2001:db8::1", suite.TestCases[0].Name)
+			assert.Equal(t, "443/TLS 93.184.216.34", suite.TestCases[1].Name)
+		}
+	}
+
+	buf.Reset()
+	assert.NoError(t, outputHTML(&buf, results, time.Second, false))
+	assert.Contains(t, buf.String(), "<h2>www.example.com</h2>")
+	assert.Contains(t, buf.String(), "<td>2001:db8::1</td>")
+
+	buf.Reset()
+	assert.NoError(t, reportWriters["csv"](&buf, results, time.Second, false))
+	lines := strings.Split(buf.String(), "\n")
+	assert.True(t, strings.HasPrefix(lines[0], "Host,Hostname,Port,"))
+	assert.True(t, strings.HasPrefix(lines[1], "93.184.216.34,www.example.com,443,"), lines[1])
+}
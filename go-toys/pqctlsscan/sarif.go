@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bukodi/playground/pqctlsscan/pqcscan"
+)
+
+// SARIF 2.1.0 (OASIS), only the parts used by the report
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+)
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool        sarifTool         `json:"tool"`
+	Invocations []sarifInvocation `json:"invocations,omitempty"`
+	Results     []sarifResult     `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name  string      `json:"name"`
+	Rules []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string             `json:"id"`
+	Name                 string             `json:"name"`
+	ShortDescription     sarifMessage       `json:"shortDescription"`
+	DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifInvocation struct {
+	ExecutionSuccessful bool   `json:"executionSuccessful"`
+	EndTimeUTC          string `json:"endTimeUtc"`
+}
+
+type sarifResult struct {
+	RuleID              string            `json:"ruleId"`
+	RuleIndex           int               `json:"ruleIndex"`
+	Level               string            `json:"level"`
+	Message             sarifMessage      `json:"message"`
+	Locations           []sarifLocation   `json:"locations"`
+	PartialFingerprints map[string]string `json:"partialFingerprints"`
+	Properties          map[string]string `json:"properties,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+// outputSARIF writes a finding for every rule an endpoint violates. The endpoints are
+// located by URIs like tls://www.example.com:443, ssh://192.0.2.1:22 or quic://192.0.2.1:443,
+// with the host of endpointKey. The address of a host name is in the address property.
+func outputSARIF(w io.Writer, results []pqcscan.ScanResult, elapsed time.Duration, verbose bool) error {
+	run := sarifRun{
+		Tool:        sarifTool{Driver: sarifDriver{Name: "pqctlsscan"}},
+		Invocations: []sarifInvocation{{ExecutionSuccessful: true, EndTimeUTC: time.Now().UTC().Format(time.RFC3339)}},
+		Results:     []sarifResult{},
+	}
+	ruleIndex := make(map[string]int)
+	for i, rule := range findingRules {
+		ruleIndex[rule.ID] = i
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+			ID:                   rule.ID,
+			Name:                 rule.Name,
+			ShortDescription:     sarifMessage{Text: rule.Description},
+			DefaultConfiguration: sarifConfiguration{Level: rule.Level},
+		})
+	}
+
+	for _, result := range results {
+		uri := strings.ToLower(string(result.PortType)) + "://" + net.JoinHostPort(endpointHost(result), strconv.Itoa(result.Port))
+		var properties map[string]string
+		if result.Hostname != "" {
+			properties = map[string]string{"address": result.Address}
+		}
+		for _, f := range resultFindings(result) {
+			run.Results = append(run.Results, sarifResult{
+				RuleID:              f.Rule.ID,
+				RuleIndex:           ruleIndex[f.Rule.ID],
+				Level:               f.Rule.Level,
+				Message:             sarifMessage{Text: f.Message},
+				Locations:           []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: uri}}}},
+				PartialFingerprints: map[string]string{"endpoint/v1": uri + "/" + f.Rule.ID},
+				Properties:          properties,
+			})
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(sarifLog{Schema: sarifSchema, Version: sarifVersion, Runs: []sarifRun{run}})
+}
@@ -0,0 +1,261 @@
+package rfc3161
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Errors
+var (
+	ErrBatchClientClosed = errors.New("rfc3161: batch: BatchClient is closed")
+	ErrBatchRootMismatch = errors.New("rfc3161: batch: Inclusion proof does not lead to the time-stamped root")
+)
+
+// BatchClient defaults
+const (
+	DefaultBatchWindow  = time.Second
+	DefaultMaxBatchSize = 10000
+	DefaultBatchTimeout = 30 * time.Second
+)
+
+// BatchClient time-stamps many digests with a single request to the TSA.
+//
+// Digests submitted with TimeStamp are collected for at most Window, or until MaxBatchSize
+// digests are waiting. Then the root of a hash tree (RFC 4998 4.2) over them is time-stamped,
+// and every caller gets a BatchProof linking its digest to the shared TimeStampToken.
+//
+// Use NewBatchClient to create one. The exported fields may be changed before the first TimeStamp.
+type BatchClient struct {
+	Client       *Client
+	Hash         crypto.Hash   // Digest algorithm of the submitted digests and of the hash tree
+	Window       time.Duration // Maximum time a digest waits for its batch. Defaults to DefaultBatchWindow.
+	MaxBatchSize int           // Number of digests that triggers a request before the window ends. Defaults to DefaultMaxBatchSize.
+	Timeout      time.Duration // Deadline of a request to the TSA, so Close doesn't hang on a stalled TSA. Defaults to DefaultBatchTimeout.
+
+	mu      sync.Mutex
+	pending []*batchItem
+	timer   *time.Timer
+	closed  bool
+	running sync.WaitGroup
+}
+
+// batchItem is a digest waiting for its batch
+type batchItem struct {
+	digest []byte
+	done   chan batchResult // Buffered, the waiter may be gone
+}
+
+type batchResult struct {
+	proof *BatchProof
+	err   error
+}
+
+// BatchProof proves that a digest was time-stamped as part of a batch.
+//
+// It has the DER encoding of an RFC 4998 ArchiveTimeStamp without the optional
+// digestAlgorithm and attributes, so it can also be read as one with package ers.
+type BatchProof struct {
+	ReducedHashtree []PartialHashtree `asn1:"optional,tag:2"` // Empty if the batch had a single digest
+	TimeStampToken  TimeStampToken
+}
+
+// NewBatchClient creates a BatchClient sending its requests with client
+func NewBatchClient(client *Client, hash crypto.Hash) *BatchClient {
+	batch := new(BatchClient)
+	batch.Client = client
+	batch.Hash = hash
+	batch.Window = DefaultBatchWindow
+	batch.MaxBatchSize = DefaultMaxBatchSize
+	batch.Timeout = DefaultBatchTimeout
+	return batch
+}
+
+// TimeStamp submits the digest to the next batch and waits until the batch is time-stamped.
+// If ctx is done first, TimeStamp returns its error; the digest is time-stamped anyway.
+func (batch *BatchClient) TimeStamp(ctx context.Context, digest []byte) (*BatchProof, error) {
+	if !batch.Hash.Available() {
+		return nil, ErrUnsupportedHash
+	}
+	if len(digest) != batch.Hash.Size() {
+		return nil, ErrInvalidDigestSize
+	}
+	item := &batchItem{digest: append([]byte(nil), digest...), done: make(chan batchResult, 1)}
+
+	batch.mu.Lock()
+	if batch.closed {
+		batch.mu.Unlock()
+		return nil, ErrBatchClientClosed
+	}
+	batch.pending = append(batch.pending, item)
+	maxSize := batch.MaxBatchSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxBatchSize
+	}
+	if len(batch.pending) >= maxSize {
+		batch.flushLocked()
+	} else if batch.timer == nil {
+		window := batch.Window
+		if window <= 0 {
+			window = DefaultBatchWindow
+		}
+		batch.timer = time.AfterFunc(window, batch.Flush)
+	}
+	batch.mu.Unlock()
+
+	select {
+	case result := <-item.done:
+		return result.proof, result.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Flush sends the waiting digests to the TSA without waiting for the window to end
+func (batch *BatchClient) Flush() {
+	batch.mu.Lock()
+	defer batch.mu.Unlock()
+	batch.flushLocked()
+}
+
+// Close time-stamps the waiting digests and waits for all requests in progress.
+// TimeStamp fails with ErrBatchClientClosed afterwards.
+func (batch *BatchClient) Close() error {
+	batch.mu.Lock()
+	batch.closed = true
+	batch.flushLocked()
+	batch.mu.Unlock()
+
+	batch.running.Wait()
+	return nil
+}
+
+// flushLocked starts time-stamping the pending digests. batch.mu must be held.
+func (batch *BatchClient) flushLocked() {
+	if batch.timer != nil {
+		batch.timer.Stop()
+		batch.timer = nil
+	}
+	if len(batch.pending) == 0 {
+		return
+	}
+	items := batch.pending
+	batch.pending = nil
+
+	batch.running.Add(1)
+	go func() {
+		defer batch.running.Done()
+		batch.stamp(items)
+	}()
+}
+
+// stamp time-stamps the root of the hash tree over the digests and hands out the proofs
+func (batch *BatchClient) stamp(items []*batchItem) {
+	proofs, err := batch.timeStampTree(items)
+	for i, item := range items {
+		if err != nil {
+			item.done <- batchResult{err: err}
+		} else {
+			item.done <- batchResult{proof: proofs[i]}
+		}
+	}
+}
+
+func (batch *BatchClient) timeStampTree(items []*batchItem) ([]*BatchProof, error) {
+	leaves := make([][]byte, len(items))
+	for i, item := range items {
+		leaves[i] = item.digest
+	}
+	tree, err := NewHashTree(batch.Hash, leaves)
+	if err != nil {
+		return nil, err
+	}
+	timeout := batch.Timeout
+	if timeout <= 0 {
+		timeout = DefaultBatchTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	token, err := batch.Client.TimeStamp(ctx, batch.Hash, tree.Root())
+	if err != nil {
+		return nil, err
+	}
+
+	proofs := make([]*BatchProof, len(items))
+	for i := range items {
+		reduced, err := tree.ReducedHashtree(i)
+		if err != nil {
+			return nil, err
+		}
+		proofs[i] = &BatchProof{ReducedHashtree: reduced, TimeStampToken: *token}
+	}
+	return proofs, nil
+}
+
+// ParseBatchProof parses a DER encoded BatchProof
+func ParseBatchProof(der []byte) (*BatchProof, error) {
+	proof := new(BatchProof)
+	rest, err := asn1.Unmarshal(der, proof)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return proof, ErrUnrecognizedData
+	}
+	return proof, nil
+}
+
+// Marshal gets the DER encoding of the BatchProof
+func (proof *BatchProof) Marshal() ([]byte, error) {
+	fields := *proof
+	if len(fields.TimeStampToken.Raw) != 0 {
+		// The token is encoded from its Raw bytes, refresh them if it was changed
+		der, err := proof.TimeStampToken.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		fields.TimeStampToken.Raw = der
+	}
+	return asn1.Marshal(fields)
+}
+
+// Root calculates the time-stamped root of the batch from the digest
+func (proof *BatchProof) Root(digest []byte) ([]byte, error) {
+	hash := proof.TimeStampToken.GetHash()
+	if hash == 0 {
+		return nil, ErrUnsupportedHash
+	}
+	return ComputeRoot(hash, digest, proof.ReducedHashtree)
+}
+
+// Verify does a full verification that the digest was time-stamped as part of the batch.
+// The digest must be calculated with the hash algorithm of the token. The TSA certificate
+// must be included in the token.
+//
+// WARNING: Does not do any revocation checking. Use VerifyContext for that.
+func (proof *BatchProof) Verify(digest []byte) error {
+	return proof.VerifyContext(context.Background(), digest, nil, nil)
+}
+
+// VerifyContext does the same verification as Verify. cert may be set to nil if the
+// token contains the TSA certificate. A non-nil policy also checks the revocation
+// status of the TSA certificate chain.
+func (proof *BatchProof) VerifyContext(ctx context.Context, digest []byte, cert *x509.Certificate, policy *RevocationPolicy) error {
+	root, err := proof.Root(digest)
+	if err != nil {
+		return err
+	}
+	tst, err := proof.TimeStampToken.GetTSTInfo()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(tst.MessageImprint.HashedMessage, root) {
+		return ErrBatchRootMismatch
+	}
+	return proof.TimeStampToken.VerifyContext(ctx, root, cert, policy)
+}
@@ -0,0 +1,181 @@
+package rfc3161_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bukodi/playground/rfc3161"
+)
+
+// newCountingTSA starts a local TSA over HTTP that counts the requests
+func newCountingTSA(t *testing.T) (*httptest.Server, *int32) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	tsa, _ := newTestTSA(t, key)
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		tsa.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestBatchClient(t *testing.T) {
+	srv, requests := newCountingTSA(t)
+	batch := rfc3161.NewBatchClient(rfc3161.NewClient(srv.URL), crypto.SHA256)
+	batch.Window = 50 * time.Millisecond
+
+	const n = 100
+	digests := make([][]byte, n)
+	proofs := make([]*rfc3161.BatchProof, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		digest := sha256.Sum256([]byte(fmt.Sprint("artifact ", i)))
+		digests[i] = digest[:]
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			proofs[i], errs[i] = batch.TimeStamp(context.Background(), digests[i])
+		}(i)
+	}
+	wg.Wait()
+
+	if got := atomic.LoadInt32(requests); got != 1 {
+		t.Errorf("expected a single TSA request, got %d", got)
+	}
+	for i := 0; i < n; i++ {
+		if errs[i] != nil {
+			t.Fatalf("%d: %+v", i, errs[i])
+		}
+		der, err := proofs[i].Marshal()
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+		proof, err := rfc3161.ParseBatchProof(der)
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+		if err := proof.Verify(digests[i]); err != nil {
+			t.Fatalf("%d: %+v", i, err)
+		}
+	}
+
+	other := sha256.Sum256([]byte("not an artifact"))
+	if err := proofs[0].Verify(other[:]); !errors.Is(err, rfc3161.ErrLeafNotInHashtree) {
+		t.Errorf("expected ErrLeafNotInHashtree, got %v", err)
+	}
+	proofs[0].ReducedHashtree[1][0][0] ^= 0xff
+	if err := proofs[0].Verify(digests[0]); !errors.Is(err, rfc3161.ErrBatchRootMismatch) {
+		t.Errorf("expected ErrBatchRootMismatch, got %v", err)
+	}
+}
+
+func TestBatchClientMaxBatchSize(t *testing.T) {
+	srv, requests := newCountingTSA(t)
+	batch := rfc3161.NewBatchClient(rfc3161.NewClient(srv.URL), crypto.SHA256)
+	batch.Window = time.Hour
+	batch.MaxBatchSize = 3
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		digest := sha256.Sum256([]byte(fmt.Sprint("artifact ", i)))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			proof, err := batch.TimeStamp(context.Background(), digest[:])
+			if err != nil {
+				t.Errorf("%+v", err)
+				return
+			}
+			if err := proof.Verify(digest[:]); err != nil {
+				t.Errorf("%+v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := atomic.LoadInt32(requests); got != 2 {
+		t.Errorf("expected 2 TSA requests, got %d", got)
+	}
+}
+
+func TestBatchClientClose(t *testing.T) {
+	srv, requests := newCountingTSA(t)
+	batch := rfc3161.NewBatchClient(rfc3161.NewClient(srv.URL), crypto.SHA256)
+	batch.Window = time.Hour
+
+	digest := sha256.Sum256([]byte("artifact"))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := batch.TimeStamp(ctx, digest[:]); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+
+	// Close still time-stamps the abandoned digest
+	if err := batch.Close(); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if got := atomic.LoadInt32(requests); got != 1 {
+		t.Errorf("expected 1 TSA request, got %d", got)
+	}
+	if _, err := batch.TimeStamp(context.Background(), digest[:]); !errors.Is(err, rfc3161.ErrBatchClientClosed) {
+		t.Errorf("expected ErrBatchClientClosed, got %v", err)
+	}
+	if _, err := batch.TimeStamp(context.Background(), digest[:4]); !errors.Is(err, rfc3161.ErrInvalidDigestSize) {
+		t.Errorf("expected ErrInvalidDigestSize, got %v", err)
+	}
+}
+
+func TestBatchClientTimeout(t *testing.T) {
+	stalled := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-stalled:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(stalled)
+
+	batch := rfc3161.NewBatchClient(rfc3161.NewClient(srv.URL), crypto.SHA256)
+	batch.Window = time.Hour
+	batch.Timeout = 50 * time.Millisecond
+
+	digest := sha256.Sum256([]byte("artifact"))
+	result := make(chan error, 1)
+	go func() {
+		_, err := batch.TimeStamp(context.Background(), digest[:])
+		result <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	closed := make(chan struct{})
+	go func() {
+		batch.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close hangs on a stalled TSA")
+	}
+	if err := <-result; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
@@ -2,57 +2,199 @@ package rfc3161
 
 import (
 	"bytes"
+	"context"
 	"encoding/asn1"
 	"errors"
-	"io/ioutil"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"time"
 )
 
 // Errors
 var (
-	ErrRequestFailed = errors.New("rfc3161: client: Request failed")
+	ErrRequestFailed          = errors.New("rfc3161: client: Request failed")
+	ErrResponseTooLarge       = errors.New("rfc3161: client: Response exceeds the maximum allowed size")
+	ErrUnexpectedContentType  = errors.New("rfc3161: client: Response has unexpected content type")
+	ErrNoURL                  = errors.New("rfc3161: client: No TSA URL provided")
+	ErrUnexpectedHTTPResponse = errors.New("rfc3161: client: Unexpected HTTP response")
+)
+
+// Client defaults
+const (
+	DefaultMaxResponseSize = 1024 * 1024
+	DefaultRetryBackoff    = 500 * time.Millisecond
 )
 
 // Client handles requests to an HTTP or websocket time-stamp-service
 // You may override the underlying http client used by setting the HTTPClient field
+//
+// Requests are sent to URL first, then to each of FallbackURLs in order.
+// Retries are opt-in: with Retries set, every URL is tried up to 1+Retries times
+// when the failure looks transient (transport errors, HTTP 408, 429 and 5xx),
+// waiting RetryBackoff before the first retry and doubling the wait for every further one.
 type Client struct {
-	HTTPClient *http.Client
-	URL        string
+	HTTPClient      *http.Client
+	URL             string
+	FallbackURLs    []string      // Additional TSA URLs tried in order when URL fails
+	MaxResponseSize int64         // Maximum accepted size of the response body. Defaults to DefaultMaxResponseSize.
+	Retries         int           // Number of retries per URL for transient failures. Defaults to 0.
+	RetryBackoff    time.Duration // Wait before the first retry. Doubled for every subsequent retry.
 }
 
-// NewClient creates a new rfc3161.Client given a URL.
-func NewClient(url string) *Client {
+// NewClient creates a new rfc3161.Client given a URL and optional fallback URLs.
+func NewClient(url string, fallbackURLs ...string) *Client {
 	client := new(Client)
 	client.HTTPClient = http.DefaultClient
 	client.URL = url
+	client.FallbackURLs = fallbackURLs
+	client.MaxResponseSize = DefaultMaxResponseSize
+	client.RetryBackoff = DefaultRetryBackoff
 	return client
 }
 
+// RequestError records a failed attempt to get a Time Stamp Response from a TSA.
+// It matches ErrRequestFailed with errors.Is.
+type RequestError struct {
+	URL     string
+	Attempt int // 1 for the first attempt against URL
+	Err     error
+}
+
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("rfc3161: client: Request to %s failed (attempt %d): %v", e.URL, e.Attempt, e.Err)
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is ErrRequestFailed
+func (e *RequestError) Is(target error) bool {
+	return target == ErrRequestFailed
+}
+
+// HTTPError is returned when the TSA answers with a non-200 HTTP status.
+// It matches ErrUnexpectedHTTPResponse with errors.Is.
+type HTTPError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *HTTPError) Error() string {
+	return "rfc3161: client: Unexpected HTTP status: " + e.Status
+}
+
+// Is reports whether target is ErrUnexpectedHTTPResponse
+func (e *HTTPError) Is(target error) bool {
+	return target == ErrUnexpectedHTTPResponse
+}
+
+// Temporary reports whether retrying the request may succeed
+func (e *HTTPError) Temporary() bool {
+	return e.StatusCode == http.StatusRequestTimeout || e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
 // Do a time stamp request and get back the Time Stamp Response.
 // This will not verify the response. It is the caller's responsibility
 // to call resp.Verify() on the returned TimeStampResp.
 func (client *Client) Do(tsq *TimeStampReq) (*TimeStampResp, error) {
+	return client.DoContext(context.Background(), tsq)
+}
+
+// DoContext does a time stamp request like Do, but the request, the retries and the
+// waits between them are bound to ctx.
+//
+// If the TSA answers with a rejection, the TimeStampResp is returned together
+// with its *PKIStatusInfo as the error and no other TSA is tried. If every
+// attempt fails, the returned error joins the *RequestError of each attempt.
+func (client *Client) DoContext(ctx context.Context, tsq *TimeStampReq) (*TimeStampResp, error) {
 	der, err := asn1.Marshal(*tsq)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := http.NewRequest("POST", client.URL, bytes.NewBuffer(der))
+	urls := make([]string, 0, 1+len(client.FallbackURLs))
+	if client.URL != "" {
+		urls = append(urls, client.URL)
+	}
+	urls = append(urls, client.FallbackURLs...)
+	if len(urls) == 0 {
+		return nil, ErrNoURL
+	}
+
+	var errs []error
+	for _, url := range urls {
+		backoff := client.RetryBackoff
+		for attempt := 1; attempt <= 1+max(client.Retries, 0); attempt++ {
+			if attempt > 1 {
+				timer := time.NewTimer(backoff)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return nil, errors.Join(append(errs, ctx.Err())...)
+				case <-timer.C:
+				}
+				backoff *= 2
+			}
+
+			tsr, err := client.do(ctx, url, der)
+			if err == nil {
+				if tsr.Status.Status.IsError() {
+					return tsr, &tsr.Status
+				}
+				return tsr, nil
+			}
+			errs = append(errs, &RequestError{URL: url, Attempt: attempt, Err: err})
+
+			if ctx.Err() != nil {
+				return nil, errors.Join(errs...)
+			}
+			if !isTemporary(err) {
+				break
+			}
+		}
+	}
+	return nil, errors.Join(errs...)
+}
+
+// do sends a single request to the given URL
+func (client *Client) do(ctx context.Context, url string, der []byte) (*TimeStampResp, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(der))
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/timestamp-query")
 
-	resp, err := client.HTTPClient.Do(req)
-	defer resp.Body.Close()
+	httpClient := client.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &HTTPError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	if mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err != nil || mediaType != "application/timestamp-reply" {
+		return nil, ErrUnexpectedContentType
+	}
 
-	body, err := ioutil.ReadAll(resp.Body)
+	maxSize := client.MaxResponseSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxResponseSize
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
 	if err != nil {
 		return nil, err
 	}
+	if int64(len(body)) > maxSize {
+		return nil, ErrResponseTooLarge
+	}
 
 	tsr := new(TimeStampResp)
 	rest, err := asn1.Unmarshal(body, tsr)
@@ -62,9 +204,23 @@ func (client *Client) Do(tsq *TimeStampReq) (*TimeStampResp, error) {
 	if len(rest) != 0 {
 		return nil, ErrUnrecognizedData
 	}
+	return tsr, nil
+}
 
-	if tsr.Status.Status.IsError() {
-		return tsr, &tsr.Status
+// isTemporary reports whether a failed attempt is worth retrying against the same URL
+func isTemporary(err error) bool {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Temporary()
 	}
-	return tsr, nil
+	if errors.Is(err, ErrResponseTooLarge) || errors.Is(err, ErrUnexpectedContentType) || errors.Is(err, ErrUnrecognizedData) {
+		return false
+	}
+	var syntaxErr asn1.SyntaxError
+	var structErr asn1.StructuralError
+	if errors.As(err, &syntaxErr) || errors.As(err, &structErr) {
+		return false
+	}
+	// Transport level errors
+	return true
 }
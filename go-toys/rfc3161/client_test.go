@@ -0,0 +1,143 @@
+package rfc3161_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bukodi/playground/rfc3161"
+)
+
+func newTestReq(t *testing.T) *rfc3161.TimeStampReq {
+	t.Helper()
+	digest := sha256.Sum256([]byte("Hello world!"))
+	tsreq, err := rfc3161.NewTimeStampReq(crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	tsreq.CertReq = true
+	return tsreq
+}
+
+func TestClientRetryAndFailover(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	tsa, _ := newTestTSA(t, key)
+
+	// Fails twice with 503, then works
+	var flakyCalls atomic.Int32
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if flakyCalls.Add(1) <= 2 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		tsa.ServeHTTP(w, r)
+	}))
+	defer flaky.Close()
+
+	// Answers with HTML, as captive portals and misconfigured proxies do
+	var brokenCalls atomic.Int32
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		brokenCalls.Add(1)
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html></html>"))
+	}))
+	defer broken.Close()
+
+	c := rfc3161.NewClient(broken.URL, flaky.URL)
+	c.Retries = 2
+	c.RetryBackoff = time.Millisecond
+
+	tsreq := newTestReq(t)
+	tsrsp, err := c.DoContext(context.Background(), tsreq)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if err := tsrsp.Verify(tsreq, nil); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if got := brokenCalls.Load(); got != 1 {
+		t.Errorf("wrong content type should not be retried, got %d calls", got)
+	}
+	if got := flakyCalls.Load(); got != 3 {
+		t.Errorf("expected 3 calls to the flaky TSA, got %d", got)
+	}
+}
+
+func TestClientNoRetriesByDefault(t *testing.T) {
+	var calls atomic.Int32
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, "busy", http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+
+	if _, err := rfc3161.NewClient(unavailable.URL).Do(newTestReq(t)); !errors.Is(err, rfc3161.ErrRequestFailed) {
+		t.Errorf("expected ErrRequestFailed, got %v", err)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("expected a single call without Retries, got %d", got)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	tooLarge := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/timestamp-reply")
+		w.Write(make([]byte, 2048))
+	}))
+	defer tooLarge.Close()
+
+	notFound := httptest.NewServer(http.NotFoundHandler())
+	defer notFound.Close()
+
+	c := rfc3161.NewClient(tooLarge.URL, notFound.URL)
+	c.MaxResponseSize = 1024
+	c.Retries = 2
+	c.RetryBackoff = time.Millisecond
+
+	_, err := c.Do(newTestReq(t))
+	if !errors.Is(err, rfc3161.ErrRequestFailed) {
+		t.Errorf("expected ErrRequestFailed, got %v", err)
+	}
+	if !errors.Is(err, rfc3161.ErrResponseTooLarge) {
+		t.Errorf("expected ErrResponseTooLarge, got %v", err)
+	}
+	var httpErr *rfc3161.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected HTTP 404 error, got %v", err)
+	}
+}
+
+func TestClientContextCancel(t *testing.T) {
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "busy", http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+
+	c := rfc3161.NewClient(unavailable.URL)
+	c.Retries = 10
+	c.RetryBackoff = time.Hour
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := c.DoContext(ctx, newTestReq(t))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Errorf("backoff did not honour the context")
+	}
+}
@@ -0,0 +1,59 @@
+// Command tsa is a time-stamping tool built on the rfc3161 package.
+// Its subcommands mirror "openssl ts":
+//
+//	tsa query  -data file [-hash sha256] [-cert] [-no_nonce] [-tspolicy oid] -out file.tsq
+//	tsa query  -in file.tsq -text
+//	tsa reply  -queryfile file.tsq -url https://tsa.example/tsr -out file.tsr
+//	tsa reply  -in file.tsr [-token_in] -text [-token_out -out file.tst]
+//	tsa verify -in file.tsr (-data file | -digest hex | -queryfile file.tsq) [-CAfile bundle.pem]
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run executes the subcommand named by the first argument and returns the exit code
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return 2
+	}
+
+	var err error
+	switch args[0] {
+	case "query":
+		err = runQuery(args[1:], stdout, stderr)
+	case "reply":
+		err = runReply(args[1:], stdout, stderr)
+	case "verify":
+		err = runVerify(args[1:], stdout, stderr)
+	case "-h", "-help", "--help", "help":
+		usage(stdout)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "Unknown command: %s\n", args[0])
+		usage(stderr)
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: tsa <command> [options]\n\n")
+	fmt.Fprintf(w, "Commands:\n")
+	fmt.Fprintf(w, "  query   Create or print a time-stamp request (.tsq)\n")
+	fmt.Fprintf(w, "  reply   Send a request to a TSA or print a time-stamp response (.tsr)\n")
+	fmt.Fprintf(w, "  verify  Verify a time-stamp response against the data and trusted CAs\n")
+	fmt.Fprintf(w, "\nRun 'tsa <command> -h' for the options of a command.\n")
+}
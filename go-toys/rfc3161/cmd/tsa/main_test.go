@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bukodi/playground/rfc3161"
+)
+
+// startTSA starts a local TSA and writes its root certificate to caFile
+func startTSA(t *testing.T, caFile string) *httptest.Server {
+	t.Helper()
+
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	rootTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Root CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	rootDER, err := x509.CreateCertificate(rand.Reader, rootTmpl, rootTmpl, rootKey.Public(), rootKey)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	root, err := x509.ParseCertificate(rootDER)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	tsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	ekuValue, err := asn1.Marshal([]asn1.ObjectIdentifier{rfc3161.OidExtKeyUsageTimeStamping})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	tsaTmpl := &x509.Certificate{
+		SerialNumber:    big.NewInt(2),
+		Subject:         pkix.Name{CommonName: "Test TSA"},
+		NotBefore:       time.Now().Add(-time.Hour),
+		NotAfter:        time.Now().Add(time.Hour),
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtraExtensions: []pkix.Extension{{Id: rfc3161.OidExtKeyUsage, Critical: true, Value: ekuValue}},
+	}
+	tsaDER, err := x509.CreateCertificate(rand.Reader, tsaTmpl, root, tsaKey.Public(), rootKey)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	tsaCert, err := x509.ParseCertificate(tsaDER)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	tsa, err := rfc3161.NewTSA(tsaCert, tsaKey, asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	tsa.IncludeTSAName = true
+
+	err = os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw}), 0644)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	srv := httptest.NewServer(tsa)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// runOK runs the command and fails the test on a non-zero exit code
+func runOK(t *testing.T, args ...string) string {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	if code := run(args, &stdout, &stderr); code != 0 {
+		t.Fatalf("tsa %s: exit code %d: %s", strings.Join(args, " "), code, stderr.String())
+	}
+	return stdout.String()
+}
+
+func TestQueryReplyVerify(t *testing.T) {
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	dataFile := filepath.Join(dir, "data.txt")
+	tsqFile := filepath.Join(dir, "data.tsq")
+	tsrFile := filepath.Join(dir, "data.tsr")
+	tokenFile := filepath.Join(dir, "data.tst")
+
+	srv := startTSA(t, caFile)
+	if err := os.WriteFile(dataFile, []byte("Hello world!"), 0644); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	runOK(t, "query", "-data", dataFile, "-hash", "sha384", "-cert", "-out", tsqFile)
+	text := runOK(t, "query", "-in", tsqFile, "-text")
+	if !strings.Contains(text, "Hash Algorithm: sha384") || !strings.Contains(text, "Certificate required: yes") {
+		t.Errorf("unexpected query text:\n%s", text)
+	}
+
+	runOK(t, "reply", "-queryfile", tsqFile, "-url", srv.URL, "-out", tsrFile)
+	text = runOK(t, "reply", "-in", tsrFile, "-text")
+	for _, want := range []string{"Status: A TimeStampToken, as requested, is present", "Policy OID: 1.3.6.1.4.1.99999.1", "TSA: DirName:CN=Test TSA"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("reply text does not contain %q:\n%s", want, text)
+		}
+	}
+
+	out := runOK(t, "verify", "-in", tsrFile, "-queryfile", tsqFile, "-CAfile", caFile)
+	if !strings.Contains(out, "Verification: OK") {
+		t.Errorf("unexpected verify output: %s", out)
+	}
+	runOK(t, "verify", "-in", tsrFile, "-data", dataFile, "-CAfile", caFile)
+
+	runOK(t, "reply", "-in", tsrFile, "-token_out", "-out", tokenFile)
+	runOK(t, "verify", "-in", tokenFile, "-token_in", "-data", dataFile, "-CAfile", caFile)
+
+	// Other data must not verify
+	if err := os.WriteFile(dataFile, []byte("Hello other world!"), 0644); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"verify", "-in", tsrFile, "-data", dataFile, "-CAfile", caFile}, &stdout, &stderr); code != 1 {
+		t.Errorf("expected exit code 1, got %d", code)
+	}
+	if !strings.Contains(stdout.String(), "Verification: FAILED") {
+		t.Errorf("unexpected verify output: %s", stdout.String())
+	}
+
+	// The query file would silently take over the other data
+	stdout.Reset()
+	stderr.Reset()
+	if code := run([]string{"verify", "-in", tsrFile, "-queryfile", tsqFile, "-data", dataFile, "-CAfile", caFile}, &stdout, &stderr); code != 1 {
+		t.Errorf("expected exit code 1, got %d", code)
+	}
+	if !strings.Contains(stderr.String(), "only one of -data, -digest and -queryfile may be given") {
+		t.Errorf("unexpected verify error: %s", stderr.String())
+	}
+}
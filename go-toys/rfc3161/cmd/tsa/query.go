@@ -0,0 +1,156 @@
+package main
+
+import (
+	"crypto"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/bukodi/playground/rfc3161"
+	"github.com/phayes/cryptoid"
+)
+
+// hashByName maps the openssl digest names to crypto.Hash
+var hashByName = map[string]crypto.Hash{
+	"sha1":     crypto.SHA1,
+	"sha224":   crypto.SHA224,
+	"sha256":   crypto.SHA256,
+	"sha384":   crypto.SHA384,
+	"sha512":   crypto.SHA512,
+	"sha3-224": crypto.SHA3_224,
+	"sha3-256": crypto.SHA3_256,
+	"sha3-384": crypto.SHA3_384,
+	"sha3-512": crypto.SHA3_512,
+}
+
+// hashName gets the openssl digest name of a crypto.Hash
+func hashName(hash crypto.Hash) string {
+	for name, h := range hashByName {
+		if h == hash {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+func runQuery(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("query", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	dataPtr := fs.String("data", "", "File to be time-stamped")
+	digestPtr := fs.String("digest", "", "Hex encoded digest of the data, instead of -data")
+	hashPtr := fs.String("hash", "sha256", "Digest algorithm: "+strings.Join(hashNames(), ", "))
+	policyPtr := fs.String("tspolicy", "", "Policy OID the TSA should use, e.g. 1.2.3.4")
+	noNoncePtr := fs.Bool("no_nonce", false, "Do not include a nonce in the request")
+	certPtr := fs.Bool("cert", false, "Ask the TSA to include its certificate in the response")
+	inPtr := fs.String("in", "", "Existing request to print instead of creating a new one")
+	textPtr := fs.Bool("text", false, "Print the request in human readable form instead of DER")
+	outPtr := fs.String("out", "", "Output file (default is stdout)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var tsq *rfc3161.TimeStampReq
+	var err error
+	if *inPtr != "" {
+		tsq, err = rfc3161.ReadTSQ(*inPtr)
+		if err != nil {
+			return err
+		}
+	} else {
+		tsq, err = newQuery(*dataPtr, *digestPtr, *hashPtr)
+		if err != nil {
+			return err
+		}
+		if *policyPtr != "" {
+			tsq.ReqPolicy, err = cryptoid.NewObjectIdentifier(*policyPtr)
+			if err != nil {
+				return err
+			}
+		}
+		if !*noNoncePtr {
+			err = tsq.GenerateNonce()
+			if err != nil {
+				return err
+			}
+		}
+		tsq.CertReq = *certPtr
+	}
+
+	return writeOutput(*outPtr, stdout, func(w io.Writer) error {
+		if *textPtr {
+			printQuery(w, tsq)
+			return nil
+		}
+		der, err := asn1.Marshal(*tsq)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(der)
+		return err
+	})
+}
+
+// newQuery creates a request from the data file or from the hex digest
+func newQuery(dataFile string, hexDigest string, hashAlgo string) (*rfc3161.TimeStampReq, error) {
+	hash, ok := hashByName[strings.ToLower(hashAlgo)]
+	if !ok || !hash.Available() {
+		return nil, fmt.Errorf("unsupported hash algorithm: %s", hashAlgo)
+	}
+
+	var digest []byte
+	var err error
+	switch {
+	case dataFile != "" && hexDigest != "":
+		return nil, errors.New("only one of -data and -digest may be given")
+	case dataFile != "":
+		digest, err = digestFile(dataFile, hash)
+	case hexDigest != "":
+		digest, err = hex.DecodeString(hexDigest)
+	default:
+		return nil, errors.New("one of -data or -digest is required")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rfc3161.NewTimeStampReq(hash, digest)
+}
+
+// digestFile hashes the content of the file
+func digestFile(filename string, hash crypto.Hash) ([]byte, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := hash.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+func hashNames() []string {
+	return []string{"sha1", "sha224", "sha256", "sha384", "sha512", "sha3-224", "sha3-256", "sha3-384", "sha3-512"}
+}
+
+// writeOutput runs write against the named file, or stdout if filename is empty
+func writeOutput(filename string, stdout io.Writer, write func(w io.Writer) error) error {
+	if filename == "" {
+		return write(stdout)
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
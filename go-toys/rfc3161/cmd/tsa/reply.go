@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bukodi/playground/rfc3161"
+)
+
+func runReply(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("reply", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	queryPtr := fs.String("queryfile", "", "Request to send to the TSA")
+	urlPtr := fs.String("url", "", "TSA URL. A comma separated list is tried in order.")
+	timeoutPtr := fs.Duration("timeout", 30*time.Second, "Timeout of the whole exchange with the TSA")
+	retriesPtr := fs.Int("retries", 0, "Number of retries per TSA URL for transient failures")
+	inPtr := fs.String("in", "", "Existing response to print instead of sending a request")
+	tokenInPtr := fs.Bool("token_in", false, "The -in file is a TimeStampToken instead of a full response")
+	tokenOutPtr := fs.Bool("token_out", false, "Output the TimeStampToken instead of the full response")
+	textPtr := fs.Bool("text", false, "Print the response in human readable form instead of DER")
+	outPtr := fs.String("out", "", "Output file (default is stdout)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var resp *rfc3161.TimeStampResp
+	var token *rfc3161.TimeStampToken
+	var err error
+	switch {
+	case *inPtr != "" && *queryPtr != "":
+		return errors.New("only one of -in and -queryfile may be given")
+	case *inPtr != "" && *tokenInPtr:
+		token, err = readToken(*inPtr)
+	case *inPtr != "":
+		resp, err = rfc3161.ReadTSR(*inPtr)
+	case *queryPtr != "":
+		resp, err = sendQuery(*queryPtr, *urlPtr, *timeoutPtr, *retriesPtr)
+	default:
+		return errors.New("one of -in or -queryfile is required")
+	}
+	if err != nil {
+		return err
+	}
+	if token == nil && *tokenOutPtr {
+		if resp.Status.Status.IsError() {
+			return &resp.Status
+		}
+		token = &resp.TimeStampToken
+	}
+
+	return writeOutput(*outPtr, stdout, func(w io.Writer) error {
+		var der []byte
+		var err error
+		switch {
+		case *textPtr && token != nil:
+			return printToken(w, token)
+		case *textPtr:
+			return printReply(w, resp)
+		case token != nil:
+			der, err = token.Marshal()
+		default:
+			der, err = resp.Marshal()
+		}
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(der)
+		return err
+	})
+}
+
+// sendQuery sends the request to the TSA. A rejection is not an error here,
+// it is part of the response that gets printed or saved.
+func sendQuery(queryFile string, urls string, timeout time.Duration, retries int) (*rfc3161.TimeStampResp, error) {
+	if urls == "" {
+		return nil, errors.New("-url is required with -queryfile")
+	}
+	tsq, err := rfc3161.ReadTSQ(queryFile)
+	if err != nil {
+		return nil, err
+	}
+
+	list := strings.Split(urls, ",")
+	client := rfc3161.NewClient(list[0], list[1:]...)
+	client.Retries = retries
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	resp, err := client.DoContext(ctx, tsq)
+	var statusErr *rfc3161.PKIStatusInfo
+	if err != nil && !errors.As(err, &statusErr) {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func readToken(filename string) (*rfc3161.TimeStampToken, error) {
+	der, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return rfc3161.ParseTimeStampToken(der)
+}
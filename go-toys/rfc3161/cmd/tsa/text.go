@@ -0,0 +1,139 @@
+package main
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+
+	"github.com/bukodi/playground/rfc3161"
+	"github.com/phayes/cryptoid"
+)
+
+// printQuery prints the request like "openssl ts -query -text"
+func printQuery(w io.Writer, tsq *rfc3161.TimeStampReq) {
+	fmt.Fprintf(w, "Version: %d\n", tsq.Version)
+	fmt.Fprintf(w, "Hash Algorithm: %s\n", hashAlgorithmName(tsq.MessageImprint.HashAlgorithm.Algorithm))
+	fmt.Fprintf(w, "Message data:\n")
+	printHexDump(w, tsq.MessageImprint.HashedMessage)
+	fmt.Fprintf(w, "Policy OID: %s\n", oidOrUnspecified(tsq.ReqPolicy))
+	fmt.Fprintf(w, "Nonce: %s\n", hexIntOrUnspecified(tsq.Nonce))
+	fmt.Fprintf(w, "Certificate required: %s\n", yesNo(tsq.CertReq))
+	printExtensions(w, tsq.Extensions)
+}
+
+// printReply prints the response like "openssl ts -reply -text"
+func printReply(w io.Writer, resp *rfc3161.TimeStampResp) error {
+	fmt.Fprintf(w, "Status info:\n")
+	fmt.Fprintf(w, "Status: %s\n", resp.Status.Status.Error())
+	fmt.Fprintf(w, "Status description: %s\n", orUnspecified(resp.Status.StatusString))
+	if resp.Status.Status.IsError() {
+		fmt.Fprintf(w, "Failure info: %s\n", resp.Status.FailInfo.Error())
+		return nil
+	}
+	fmt.Fprintf(w, "Failure info: unspecified\n\n")
+	return printToken(w, &resp.TimeStampToken)
+}
+
+// printToken prints the TSTInfo of the token
+func printToken(w io.Writer, token *rfc3161.TimeStampToken) error {
+	tst, err := token.GetTSTInfo()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "TST info:\n")
+	fmt.Fprintf(w, "Version: %d\n", tst.Version)
+	fmt.Fprintf(w, "Policy OID: %s\n", tst.Policy)
+	fmt.Fprintf(w, "Hash Algorithm: %s\n", hashAlgorithmName(tst.MessageImprint.HashAlgorithm.Algorithm))
+	fmt.Fprintf(w, "Message data:\n")
+	printHexDump(w, tst.MessageImprint.HashedMessage)
+	fmt.Fprintf(w, "Serial number: %s\n", hexIntOrUnspecified(tst.SerialNumber))
+	fmt.Fprintf(w, "Time stamp: %s\n", tst.GenTime.UTC().Format("Jan _2 15:04:05 2006 GMT"))
+	if tst.Accuracy == (rfc3161.Accuracy{}) {
+		fmt.Fprintf(w, "Accuracy: unspecified\n")
+	} else {
+		fmt.Fprintf(w, "Accuracy: %d seconds, %d millis, %d micros\n", tst.Accuracy.Seconds, tst.Accuracy.Millis, tst.Accuracy.Micros)
+	}
+	fmt.Fprintf(w, "Ordering: %s\n", yesNo(tst.Ordering))
+	fmt.Fprintf(w, "Nonce: %s\n", hexIntOrUnspecified(tst.Nonce))
+	fmt.Fprintf(w, "TSA: %s\n", tsaName(tst.TSA))
+	printExtensions(w, tst.Extensions)
+	return nil
+}
+
+func printHexDump(w io.Writer, data []byte) {
+	for _, line := range strings.Split(strings.TrimRight(hex.Dump(data), "\n"), "\n") {
+		fmt.Fprintf(w, "    %s\n", line)
+	}
+}
+
+func printExtensions(w io.Writer, exts []pkix.Extension) {
+	fmt.Fprintf(w, "Extensions:\n")
+	for _, ext := range exts {
+		critical := ""
+		if ext.Critical {
+			critical = " (critical)"
+		}
+		fmt.Fprintf(w, "    %s%s: %s\n", ext.Id, critical, hex.EncodeToString(ext.Value))
+	}
+}
+
+// tsaName formats the TSA GeneralName. Only the directoryName is decoded.
+func tsaName(raw asn1.RawValue) string {
+	if len(raw.Bytes) == 0 {
+		return "unspecified"
+	}
+	var name asn1.RawValue
+	if _, err := asn1.Unmarshal(raw.Bytes, &name); err != nil {
+		return "invalid"
+	}
+	if name.Class == asn1.ClassContextSpecific && name.Tag == 4 {
+		var rdns pkix.RDNSequence
+		if _, err := asn1.Unmarshal(name.Bytes, &rdns); err == nil {
+			var dn pkix.Name
+			dn.FillFromRDNSequence(&rdns)
+			return "DirName:" + dn.String()
+		}
+	}
+	return fmt.Sprintf("GeneralName [%d]: %s", name.Tag, hex.EncodeToString(name.Bytes))
+}
+
+func hashAlgorithmName(oid asn1.ObjectIdentifier) string {
+	hashAlgo, err := cryptoid.HashAlgorithmByOID(oid.String())
+	if err != nil {
+		return oid.String()
+	}
+	return hashName(hashAlgo.Hash)
+}
+
+func hexIntOrUnspecified(n *big.Int) string {
+	if n == nil {
+		return "unspecified"
+	}
+	return fmt.Sprintf("0x%X", n)
+}
+
+func oidOrUnspecified(oid asn1.ObjectIdentifier) string {
+	if len(oid) == 0 {
+		return "unspecified"
+	}
+	return oid.String()
+}
+
+func orUnspecified(s string) string {
+	if s == "" {
+		return "unspecified"
+	}
+	return s
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/bukodi/playground/rfc3161"
+)
+
+func runVerify(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	inPtr := fs.String("in", "", "Response to verify (required)")
+	tokenInPtr := fs.Bool("token_in", false, "The -in file is a TimeStampToken instead of a full response")
+	dataPtr := fs.String("data", "", "File that was time-stamped")
+	digestPtr := fs.String("digest", "", "Hex encoded digest of the data that was time-stamped")
+	queryPtr := fs.String("queryfile", "", "Request the response was created for. Also checks the nonce.")
+	caFilePtr := fs.String("CAfile", "", "PEM bundle of trusted CA certificates (default is the system roots)")
+	signerPtr := fs.String("signer", "", "PEM TSA certificate, if the response doesn't contain it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *inPtr == "" {
+		return errors.New("-in is required")
+	}
+	sources := 0
+	for _, s := range []string{*dataPtr, *digestPtr, *queryPtr} {
+		if s != "" {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return errors.New("only one of -data, -digest and -queryfile may be given")
+	}
+
+	err := verify(*inPtr, *tokenInPtr, *dataPtr, *digestPtr, *queryPtr, *caFilePtr, *signerPtr)
+	if err != nil {
+		fmt.Fprintf(stdout, "Verification: FAILED\n")
+		return err
+	}
+	fmt.Fprintf(stdout, "Verification: OK\n")
+	return nil
+}
+
+func verify(in string, tokenIn bool, dataFile, hexDigest, queryFile, caFile, signerFile string) error {
+	if caFile != "" {
+		pemData, err := os.ReadFile(caFile)
+		if err != nil {
+			return err
+		}
+		rfc3161.RootCerts = x509.NewCertPool()
+		if !rfc3161.RootCerts.AppendCertsFromPEM(pemData) {
+			return fmt.Errorf("no certificates found in %s", caFile)
+		}
+	}
+
+	var signer *x509.Certificate
+	if signerFile != "" {
+		var err error
+		signer, err = readCertificate(signerFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	var token *rfc3161.TimeStampToken
+	if tokenIn {
+		var err error
+		token, err = readToken(in)
+		if err != nil {
+			return err
+		}
+	} else {
+		resp, err := rfc3161.ReadTSR(in)
+		if err != nil {
+			return err
+		}
+		if queryFile != "" {
+			tsq, err := rfc3161.ReadTSQ(queryFile)
+			if err != nil {
+				return err
+			}
+			return resp.Verify(tsq, signer)
+		}
+		if resp.Status.Status.IsError() {
+			return &resp.Status
+		}
+		token = &resp.TimeStampToken
+	}
+
+	var digest []byte
+	var err error
+	switch {
+	case dataFile != "":
+		hash := token.GetHash()
+		if hash == 0 || !hash.Available() {
+			return rfc3161.ErrUnsupportedHash
+		}
+		digest, err = digestFile(dataFile, hash)
+	case hexDigest != "":
+		digest, err = hex.DecodeString(hexDigest)
+	case queryFile != "":
+		tsq, err := rfc3161.ReadTSQ(queryFile)
+		if err != nil {
+			return err
+		}
+		digest = tsq.MessageImprint.HashedMessage
+	default:
+		return errors.New("one of -data, -digest or -queryfile is required")
+	}
+	if err != nil {
+		return err
+	}
+	return token.VerifyContext(context.Background(), digest, signer, nil)
+}
+
+func readCertificate(filename string) (*x509.Certificate, error) {
+	pemData, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", filename)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
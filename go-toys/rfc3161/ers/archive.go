@@ -0,0 +1,154 @@
+package ers
+
+import (
+	"context"
+	"crypto"
+	"encoding/asn1"
+
+	"github.com/bukodi/playground/rfc3161"
+)
+
+// New creates the initial evidence records of data objects given by their digests (RFC 4998 4.2).
+// The digests must be calculated with hash. All records share a single time-stamp over the root
+// of the hash tree built from the digests; records[i] belongs to digests[i].
+func New(ctx context.Context, ts TimeStamper, hash crypto.Hash, digests [][]byte) ([]*EvidenceRecord, error) {
+	ats, err := archiveTimeStamps(ctx, ts, hash, digests)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]*EvidenceRecord, len(digests))
+	for i := range records {
+		er := new(EvidenceRecord)
+		er.Version = 1
+		er.addDigestAlgorithm(hash)
+		er.ArchiveTimeStampSequence = ArchiveTimeStampSequence{{ats[i]}}
+		records[i] = er
+	}
+	return records, nil
+}
+
+// RenewTimeStamps does a time-stamp renewal of the records (RFC 4998 5.2).
+// It must be done before the TSA certificate of the last time-stamp expires or
+// its signature algorithm becomes weak. The new Archive Timestamps cover the last
+// time-stamp of every record, hashed with the digest algorithm of its chain.
+// One time-stamp is requested for every digest algorithm in use.
+//
+// The records are only changed if all time-stamps were successfully acquired.
+func RenewTimeStamps(ctx context.Context, ts TimeStamper, records []*EvidenceRecord) error {
+	// Group the records by the digest algorithm of their last chain
+	var hashes []crypto.Hash
+	groups := make(map[crypto.Hash][]int)
+	leaves := make(map[crypto.Hash][][]byte)
+	for i, er := range records {
+		if len(er.ArchiveTimeStampSequence) == 0 {
+			return ErrEmptyEvidenceRecord
+		}
+		chain := er.ArchiveTimeStampSequence[len(er.ArchiveTimeStampSequence)-1]
+		hash, err := chain.GetHash()
+		if err != nil {
+			return err
+		}
+		der, err := chain[len(chain)-1].TimeStamp.Marshal()
+		if err != nil {
+			return err
+		}
+		if _, ok := groups[hash]; !ok {
+			hashes = append(hashes, hash)
+		}
+		groups[hash] = append(groups[hash], i)
+		leaves[hash] = append(leaves[hash], hashOf(hash, der))
+	}
+
+	renewed := make([]ArchiveTimeStamp, len(records))
+	for _, hash := range hashes {
+		ats, err := archiveTimeStamps(ctx, ts, hash, leaves[hash])
+		if err != nil {
+			return err
+		}
+		for j, i := range groups[hash] {
+			renewed[i] = ats[j]
+		}
+	}
+
+	for i, er := range records {
+		last := len(er.ArchiveTimeStampSequence) - 1
+		er.ArchiveTimeStampSequence[last] = append(er.ArchiveTimeStampSequence[last], renewed[i])
+	}
+	return nil
+}
+
+// RenewHashTrees does a hash-tree renewal of the records with a new digest algorithm (RFC 4998 5.2).
+// It must be done before the digest algorithm in use becomes weak. digests[i] is the digest of
+// the data object of records[i], calculated with the new hash. Every record gets a new chain whose
+// Archive Timestamp covers both the data object and the complete ArchiveTimeStampSequence so far.
+//
+// The records are only changed if the time-stamp was successfully acquired.
+func RenewHashTrees(ctx context.Context, ts TimeStamper, hash crypto.Hash, records []*EvidenceRecord, digests [][]byte) error {
+	if len(digests) != len(records) {
+		return ErrDigestCount
+	}
+	if !hash.Available() {
+		return rfc3161.ErrUnsupportedHash
+	}
+	leaves := make([][]byte, len(records))
+	for i, er := range records {
+		if len(er.ArchiveTimeStampSequence) == 0 {
+			return ErrEmptyEvidenceRecord
+		}
+		leaf, err := renewedLeaf(hash, digests[i], er.ArchiveTimeStampSequence)
+		if err != nil {
+			return err
+		}
+		leaves[i] = leaf
+	}
+
+	ats, err := archiveTimeStamps(ctx, ts, hash, leaves)
+	if err != nil {
+		return err
+	}
+	for i, er := range records {
+		er.addDigestAlgorithm(hash)
+		er.ArchiveTimeStampSequence = append(er.ArchiveTimeStampSequence, ArchiveTimeStampChain{ats[i]})
+	}
+	return nil
+}
+
+// renewedLeaf calculates the hash value covered by the first Archive Timestamp of a
+// renewed hash tree: H(h(d) + H(atsc)), where atsc is the DER encoded
+// ArchiveTimeStampSequence preceding the new chain.
+func renewedLeaf(hash crypto.Hash, dataDigest []byte, atsc ArchiveTimeStampSequence) ([]byte, error) {
+	if len(dataDigest) != hash.Size() {
+		return nil, rfc3161.ErrInvalidDigestSize
+	}
+	der, err := asn1.Marshal(atsc)
+	if err != nil {
+		return nil, err
+	}
+	return hashOf(hash, dataDigest, hashOf(hash, der)), nil
+}
+
+// archiveTimeStamps time-stamps the root of the hash tree over the leaves
+// and creates the Archive Timestamp of every leaf
+func archiveTimeStamps(ctx context.Context, ts TimeStamper, hash crypto.Hash, leaves [][]byte) ([]ArchiveTimeStamp, error) {
+	tree, err := rfc3161.NewHashTree(hash, leaves)
+	if err != nil {
+		return nil, err
+	}
+	token, err := ts.TimeStamp(ctx, hash, tree.Root())
+	if err != nil {
+		return nil, err
+	}
+	if token.GetHash() != hash {
+		return nil, ErrDigestAlgorithmMismatch
+	}
+
+	ats := make([]ArchiveTimeStamp, len(leaves))
+	for i := range ats {
+		reduced, err := tree.ReducedHashtree(i)
+		if err != nil {
+			return nil, err
+		}
+		ats[i] = ArchiveTimeStamp{ReducedHashtree: reduced, TimeStamp: *token}
+	}
+	return ats, nil
+}
@@ -0,0 +1,158 @@
+// Package ers implements Evidence Records as defined by RFC 4998 (Evidence Record Syntax).
+//
+// An evidence record proves the existence of a data object at a point in time for longer
+// than a single time-stamp stays valid. Many data objects are grouped in a Merkle hash tree
+// whose root is time-stamped once (New). Before the TSA certificate of the last time-stamp
+// expires, the time-stamps are renewed (RenewTimeStamps). Before the hash algorithm becomes
+// weak, the hash trees are renewed with a new algorithm over the data objects themselves
+// (RenewHashTrees). Verify checks the complete ArchiveTimeStampSequence.
+package ers
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+
+	"github.com/bukodi/playground/rfc3161"
+	"github.com/phayes/cryptoid"
+)
+
+// Errors
+var (
+	ErrEmptyEvidenceRecord        = errors.New("rfc3161: ers: Evidence record has no Archive Timestamp")
+	ErrMixedDigestAlgorithms      = errors.New("rfc3161: ers: Archive Timestamps of a chain use different digest algorithms")
+	ErrDigestAlgorithmMismatch    = errors.New("rfc3161: ers: Time-stamp token does not use the digest algorithm of the Archive Timestamp")
+	ErrTimeStampOrder             = errors.New("rfc3161: ers: Archive Timestamp is older than the one it renews")
+	ErrDigestCount                = errors.New("rfc3161: ers: Number of digests does not match the number of evidence records")
+	ErrUnsupportedVersion         = errors.New("rfc3161: ers: Unsupported evidence record version")
+	ErrUnsupportedDigestAlgorithm = errors.New("rfc3161: ers: Unsupported digest algorithm")
+)
+
+// TimeStamper gets a TimeStampToken for a digest.
+// It is implemented by *rfc3161.Client for a remote TSA and by *rfc3161.TSA for a local one.
+type TimeStamper interface {
+	TimeStamp(ctx context.Context, hash crypto.Hash, digest []byte) (*rfc3161.TimeStampToken, error)
+}
+
+// EvidenceRecord is defined in RFC 4998 3
+type EvidenceRecord struct {
+	Version                  int                        // Always 1
+	DigestAlgorithms         []pkix.AlgorithmIdentifier // All digest algorithms used in the ArchiveTimeStampSequence
+	CryptoInfos              []rfc3161.Attribute        `asn1:"optional,tag:0"` // Information useful for verification, e.g. certificates
+	EncryptionInfo           EncryptionInfo             `asn1:"optional,tag:1"` // Present if encrypted data objects were time-stamped
+	ArchiveTimeStampSequence ArchiveTimeStampSequence
+}
+
+// EncryptionInfo is defined in RFC 4998 3
+type EncryptionInfo struct {
+	EncryptionInfoType  asn1.ObjectIdentifier
+	EncryptionInfoValue asn1.RawValue
+}
+
+// ArchiveTimeStampSequence is defined in RFC 4998 5.
+// A new ArchiveTimeStampChain is started by every hash-tree renewal.
+type ArchiveTimeStampSequence []ArchiveTimeStampChain
+
+// ArchiveTimeStampChain is defined in RFC 4998 5.
+// A new ArchiveTimeStamp is added by every time-stamp renewal. All of them use the same digest algorithm.
+type ArchiveTimeStampChain []ArchiveTimeStamp
+
+// ArchiveTimeStamp is defined in RFC 4998 4.1
+type ArchiveTimeStamp struct {
+	DigestAlgorithm pkix.AlgorithmIdentifier  `asn1:"optional,tag:0"` // If absent, the hash algorithm of the time-stamp's messageImprint
+	Attributes      []rfc3161.Attribute       `asn1:"optional,tag:1,set"`
+	ReducedHashtree []rfc3161.PartialHashtree `asn1:"optional,tag:2"` // If absent, the time-stamp covers the hash value directly
+	TimeStamp       rfc3161.TimeStampToken
+}
+
+// Parse parses a DER encoded EvidenceRecord
+func Parse(der []byte) (*EvidenceRecord, error) {
+	er := new(EvidenceRecord)
+	rest, err := asn1.Unmarshal(der, er)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return er, rfc3161.ErrUnrecognizedData
+	}
+	if er.Version != 1 {
+		return er, ErrUnsupportedVersion
+	}
+	return er, nil
+}
+
+// Marshal gets the DER encoding of the EvidenceRecord
+func (er *EvidenceRecord) Marshal() ([]byte, error) {
+	return asn1.Marshal(*er)
+}
+
+// GetHash gets the digest algorithm of the Archive Timestamp.
+// The hash will be 0 if it is not recognized.
+func (ats *ArchiveTimeStamp) GetHash() crypto.Hash {
+	if len(ats.DigestAlgorithm.Algorithm) == 0 {
+		return ats.TimeStamp.GetHash()
+	}
+	return hashByOID(ats.DigestAlgorithm.Algorithm)
+}
+
+// GetHash gets the digest algorithm of the chain
+func (chain ArchiveTimeStampChain) GetHash() (crypto.Hash, error) {
+	if len(chain) == 0 {
+		return 0, ErrEmptyEvidenceRecord
+	}
+	hash := chain[0].GetHash()
+	if hash == 0 || !hash.Available() {
+		return 0, ErrUnsupportedDigestAlgorithm
+	}
+	for i := range chain[1:] {
+		if chain[i+1].GetHash() != hash {
+			return 0, ErrMixedDigestAlgorithms
+		}
+	}
+	return hash, nil
+}
+
+// Hashes gets the digest algorithms of the chains, in order.
+// Verify needs the digest of the data object under each of them.
+func (er *EvidenceRecord) Hashes() ([]crypto.Hash, error) {
+	var hashes []crypto.Hash
+	for _, chain := range er.ArchiveTimeStampSequence {
+		hash, err := chain.GetHash()
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, nil
+}
+
+// addDigestAlgorithm adds the hash to DigestAlgorithms unless it is already there
+func (er *EvidenceRecord) addDigestAlgorithm(hash crypto.Hash) {
+	oid := cryptoid.HashAlgorithmByCrypto(hash).OID
+	for _, algo := range er.DigestAlgorithms {
+		if algo.Algorithm.Equal(oid) {
+			return
+		}
+	}
+	er.DigestAlgorithms = append(er.DigestAlgorithms, pkix.AlgorithmIdentifier{Algorithm: oid})
+}
+
+// hashByOID gets the crypto.Hash of a digest algorithm OID, or 0 if it is not recognized
+func hashByOID(oid asn1.ObjectIdentifier) crypto.Hash {
+	algo, err := cryptoid.HashAlgorithmByOID(oid.String())
+	if err != nil {
+		return 0
+	}
+	return algo.Hash
+}
+
+// hashOf hashes the concatenation of the values
+func hashOf(hash crypto.Hash, values ...[]byte) []byte {
+	h := hash.New()
+	for _, value := range values {
+		h.Write(value)
+	}
+	return h.Sum(nil)
+}
@@ -0,0 +1,219 @@
+package ers_test
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/bukodi/playground/rfc3161"
+	"github.com/bukodi/playground/rfc3161/ers"
+)
+
+var testPolicy = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1}
+
+// testPKI is a root CA issuing TSA certificates with arbitrary validity
+type testPKI struct {
+	root    *x509.Certificate
+	rootKey crypto.Signer
+	serial  int64
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	t.Helper()
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Archive Root CA"},
+		NotBefore:             time.Now().Add(-24 * time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, rootKey.Public(), rootKey)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	root, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	rfc3161.RootCerts = x509.NewCertPool()
+	rfc3161.RootCerts.AddCert(root)
+	return &testPKI{root: root, rootKey: rootKey, serial: 1}
+}
+
+// newTSA creates a TSA whose certificate is valid between notBefore and notAfter,
+// and whose clock says now
+func (pki *testPKI) newTSA(t *testing.T, notBefore, notAfter, now time.Time) *rfc3161.TSA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	ekuValue, err := asn1.Marshal([]asn1.ObjectIdentifier{rfc3161.OidExtKeyUsageTimeStamping})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	pki.serial++
+	tmpl := &x509.Certificate{
+		SerialNumber:    big.NewInt(pki.serial),
+		Subject:         pkix.Name{CommonName: fmt.Sprint("Test TSA ", pki.serial)},
+		NotBefore:       notBefore,
+		NotAfter:        notAfter,
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtraExtensions: []pkix.Extension{{Id: rfc3161.OidExtKeyUsage, Critical: true, Value: ekuValue}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, pki.root, key.Public(), pki.rootKey)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	tsa, err := rfc3161.NewTSA(cert, key, testPolicy)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	tsa.Now = func() time.Time { return now }
+	return tsa
+}
+
+func testDocuments(n int) [][]byte {
+	var docs [][]byte
+	for i := 0; i < n; i++ {
+		docs = append(docs, []byte(fmt.Sprint("archived document ", i)))
+	}
+	return docs
+}
+
+func digests(hash crypto.Hash, docs [][]byte) [][]byte {
+	var ds [][]byte
+	for _, doc := range docs {
+		h := hash.New()
+		h.Write(doc)
+		ds = append(ds, h.Sum(nil))
+	}
+	return ds
+}
+
+func TestEvidenceRecordLifecycle(t *testing.T) {
+	ctx := context.Background()
+	pki := newTestPKI(t)
+	now := time.Now().Truncate(time.Second)
+
+	// The first TSA certificate has expired by now, but the time-stamps were renewed in time
+	tsa1 := pki.newTSA(t, now.Add(-3*time.Hour), now.Add(-time.Hour), now.Add(-2*time.Hour))
+	tsa2 := pki.newTSA(t, now.Add(-2*time.Hour), now.Add(time.Hour), now.Add(-90*time.Minute))
+	tsa3 := pki.newTSA(t, now.Add(-2*time.Hour), now.Add(time.Hour), now)
+
+	docs := testDocuments(5)
+	records, err := ers.New(ctx, tsa1, crypto.SHA256, digests(crypto.SHA256, docs))
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if len(records) != len(docs) {
+		t.Fatalf("got %d records", len(records))
+	}
+	token := records[0].ArchiveTimeStampSequence[0][0].TimeStamp
+	if !bytes.Equal(token.SignedData.EContent, records[4].ArchiveTimeStampSequence[0][0].TimeStamp.SignedData.EContent) {
+		t.Errorf("records should share one time-stamp")
+	}
+	// The first TSA certificate has expired
+	if _, err := records[0].Verify(ctx, ers.DataDigest(docs[0]), nil); err == nil {
+		t.Errorf("expected expired TSA certificate error")
+	}
+
+	if err := ers.RenewTimeStamps(ctx, tsa2, records); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	for i, er := range records {
+		genTime, err := er.Verify(ctx, ers.DataDigest(docs[i]), nil)
+		if err != nil {
+			t.Fatalf("record %d: %+v", i, err)
+		}
+		if !genTime.Equal(now.Add(-2 * time.Hour)) {
+			t.Errorf("record %d: proven time: got %v", i, genTime)
+		}
+	}
+	// docs[1] is the sibling of docs[0], so it's in the first partial hashtree too
+	if _, err := records[0].Verify(ctx, ers.DataDigest(docs[4]), nil); !errors.Is(err, rfc3161.ErrLeafNotInHashtree) {
+		t.Errorf("expected ErrLeafNotInHashtree, got %v", err)
+	}
+
+	if err := ers.RenewHashTrees(ctx, tsa3, crypto.SHA512, records, digests(crypto.SHA512, docs)); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	for i, er := range records {
+		hashes, err := er.Hashes()
+		if err != nil || len(hashes) != 2 || hashes[0] != crypto.SHA256 || hashes[1] != crypto.SHA512 {
+			t.Errorf("record %d: hashes: %v, %v", i, hashes, err)
+		}
+		if len(er.DigestAlgorithms) != 2 {
+			t.Errorf("record %d: digest algorithms: %v", i, er.DigestAlgorithms)
+		}
+
+		der, err := er.Marshal()
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+		parsed, err := ers.Parse(der)
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+		if _, err := parsed.Verify(ctx, ers.DataDigest(docs[i]), nil); err != nil {
+			t.Fatalf("record %d: %+v", i, err)
+		}
+	}
+
+	// The renewed hash tree covers the earlier chains
+	records[2].ArchiveTimeStampSequence[0] = records[2].ArchiveTimeStampSequence[0][:1]
+	if _, err := records[2].Verify(ctx, ers.DataDigest(docs[2]), nil); err == nil {
+		t.Errorf("expected error for a tampered ArchiveTimeStampSequence")
+	}
+}
+
+func TestEvidenceRecordSingleDocument(t *testing.T) {
+	ctx := context.Background()
+	pki := newTestPKI(t)
+	now := time.Now().Truncate(time.Second)
+	tsa := pki.newTSA(t, now.Add(-time.Hour), now.Add(time.Hour), now)
+
+	doc := []byte("a single document")
+	digest := sha512.Sum512(doc)
+	records, err := ers.New(ctx, tsa, crypto.SHA512, [][]byte{digest[:]})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if len(records[0].ArchiveTimeStampSequence[0][0].ReducedHashtree) != 0 {
+		t.Errorf("a single document should be time-stamped directly")
+	}
+	if _, err := records[0].Verify(ctx, ers.DataDigest(doc), nil); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	wrong := sha256.Sum256(doc)
+	if err := ers.RenewHashTrees(ctx, tsa, crypto.SHA512, records, [][]byte{wrong[:]}); !errors.Is(err, rfc3161.ErrInvalidDigestSize) {
+		t.Errorf("expected ErrInvalidDigestSize, got %v", err)
+	}
+	if err := ers.RenewHashTrees(ctx, tsa, crypto.SHA512, records, nil); !errors.Is(err, ers.ErrDigestCount) {
+		t.Errorf("expected ErrDigestCount, got %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package ers
+
+import (
+	"context"
+	"crypto"
+	"time"
+
+	"github.com/bukodi/playground/rfc3161"
+)
+
+// DigestFunc gets the digest of the data object calculated with the given hash.
+// Verify calls it once for every chain of the ArchiveTimeStampSequence.
+type DigestFunc func(hash crypto.Hash) ([]byte, error)
+
+// DataDigest gets a DigestFunc hashing the data in memory
+func DataDigest(data []byte) DigestFunc {
+	return func(hash crypto.Hash) ([]byte, error) {
+		if !hash.Available() {
+			return nil, rfc3161.ErrUnsupportedHash
+		}
+		return hashOf(hash, data), nil
+	}
+}
+
+// Verify verifies the complete ArchiveTimeStampSequence for the data object (RFC 4998 5.3)
+// and returns the time at which the data object is proven to have existed, the time of
+// the first Archive Timestamp.
+//
+// Every time-stamp must cover its hash tree. The TSA certificate chain of every time-stamp
+// is validated at the time of the Archive Timestamp that renews it, the last one at the
+// current time. A non-nil policy also checks the revocation status of the TSA certificates.
+func (er *EvidenceRecord) Verify(ctx context.Context, dataDigest DigestFunc, policy *rfc3161.RevocationPolicy) (time.Time, error) {
+	seq := er.ArchiveTimeStampSequence
+	if len(seq) == 0 {
+		return time.Time{}, ErrEmptyEvidenceRecord
+	}
+
+	// Parse all TSTInfos first, each time-stamp is verified at the time of the next one
+	var infos []*rfc3161.TSTInfo
+	for _, chain := range seq {
+		if len(chain) == 0 {
+			return time.Time{}, ErrEmptyEvidenceRecord
+		}
+		for i := range chain {
+			tst, err := chain[i].TimeStamp.GetTSTInfo()
+			if err != nil {
+				return time.Time{}, err
+			}
+			if n := len(infos); n > 0 && tst.GenTime.Before(infos[n-1].GenTime) {
+				return time.Time{}, ErrTimeStampOrder
+			}
+			infos = append(infos, tst)
+		}
+	}
+
+	n := 0
+	for k, chain := range seq {
+		hash, err := chain.GetHash()
+		if err != nil {
+			return time.Time{}, err
+		}
+		leaf, err := dataDigest(hash)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if k > 0 {
+			// Hash-tree renewal covers the preceding chains as well
+			leaf, err = renewedLeaf(hash, leaf, seq[:k])
+			if err != nil {
+				return time.Time{}, err
+			}
+		}
+
+		for i := range chain {
+			if i > 0 {
+				// Time-stamp renewal covers the previous time-stamp
+				der, err := chain[i-1].TimeStamp.Marshal()
+				if err != nil {
+					return time.Time{}, err
+				}
+				leaf = hashOf(hash, der)
+			}
+			if err := verifyArchiveTimeStamp(ctx, &chain[i], infos[n], hash, leaf, policy, nextGenTime(infos, n)); err != nil {
+				return time.Time{}, err
+			}
+			n++
+		}
+	}
+	return infos[0].GenTime, nil
+}
+
+// verifyArchiveTimeStamp checks that the Archive Timestamp covers the leaf and that its time-stamp is valid at the given time
+func verifyArchiveTimeStamp(ctx context.Context, ats *ArchiveTimeStamp, tst *rfc3161.TSTInfo, hash crypto.Hash, leaf []byte, policy *rfc3161.RevocationPolicy, at time.Time) error {
+	if hashByOID(tst.MessageImprint.HashAlgorithm.Algorithm) != hash {
+		return ErrDigestAlgorithmMismatch
+	}
+	root, err := rfc3161.ComputeRoot(hash, leaf, ats.ReducedHashtree)
+	if err != nil {
+		return err
+	}
+	return ats.TimeStamp.VerifyAt(ctx, root, nil, policy, at)
+}
+
+// nextGenTime gets the time of the Archive Timestamp after the n-th, or the zero time for the last one
+func nextGenTime(infos []*rfc3161.TSTInfo, n int) time.Time {
+	if n+1 < len(infos) {
+		return infos[n+1].GenTime
+	}
+	return time.Time{}
+}
@@ -0,0 +1,222 @@
+package rfc3161
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+
+	"github.com/phayes/cryptoid"
+)
+
+// Errors
+var (
+	ErrNoSigningCertificateAttr   = errors.New("rfc3161: response: SignerInfo has no signingCertificate or signingCertificateV2 attribute")
+	ErrSigningCertificateMismatch = errors.New("rfc3161: response: signingCertificate attribute does not match the signing certificate")
+)
+
+// OID Identifiers
+var (
+	// RFC-2634: iso(1) member-body(2) us(840) rsadsi(113549) pkcs(1) pkcs9(9) smime(16) id-aa(2) 12
+	OidSigningCertificate = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 12}
+
+	// RFC-5035: iso(1) member-body(2) us(840) rsadsi(113549) pkcs(1) pkcs9(9) smime(16) id-aa(2) 47
+	OidSigningCertificateV2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+)
+
+// SigningCertificate is the value of the signingCertificate attribute as defined by RFC 2634 5.4
+// The first ESSCertID identifies the certificate of the signer.
+type SigningCertificate struct {
+	Certs    []ESSCertID
+	Policies asn1.RawValue `asn1:"optional"` // SEQUENCE OF PolicyInformation
+}
+
+// ESSCertID identifies a certificate by its SHA-1 hash as defined by RFC 2634 5.4.1
+type ESSCertID struct {
+	CertHash     []byte
+	IssuerSerial IssuerSerial `asn1:"optional"`
+}
+
+// SigningCertificateV2 is the value of the signingCertificateV2 attribute as defined by RFC 5035 3
+// The first ESSCertIDv2 identifies the certificate of the signer.
+type SigningCertificateV2 struct {
+	Certs    []ESSCertIDv2
+	Policies asn1.RawValue `asn1:"optional"` // SEQUENCE OF PolicyInformation
+}
+
+// ESSCertIDv2 identifies a certificate by its hash as defined by RFC 5035 4.
+// If HashAlgorithm is absent, the hash algorithm is SHA-256.
+type ESSCertIDv2 struct {
+	HashAlgorithm pkix.AlgorithmIdentifier `asn1:"optional"`
+	CertHash      []byte
+	IssuerSerial  IssuerSerial `asn1:"optional"`
+}
+
+// IssuerSerial identifies a certificate by its issuer and serial number as defined by RFC 2634 5.4.1
+type IssuerSerial struct {
+	Issuer       asn1.RawValue // GeneralNames. The issuer is expected as a directoryName.
+	SerialNumber *big.Int
+}
+
+// NewESSCertID creates an ESSCertID for the certificate
+func NewESSCertID(cert *x509.Certificate) ESSCertID {
+	hash := crypto.SHA1.New()
+	hash.Write(cert.Raw)
+	return ESSCertID{CertHash: hash.Sum(nil), IssuerSerial: newIssuerSerial(cert)}
+}
+
+// NewESSCertIDv2 creates an ESSCertIDv2 for the certificate using the given hash algorithm.
+// RFC 5035 recommends SHA-256 or stronger.
+func NewESSCertIDv2(cert *x509.Certificate, hashAlgo crypto.Hash) (ESSCertIDv2, error) {
+	if !hashAlgo.Available() {
+		return ESSCertIDv2{}, ErrUnsupportedHash
+	}
+	hash := hashAlgo.New()
+	hash.Write(cert.Raw)
+
+	id := ESSCertIDv2{CertHash: hash.Sum(nil), IssuerSerial: newIssuerSerial(cert)}
+	// DER encoding omits the DEFAULT value
+	if hashAlgo != crypto.SHA256 {
+		id.HashAlgorithm = pkix.AlgorithmIdentifier{Algorithm: cryptoid.HashAlgorithmByCrypto(hashAlgo).OID}
+	}
+	return id, nil
+}
+
+// newIssuerSerial creates the IssuerSerial with the issuer as a directoryName
+func newIssuerSerial(cert *x509.Certificate) IssuerSerial {
+	directoryName, _ := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 4, IsCompound: true, Bytes: cert.RawIssuer})
+	return IssuerSerial{
+		Issuer:       asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSequence, IsCompound: true, Bytes: directoryName},
+		SerialNumber: cert.SerialNumber,
+	}
+}
+
+// matches checks the optional IssuerSerial against the certificate
+func (is *IssuerSerial) matches(cert *x509.Certificate) bool {
+	if is.SerialNumber == nil && len(is.Issuer.Bytes) == 0 {
+		// Absent
+		return true
+	}
+	if is.SerialNumber == nil || is.SerialNumber.Cmp(cert.SerialNumber) != 0 {
+		return false
+	}
+
+	// Look for the issuer among the directoryNames of the GeneralNames
+	rest := is.Issuer.Bytes
+	for len(rest) > 0 {
+		var name asn1.RawValue
+		var err error
+		rest, err = asn1.Unmarshal(rest, &name)
+		if err != nil {
+			return false
+		}
+		if name.Class == asn1.ClassContextSpecific && name.Tag == 4 && bytes.Equal(name.Bytes, cert.RawIssuer) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetSigningCertificate gets the value of the signingCertificate attribute.
+// It returns nil if the attribute is not present.
+func (si *SignerInfo) GetSigningCertificate() (*SigningCertificate, error) {
+	attr, err := si.signedAttr(OidSigningCertificate)
+	if err != nil || attr == nil {
+		return nil, err
+	}
+	sc := new(SigningCertificate)
+	rest, err := asn1.Unmarshal(attr.Value.Bytes, sc)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, ErrUnrecognizedData
+	}
+	return sc, nil
+}
+
+// GetSigningCertificateV2 gets the value of the signingCertificateV2 attribute.
+// It returns nil if the attribute is not present.
+func (si *SignerInfo) GetSigningCertificateV2() (*SigningCertificateV2, error) {
+	attr, err := si.signedAttr(OidSigningCertificateV2)
+	if err != nil || attr == nil {
+		return nil, err
+	}
+	sc := new(SigningCertificateV2)
+	rest, err := asn1.Unmarshal(attr.Value.Bytes, sc)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, ErrUnrecognizedData
+	}
+	return sc, nil
+}
+
+// signedAttr gets the single signed attribute of the given type, or nil if it is not present
+func (si *SignerInfo) signedAttr(attrType asn1.ObjectIdentifier) (*Attribute, error) {
+	var found *Attribute
+	for i := range si.SignedAttrs {
+		if si.SignedAttrs[i].Type.Equal(attrType) {
+			if found != nil {
+				return nil, ErrVerificationError
+			}
+			found = &si.SignedAttrs[i]
+		}
+	}
+	return found, nil
+}
+
+// VerifySigningCertificate checks that the signingCertificate and signingCertificateV2
+// attributes identify cert as the certificate of the signer (RFC 3161 2.4.2, RFC 5816).
+// At least one of them must be present, and every one present must match.
+func (si *SignerInfo) VerifySigningCertificate(cert *x509.Certificate) error {
+	v1, err := si.GetSigningCertificate()
+	if err != nil {
+		return err
+	}
+	v2, err := si.GetSigningCertificateV2()
+	if err != nil {
+		return err
+	}
+	if v1 == nil && v2 == nil {
+		return ErrNoSigningCertificateAttr
+	}
+
+	if v1 != nil {
+		if len(v1.Certs) == 0 {
+			return ErrSigningCertificateMismatch
+		}
+		id := v1.Certs[0]
+		hash := crypto.SHA1.New()
+		hash.Write(cert.Raw)
+		if !bytes.Equal(hash.Sum(nil), id.CertHash) || !id.IssuerSerial.matches(cert) {
+			return ErrSigningCertificateMismatch
+		}
+	}
+
+	if v2 != nil {
+		if len(v2.Certs) == 0 {
+			return ErrSigningCertificateMismatch
+		}
+		id := v2.Certs[0]
+		hashAlgo := crypto.SHA256
+		if len(id.HashAlgorithm.Algorithm) != 0 {
+			algo, err := cryptoid.HashAlgorithmByOID(id.HashAlgorithm.Algorithm.String())
+			if err != nil || !algo.Hash.Available() {
+				return ErrUnsupportedHash
+			}
+			hashAlgo = algo.Hash
+		}
+		hash := hashAlgo.New()
+		hash.Write(cert.Raw)
+		if !bytes.Equal(hash.Sum(nil), id.CertHash) || !id.IssuerSerial.matches(cert) {
+			return ErrSigningCertificateMismatch
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package rfc3161_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/bukodi/playground/rfc3161"
+)
+
+func TestSigningCertificateV2(t *testing.T) {
+	for _, hash := range []crypto.Hash{crypto.SHA1, crypto.SHA256, crypto.SHA384} {
+		t.Run(hash.String(), func(t *testing.T) {
+			key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			if err != nil {
+				t.Fatalf("%+v", err)
+			}
+			tsa, _ := newTestTSA(t, key)
+			tsa.Hash = hash
+			tsa.ESSCertIDv1 = true
+
+			tsreq := newTestReq(t)
+			tsrsp := tsa.Respond(tsreq)
+			if err := tsrsp.Verify(tsreq, nil); err != nil {
+				t.Fatalf("%+v", err)
+			}
+
+			signer := tsrsp.SignerInfos[0]
+			v1, err := signer.GetSigningCertificate()
+			if err != nil || v1 == nil {
+				t.Errorf("signingCertificate: %v, %v", v1, err)
+			}
+			v2, err := signer.GetSigningCertificateV2()
+			if err != nil {
+				t.Fatalf("%+v", err)
+			}
+			if hash == crypto.SHA1 && v2 != nil {
+				t.Errorf("signingCertificateV2 should not be emitted with SHA-1")
+			}
+			if hash != crypto.SHA1 && (v2 == nil || len(v2.Certs[0].CertHash) != hash.Size()) {
+				t.Errorf("signingCertificateV2: %v", v2)
+			}
+		})
+	}
+}
+
+// A second certificate for the same key must not be accepted as the signer
+func TestSigningCertificateSubstitution(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	root, rootKey, tsaCert := newTestPKI(t, key)
+	rfc3161.RootCerts = x509.NewCertPool()
+	rfc3161.RootCerts.AddCert(root)
+
+	tsa, err := rfc3161.NewTSA(tsaCert, key, testPolicy)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	otherTmpl := *tsaCert
+	otherTmpl.SerialNumber = big.NewInt(3)
+	otherTmpl.ExtraExtensions = tsaCert.Extensions
+	otherDER, err := x509.CreateCertificate(rand.Reader, &otherTmpl, root, key.Public(), rootKey)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	otherCert, err := x509.ParseCertificate(otherDER)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	tsreq := newTestReq(t)
+	tsreq.CertReq = false
+	tsrsp := tsa.Respond(tsreq)
+	if err := tsrsp.Verify(tsreq, tsaCert); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	err = tsrsp.Verify(tsreq, otherCert)
+	if !errors.Is(err, rfc3161.ErrSigningCertificateMismatch) {
+		t.Fatalf("expected ErrSigningCertificateMismatch, got %v", err)
+	}
+}
@@ -0,0 +1,15 @@
+package rfc3161
+
+import "testing"
+
+// RestoreExtensionsAfter snapshots the registered extensions, and restores them when the test ends
+func RestoreExtensionsAfter(t testing.TB) {
+	extensionsMu.RLock()
+	saved := append([]ExtensionType(nil), supportedExtensions...)
+	extensionsMu.RUnlock()
+	t.Cleanup(func() {
+		extensionsMu.Lock()
+		defer extensionsMu.Unlock()
+		supportedExtensions = saved
+	})
+}
@@ -0,0 +1,179 @@
+package rfc3161
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"sync"
+)
+
+// Errors
+var (
+	ErrExtensionNotFound      = errors.New("rfc3161: extension: Extension not present")
+	ErrExtensionNotRegistered = errors.New("rfc3161: extension: No codec registered for the extension")
+	ErrExtensionValueType     = errors.New("rfc3161: extension: Unexpected value type for the extension")
+)
+
+// ExtensionType describes an extension of TimeStampReq or TSTInfo.
+//
+// Decode converts the DER encoded extnValue into a Go value, Encode does the reverse.
+// Either may be nil: an extension without codecs is only accepted as critical,
+// which is all RegisterExtension does.
+type ExtensionType struct {
+	Id     asn1.ObjectIdentifier
+	Decode func(der []byte) (interface{}, error)
+	Encode func(value interface{}) ([]byte, error)
+}
+
+// Supported Extensions.
+var (
+	extensionsMu        sync.RWMutex
+	supportedExtensions []ExtensionType
+)
+
+// RegisterExtension registers a supported Extension.
+// This is intended to be called from the init function in
+// packages that implement support for these extensions.
+// A TimeStampReq or TimeStampResp with an unregistered
+// critical extension will return an error when verified.
+func RegisterExtension(extension asn1.ObjectIdentifier) {
+	RegisterExtensionType(ExtensionType{Id: extension})
+}
+
+// RegisterExtensionType registers a supported Extension together with its codecs.
+// Registering an already registered OID again sets the non-nil codecs of extType.
+// Like RegisterExtension, it is intended to be called from init functions.
+func RegisterExtensionType(extType ExtensionType) {
+	extensionsMu.Lock()
+	defer extensionsMu.Unlock()
+
+	// Check if it already exists
+	for i := range supportedExtensions {
+		if supportedExtensions[i].Id.Equal(extType.Id) {
+			if extType.Decode != nil {
+				supportedExtensions[i].Decode = extType.Decode
+			}
+			if extType.Encode != nil {
+				supportedExtensions[i].Encode = extType.Encode
+			}
+			return
+		}
+	}
+
+	// Add it
+	supportedExtensions = append(supportedExtensions, extType)
+}
+
+// ListExtensions lists all supported extensions
+func ListExtensions() []asn1.ObjectIdentifier {
+	extensionsMu.RLock()
+	defer extensionsMu.RUnlock()
+
+	oids := make([]asn1.ObjectIdentifier, 0, len(supportedExtensions))
+	for _, extType := range supportedExtensions {
+		oids = append(oids, extType.Id)
+	}
+	return oids
+}
+
+// LookupExtension gets the registered ExtensionType of the OID
+func LookupExtension(oid asn1.ObjectIdentifier) (ExtensionType, bool) {
+	extensionsMu.RLock()
+	defer extensionsMu.RUnlock()
+
+	for _, extType := range supportedExtensions {
+		if extType.Id.Equal(oid) {
+			return extType, true
+		}
+	}
+	return ExtensionType{}, false
+}
+
+// NewExtension creates an extension with the value encoded by the registered encoder of the OID
+func NewExtension(oid asn1.ObjectIdentifier, critical bool, value interface{}) (pkix.Extension, error) {
+	extType, ok := LookupExtension(oid)
+	if !ok || extType.Encode == nil {
+		return pkix.Extension{}, ErrExtensionNotRegistered
+	}
+	der, err := extType.Encode(value)
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+	return pkix.Extension{Id: oid, Critical: critical, Value: der}, nil
+}
+
+// DecodeExtension decodes the value of the extension with the registered decoder of its OID
+func DecodeExtension(ext pkix.Extension) (interface{}, error) {
+	extType, ok := LookupExtension(ext.Id)
+	if !ok || extType.Decode == nil {
+		return nil, ErrExtensionNotRegistered
+	}
+	return extType.Decode(ext.Value)
+}
+
+// checkCriticalExtensions returns ErrUnsupportedExt if any critical extension is not registered
+func checkCriticalExtensions(exts []pkix.Extension) error {
+	for _, ext := range exts {
+		if ext.Critical {
+			if _, ok := LookupExtension(ext.Id); !ok {
+				return ErrUnsupportedExt
+			}
+		}
+	}
+	return nil
+}
+
+// getExtension decodes the extension of the given type
+func getExtension(exts []pkix.Extension, oid asn1.ObjectIdentifier) (interface{}, error) {
+	for _, ext := range exts {
+		if ext.Id.Equal(oid) {
+			return DecodeExtension(ext)
+		}
+	}
+	return nil, ErrExtensionNotFound
+}
+
+// setExtension replaces the extension of the same type, or appends it
+func setExtension(exts []pkix.Extension, ext pkix.Extension) []pkix.Extension {
+	for i := range exts {
+		if exts[i].Id.Equal(ext.Id) {
+			exts[i] = ext
+			return exts
+		}
+	}
+	return append(exts, ext)
+}
+
+// GetExtension decodes the value of the given extension with its registered decoder.
+// It returns ErrExtensionNotFound if the request doesn't have the extension.
+func (tsr *TimeStampReq) GetExtension(oid asn1.ObjectIdentifier) (interface{}, error) {
+	return getExtension(tsr.Extensions, oid)
+}
+
+// SetExtension encodes the value with the registered encoder and adds it
+// as an extension, replacing any previous extension of the same type.
+func (tsr *TimeStampReq) SetExtension(oid asn1.ObjectIdentifier, critical bool, value interface{}) error {
+	ext, err := NewExtension(oid, critical, value)
+	if err != nil {
+		return err
+	}
+	tsr.Extensions = setExtension(tsr.Extensions, ext)
+	return nil
+}
+
+// GetExtension decodes the value of the given extension with its registered decoder.
+// It returns ErrExtensionNotFound if the TSTInfo doesn't have the extension.
+func (tst *TSTInfo) GetExtension(oid asn1.ObjectIdentifier) (interface{}, error) {
+	return getExtension(tst.Extensions, oid)
+}
+
+// SetExtension encodes the value with the registered encoder and adds it
+// as an extension, replacing any previous extension of the same type.
+func (tst *TSTInfo) SetExtension(oid asn1.ObjectIdentifier, critical bool, value interface{}) error {
+	ext, err := NewExtension(oid, critical, value)
+	if err != nil {
+		return err
+	}
+	tst.Extensions = setExtension(tst.Extensions, ext)
+	return nil
+}
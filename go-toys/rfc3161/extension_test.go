@@ -0,0 +1,137 @@
+package rfc3161_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"testing"
+
+	"github.com/bukodi/playground/rfc3161"
+)
+
+var testExtension = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 2}
+
+func init() {
+	rfc3161.RegisterExtensionType(rfc3161.ExtensionType{
+		Id: testExtension,
+		Decode: func(der []byte) (interface{}, error) {
+			var s string
+			_, err := asn1.Unmarshal(der, &s)
+			return s, err
+		},
+		Encode: func(value interface{}) ([]byte, error) {
+			s, ok := value.(string)
+			if !ok {
+				return nil, rfc3161.ErrExtensionValueType
+			}
+			return asn1.Marshal(s)
+		},
+	})
+}
+
+func TestExtensionRegistry(t *testing.T) {
+	found := false
+	for _, oid := range rfc3161.ListExtensions() {
+		found = found || oid.Equal(testExtension)
+	}
+	if !found {
+		t.Errorf("registered extension is not listed")
+	}
+
+	// Re-registering by OID only keeps the codecs
+	rfc3161.RegisterExtension(testExtension)
+
+	tsreq := newTestReq(t)
+	if err := tsreq.SetExtension(testExtension, true, "hello"); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if err := tsreq.SetExtension(testExtension, true, 42); !errors.Is(err, rfc3161.ErrExtensionValueType) {
+		t.Errorf("expected ErrExtensionValueType, got %v", err)
+	}
+	if err := tsreq.Verify(); err != nil {
+		t.Fatalf("registered critical extension: %+v", err)
+	}
+	value, err := tsreq.GetExtension(testExtension)
+	if err != nil || value != "hello" {
+		t.Errorf("got %v, %v", value, err)
+	}
+	if len(tsreq.Extensions) != 1 {
+		t.Errorf("SetExtension should replace, got %d extensions", len(tsreq.Extensions))
+	}
+
+	if _, err := tsreq.GetExtension(rfc3161.OidExtQCStatements); !errors.Is(err, rfc3161.ErrExtensionNotFound) {
+		t.Errorf("expected ErrExtensionNotFound, got %v", err)
+	}
+	unknown := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 3}
+	tsreq.Extensions = append(tsreq.Extensions, pkix.Extension{Id: unknown, Critical: true, Value: []byte{5, 0}})
+	if _, err := tsreq.GetExtension(unknown); !errors.Is(err, rfc3161.ErrExtensionNotRegistered) {
+		t.Errorf("expected ErrExtensionNotRegistered, got %v", err)
+	}
+	if err := tsreq.Verify(); !errors.Is(err, rfc3161.ErrUnsupportedExt) {
+		t.Errorf("expected ErrUnsupportedExt, got %v", err)
+	}
+}
+
+func TestQualifiedTimeStamp(t *testing.T) {
+	// RegisterQCStatements below changes the process-global registry
+	rfc3161.RestoreExtensionsAfter(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	tsa, _ := newTestTSA(t, key)
+	qualified, err := rfc3161.NewQualifiedTimeStampExtension()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	tsa.Extensions = []pkix.Extension{qualified}
+
+	tsreq := newTestReq(t)
+	tsrsp := tsa.Respond(tsreq)
+	if err := tsrsp.Verify(tsreq, nil); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	tst, err := tsrsp.GetTSTInfo()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if !tst.IsQualified() {
+		t.Errorf("expected a qualified time-stamp")
+	}
+	statements, err := tst.GetQCStatements()
+	if err != nil || len(statements) != 1 || !statements[0].StatementId.Equal(rfc3161.OidQTSTStatement1) {
+		t.Errorf("got %+v, %v", statements, err)
+	}
+
+	// A critical QCStatements extension is only accepted after RegisterQCStatements
+	qualified.Critical = true
+	tsa.Extensions = []pkix.Extension{qualified}
+	tsrsp = tsa.Respond(tsreq)
+	if err := tsrsp.Verify(tsreq, nil); !errors.Is(err, rfc3161.ErrUnsupportedExt) {
+		t.Errorf("expected ErrUnsupportedExt, got %v", err)
+	}
+	rfc3161.RegisterQCStatements()
+	if err := tsrsp.Verify(tsreq, nil); err != nil {
+		t.Errorf("registered critical QCStatements: %+v", err)
+	}
+	tst, err = tsrsp.GetTSTInfo()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if value, err := tst.GetExtension(rfc3161.OidExtQCStatements); err != nil || len(value.([]rfc3161.QCStatement)) != 1 {
+		t.Errorf("registered decoder: got %v, %v", value, err)
+	}
+
+	tsa.Extensions = nil
+	tsrsp = tsa.Respond(tsreq)
+	tst, err = tsrsp.GetTSTInfo()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if tst.IsQualified() {
+		t.Errorf("expected a non-qualified time-stamp")
+	}
+}
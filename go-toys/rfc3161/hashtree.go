@@ -0,0 +1,137 @@
+package rfc3161
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"sort"
+)
+
+// Errors
+var (
+	ErrEmptyHashTree       = errors.New("rfc3161: hashtree: No leaves given")
+	ErrInvalidLeafSize     = errors.New("rfc3161: hashtree: Invalid leaf size for the given hash algorithm")
+	ErrLeafNotInHashtree   = errors.New("rfc3161: hashtree: Hash value is not in the first partial hashtree")
+	ErrLeafIndexOutOfRange = errors.New("rfc3161: hashtree: Leaf index out of range")
+)
+
+// PartialHashtree is one level of a reduced hash tree as defined by RFC 4998 4.1.
+// It holds the hash values that have the same parent node.
+type PartialHashtree [][]byte
+
+// HashTree is a Merkle hash tree over hash values as defined by RFC 4998 4.2.
+//
+// Nodes are grouped in pairs. The parent of a group is the hash of its members
+// concatenated in binary ascending order, so a reduced hash tree doesn't need
+// to record the position of a node. The parent of a node without a pair is the
+// hash of that node alone. The root of a tree with a single leaf is the leaf.
+type HashTree struct {
+	Hash   crypto.Hash
+	levels [][][]byte // levels[0] are the leaves, the last level is the root
+}
+
+// NewHashTree builds the hash tree over the leaves, which must be hash values of the given algorithm
+func NewHashTree(hash crypto.Hash, leaves [][]byte) (*HashTree, error) {
+	if !hash.Available() {
+		return nil, ErrUnsupportedHash
+	}
+	if len(leaves) == 0 {
+		return nil, ErrEmptyHashTree
+	}
+	level := make([][]byte, len(leaves))
+	for i, leaf := range leaves {
+		if len(leaf) != hash.Size() {
+			return nil, ErrInvalidLeafSize
+		}
+		level[i] = append([]byte(nil), leaf...)
+	}
+
+	tree := &HashTree{Hash: hash, levels: [][][]byte{level}}
+	for len(level) > 1 {
+		parents := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			end := i + 2
+			if end > len(level) {
+				end = len(level)
+			}
+			parents = append(parents, hashNodes(hash, level[i:end]))
+		}
+		tree.levels = append(tree.levels, parents)
+		level = parents
+	}
+	return tree, nil
+}
+
+// Len gets the number of leaves
+func (tree *HashTree) Len() int {
+	return len(tree.levels[0])
+}
+
+// Root gets the root hash value, which is the value to be time-stamped
+func (tree *HashTree) Root() []byte {
+	return tree.levels[len(tree.levels)-1][0]
+}
+
+// ReducedHashtree gets the reduced hash tree of the i-th leaf as defined by RFC 4998 4.2.
+// The first PartialHashtree contains the leaf and its sibling, the following ones the
+// siblings on the path to the root. It is empty for a tree with a single leaf.
+func (tree *HashTree) ReducedHashtree(i int) ([]PartialHashtree, error) {
+	if i < 0 || i >= tree.Len() {
+		return nil, ErrLeafIndexOutOfRange
+	}
+	var reduced []PartialHashtree
+	for depth := 0; depth < len(tree.levels)-1; depth++ {
+		level := tree.levels[depth]
+		var partial PartialHashtree
+		if depth == 0 {
+			partial = append(partial, level[i])
+		}
+		if sibling := i ^ 1; sibling < len(level) {
+			partial = append(partial, level[sibling])
+		}
+		reduced = append(reduced, partial)
+		i /= 2
+	}
+	return reduced, nil
+}
+
+// ComputeRoot calculates the root hash value from a leaf and its reduced hash tree
+// as described in RFC 4998 4.3. The leaf must be in the first PartialHashtree.
+// Without a reduced hash tree the root is the leaf itself.
+func ComputeRoot(hash crypto.Hash, leaf []byte, reduced []PartialHashtree) ([]byte, error) {
+	if !hash.Available() {
+		return nil, ErrUnsupportedHash
+	}
+	node := leaf
+	for depth, partial := range reduced {
+		group := make([][]byte, 0, len(partial)+1)
+		if depth == 0 {
+			found := false
+			for _, value := range partial {
+				found = found || bytes.Equal(value, leaf)
+			}
+			if !found {
+				return nil, ErrLeafNotInHashtree
+			}
+		} else {
+			group = append(group, node)
+		}
+		group = append(group, partial...)
+		node = hashNodes(hash, group)
+	}
+	return node, nil
+}
+
+// hashNodes hashes the nodes concatenated in binary ascending order
+func hashNodes(hash crypto.Hash, nodes [][]byte) []byte {
+	sorted := make([][]byte, len(nodes))
+	copy(sorted, nodes)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i], sorted[j]) < 0
+	})
+	h := hash.New()
+	for _, node := range sorted {
+		h.Write(node)
+	}
+	return h.Sum(nil)
+}
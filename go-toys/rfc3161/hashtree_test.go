@@ -0,0 +1,68 @@
+package rfc3161_test
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/bukodi/playground/rfc3161"
+)
+
+func TestHashTree(t *testing.T) {
+	for n := 1; n <= 9; n++ {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			var leaves [][]byte
+			for i := 0; i < n; i++ {
+				leaf := sha256.Sum256([]byte(fmt.Sprint("document ", i)))
+				leaves = append(leaves, leaf[:])
+			}
+			tree, err := rfc3161.NewHashTree(crypto.SHA256, leaves)
+			if err != nil {
+				t.Fatalf("%+v", err)
+			}
+			if n == 1 && !bytes.Equal(tree.Root(), leaves[0]) {
+				t.Errorf("the root of a single leaf tree should be the leaf")
+			}
+
+			for i, leaf := range leaves {
+				reduced, err := tree.ReducedHashtree(i)
+				if err != nil {
+					t.Fatalf("%+v", err)
+				}
+				root, err := rfc3161.ComputeRoot(crypto.SHA256, leaf, reduced)
+				if err != nil {
+					t.Fatalf("leaf %d: %+v", i, err)
+				}
+				if !bytes.Equal(root, tree.Root()) {
+					t.Errorf("leaf %d: root mismatch", i)
+				}
+				if n > 1 {
+					other := sha256.Sum256([]byte("not a document"))
+					if _, err := rfc3161.ComputeRoot(crypto.SHA256, other[:], reduced); !errors.Is(err, rfc3161.ErrLeafNotInHashtree) {
+						t.Errorf("leaf %d: expected ErrLeafNotInHashtree, got %v", i, err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestHashTreeErrors(t *testing.T) {
+	if _, err := rfc3161.NewHashTree(crypto.SHA256, nil); !errors.Is(err, rfc3161.ErrEmptyHashTree) {
+		t.Errorf("expected ErrEmptyHashTree, got %v", err)
+	}
+	if _, err := rfc3161.NewHashTree(crypto.SHA256, [][]byte{{1, 2, 3}}); !errors.Is(err, rfc3161.ErrInvalidLeafSize) {
+		t.Errorf("expected ErrInvalidLeafSize, got %v", err)
+	}
+	leaf := sha256.Sum256([]byte("document"))
+	tree, err := rfc3161.NewHashTree(crypto.SHA256, [][]byte{leaf[:]})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if _, err := tree.ReducedHashtree(1); !errors.Is(err, rfc3161.ErrLeafIndexOutOfRange) {
+		t.Errorf("expected ErrLeafIndexOutOfRange, got %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+package rfc3161
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+
+	"github.com/bukodi/playground/tpqc"
+	"github.com/cloudflare/circl/sign"
+	"github.com/cloudflare/circl/sign/schemes"
+)
+
+// Errors
+var (
+	ErrMLDSADigestTooWeak = errors.New("rfc3161: ML-DSA: Digest algorithm is weaker than the ML-DSA parameter set")
+)
+
+// mldsaParams pairs an ML-DSA parameter set with the weakest digest algorithm
+// that may be used for the CMS message digest. The digest must offer at least
+// the collision resistance of the parameter set (RFC 9882 3.3).
+type mldsaParams struct {
+	alg     tpqc.ML_DSA_Alg
+	minHash crypto.Hash
+}
+
+var mldsaParamSets = []mldsaParams{
+	{tpqc.ML_DSA_44, crypto.SHA256},
+	{tpqc.ML_DSA_65, crypto.SHA384},
+	{tpqc.ML_DSA_87, crypto.SHA512},
+}
+
+// DefaultMLDSAHash is the digest algorithm a TSA with an ML-DSA key uses by default.
+// SHA-512 must be supported by every CMS ML-DSA implementation and suits all parameter sets.
+const DefaultMLDSAHash = crypto.SHA512
+
+// allows reports whether hash is strong enough for the parameter set
+func (p *mldsaParams) allows(hash crypto.Hash) bool {
+	return hash.Available() && hash.Size() >= p.minHash.Size()
+}
+
+// mldsaParamsByName gets the parameter set of a circl ML-DSA scheme
+func mldsaParamsByName(name string) (*mldsaParams, bool) {
+	for i := range mldsaParamSets {
+		if mldsaParamSets[i].alg.Name == name {
+			return &mldsaParamSets[i], true
+		}
+	}
+	return nil, false
+}
+
+// mldsaParamsByOID gets the parameter set of an ML-DSA algorithm identifier
+func mldsaParamsByOID(oid asn1.ObjectIdentifier) (*mldsaParams, bool) {
+	for i := range mldsaParamSets {
+		if mldsaParamSets[i].alg.Oid.Equal(oid) {
+			return &mldsaParamSets[i], true
+		}
+	}
+	return nil, false
+}
+
+// mldsaPublicKey gets the parameter set of a circl ML-DSA public key.
+// ok is false if pub is not an ML-DSA key.
+func mldsaPublicKey(pub crypto.PublicKey) (sign.PublicKey, *mldsaParams, bool) {
+	pk, ok := pub.(sign.PublicKey)
+	if !ok {
+		return nil, nil, false
+	}
+	params, ok := mldsaParamsByName(pk.Scheme().Name())
+	if !ok {
+		return nil, nil, false
+	}
+	return pk, params, true
+}
+
+// mldsaPublicKeyFromCert decodes the ML-DSA public key of the certificate.
+// ok is false if the certificate doesn't have an ML-DSA key.
+//
+// The key is read from the raw SubjectPublicKeyInfo, since crypto/x509 doesn't
+// know ML-DSA in every supported Go version.
+func mldsaPublicKeyFromCert(cert *x509.Certificate) (pk sign.PublicKey, params *mldsaParams, ok bool, err error) {
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(cert.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return nil, nil, false, err
+	}
+	params, ok = mldsaParamsByOID(spki.Algorithm.Algorithm)
+	if !ok {
+		return nil, nil, false, nil
+	}
+	pk, err = schemes.ByName(params.alg.Name).UnmarshalBinaryPublicKey(spki.PublicKey.RightAlign())
+	if err != nil {
+		return nil, nil, true, err
+	}
+	return pk, params, true, nil
+}
+
+// mldsaCertMatches reports whether the certificate holds the ML-DSA public key
+func mldsaCertMatches(cert *x509.Certificate, pub sign.PublicKey) bool {
+	certPub, _, ok, err := mldsaPublicKeyFromCert(cert)
+	if !ok || err != nil {
+		return false
+	}
+	a, err := certPub.MarshalBinary()
+	if err != nil {
+		return false
+	}
+	b, err := pub.MarshalBinary()
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(a, b)
+}
+
+// verifyMLDSA verifies a pure ML-DSA signature with an empty context over
+// the DER encoded signed attributes, as used by CMS (RFC 9882 3.3).
+func verifyMLDSA(pk sign.PublicKey, params *mldsaParams, hash crypto.Hash, signedAttrs []byte, signature []byte) error {
+	if !params.allows(hash) {
+		return ErrMLDSADigestTooWeak
+	}
+	if !pk.Scheme().Verify(pk, signedAttrs, signature, nil) {
+		return ErrVerificationError
+	}
+	return nil
+}
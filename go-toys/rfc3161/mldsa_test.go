@@ -0,0 +1,170 @@
+package rfc3161_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"testing"
+
+	"github.com/bukodi/playground/rfc3161"
+	"github.com/bukodi/playground/tpqc"
+	"github.com/cloudflare/circl/sign/mldsa/mldsa44"
+	"github.com/cloudflare/circl/sign/mldsa/mldsa65"
+	"github.com/cloudflare/circl/sign/mldsa/mldsa87"
+)
+
+// newMLDSATestPKI issues a TSA certificate for an ML-DSA key under an ECDSA root.
+// x509.CreateCertificate can't encode circl keys, so the certificate is issued for
+// a placeholder key, then its SubjectPublicKeyInfo is replaced and the TBSCertificate re-signed.
+func newMLDSATestPKI(t *testing.T, pub crypto.PublicKey, alg tpqc.ML_DSA_Alg) (root *x509.Certificate, tsaCert *x509.Certificate) {
+	t.Helper()
+
+	placeholder, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	root, rootKey, tsaCert := newTestPKI(t, placeholder)
+
+	var cert struct {
+		TBS                asn1.RawValue
+		SignatureAlgorithm asn1.RawValue
+		Signature          asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(tsaCert.Raw, &cert); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	var tbs struct {
+		Version            asn1.RawValue
+		SerialNumber       asn1.RawValue
+		SignatureAlgorithm asn1.RawValue
+		Issuer             asn1.RawValue
+		Validity           asn1.RawValue
+		Subject            asn1.RawValue
+		PublicKey          asn1.RawValue
+		Extensions         asn1.RawValue
+	}
+	if _, err := asn1.Unmarshal(cert.TBS.FullBytes, &tbs); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	pubBytes, err := pub.(interface{ MarshalBinary() ([]byte, error) }).MarshalBinary()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	spki, err := asn1.Marshal(struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}{pkix.AlgorithmIdentifier{Algorithm: alg.Oid}, asn1.BitString{Bytes: pubBytes, BitLength: 8 * len(pubBytes)}})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	tbs.PublicKey = asn1.RawValue{FullBytes: spki}
+
+	tbsDER, err := asn1.Marshal(tbs)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	digest := sha256.Sum256(tbsDER)
+	signature, err := rootKey.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	cert.TBS = asn1.RawValue{FullBytes: tbsDER}
+	cert.Signature = asn1.BitString{Bytes: signature, BitLength: 8 * len(signature)}
+	certDER, err := asn1.Marshal(cert)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	tsaCert, err = x509.ParseCertificate(certDER)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	return root, tsaCert
+}
+
+func TestMLDSATimeStampToken(t *testing.T) {
+	_, key44, err := mldsa44.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	_, key65, err := mldsa65.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	_, key87, err := mldsa87.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	for _, tc := range []struct {
+		alg tpqc.ML_DSA_Alg
+		key crypto.Signer
+	}{
+		{tpqc.ML_DSA_44, key44},
+		{tpqc.ML_DSA_65, key65},
+		{tpqc.ML_DSA_87, key87},
+	} {
+		t.Run(tc.alg.Name, func(t *testing.T) {
+			root, tsaCert := newMLDSATestPKI(t, tc.key.Public(), tc.alg)
+			rfc3161.RootCerts = x509.NewCertPool()
+			rfc3161.RootCerts.AddCert(root)
+
+			tsa, err := rfc3161.NewTSA(tsaCert, tc.key, testPolicy)
+			if err != nil {
+				t.Fatalf("%+v", err)
+			}
+			if tsa.Hash != rfc3161.DefaultMLDSAHash {
+				t.Errorf("hash: got %v", tsa.Hash)
+			}
+
+			tsreq := newTestReq(t)
+			tsrsp := tsa.Respond(tsreq)
+			if tsrsp.Status.Status != rfc3161.StatusGranted {
+				t.Fatalf("status: %+v", tsrsp.Status)
+			}
+			if alg := tsrsp.TimeStampToken.SignerInfos[0].SignatureAlgorithm; !alg.Algorithm.Equal(tc.alg.Oid) || len(alg.Parameters.FullBytes) != 0 {
+				t.Errorf("signature algorithm: got %v", alg)
+			}
+			if err := tsrsp.Verify(tsreq, nil); err != nil {
+				t.Fatalf("%+v", err)
+			}
+
+			tsrsp.TimeStampToken.SignerInfos[0].Signature[0] ^= 0xff
+			if err := tsrsp.Verify(tsreq, nil); !errors.Is(err, rfc3161.ErrVerificationError) {
+				t.Errorf("expected ErrVerificationError, got %v", err)
+			}
+		})
+	}
+}
+
+func TestMLDSADigestStrength(t *testing.T) {
+	_, key, err := mldsa87.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	_, tsaCert := newMLDSATestPKI(t, key.Public(), tpqc.ML_DSA_87)
+
+	tsa, err := rfc3161.NewTSA(tsaCert, key, testPolicy)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	tsa.Hash = crypto.SHA256
+	tsrsp := tsa.Respond(newTestReq(t))
+	if tsrsp.Status.Status != rfc3161.StatusRejection || tsrsp.Status.FailInfo != rfc3161.FailureSystemFailure {
+		t.Errorf("expected systemFailure rejection, got %+v", tsrsp.Status)
+	}
+
+	_, other, err := mldsa87.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if _, err := rfc3161.NewTSA(tsaCert, other, testPolicy); !errors.Is(err, rfc3161.ErrTSAKeyMismatch) {
+		t.Errorf("expected ErrTSAKeyMismatch, got %v", err)
+	}
+}
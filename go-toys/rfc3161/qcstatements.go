@@ -0,0 +1,92 @@
+package rfc3161
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+)
+
+// OID Identifiers
+var (
+	// RFC-3739: id-pe-qcStatements: iso(1) identified-organization(3) dod(6) internet(1) security(5) mechanisms(5) pkix(7) pe(1) 3
+	OidExtQCStatements = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 3}
+
+	// ETSI EN 319 422 9.1: esi4-qtstStatement-1: itu-t(0) identified-organization(4) etsi(0) id-qtst-statements(19422) 1 1
+	OidQTSTStatement1 = asn1.ObjectIdentifier{0, 4, 0, 19422, 1, 1}
+)
+
+// QCStatement is a single statement of the QCStatements extension as defined by RFC 3739 3.2.6
+type QCStatement struct {
+	StatementId   asn1.ObjectIdentifier
+	StatementInfo asn1.RawValue `asn1:"optional"`
+}
+
+// RegisterQCStatements registers the codecs of the QCStatements extension, for
+// DecodeExtension, NewExtension and the SetExtension methods. Like any registered
+// extension, it is then also accepted as critical when a token or request is verified.
+// NewQualifiedTimeStampExtension, GetQCStatements and IsQualified work without it.
+func RegisterQCStatements() {
+	RegisterExtensionType(ExtensionType{Id: OidExtQCStatements, Decode: decodeQCStatements, Encode: encodeQCStatements})
+}
+
+// decodeQCStatements decodes the QCStatements extension into a []QCStatement
+func decodeQCStatements(der []byte) (interface{}, error) {
+	var statements []QCStatement
+	rest, err := asn1.Unmarshal(der, &statements)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, ErrUnrecognizedData
+	}
+	return statements, nil
+}
+
+// encodeQCStatements encodes a []QCStatement as the QCStatements extension
+func encodeQCStatements(value interface{}) ([]byte, error) {
+	statements, ok := value.([]QCStatement)
+	if !ok {
+		return nil, ErrExtensionValueType
+	}
+	return asn1.Marshal(statements)
+}
+
+// NewQualifiedTimeStampExtension creates the non-critical QCStatements extension
+// with the esi4-qtstStatement-1 statement, which a TSA adds to the TSTInfo of
+// qualified electronic time-stamps (ETSI EN 319 422 9.1).
+func NewQualifiedTimeStampExtension() (pkix.Extension, error) {
+	der, err := encodeQCStatements([]QCStatement{{StatementId: OidQTSTStatement1}})
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+	return pkix.Extension{Id: OidExtQCStatements, Critical: false, Value: der}, nil
+}
+
+// GetQCStatements gets the statements of the QCStatements extension.
+// It returns ErrExtensionNotFound if the TSTInfo doesn't have the extension.
+func (tst *TSTInfo) GetQCStatements() ([]QCStatement, error) {
+	for _, ext := range tst.Extensions {
+		if ext.Id.Equal(OidExtQCStatements) {
+			value, err := decodeQCStatements(ext.Value)
+			if err != nil {
+				return nil, err
+			}
+			return value.([]QCStatement), nil
+		}
+	}
+	return nil, ErrExtensionNotFound
+}
+
+// IsQualified reports whether the TSTInfo claims to be a qualified electronic
+// time-stamp, i.e. it has the esi4-qtstStatement-1 QCStatement (ETSI EN 319 422 9.1).
+func (tst *TSTInfo) IsQualified() bool {
+	statements, err := tst.GetQCStatements()
+	if err != nil {
+		return false
+	}
+	for _, statement := range statements {
+		if statement.StatementId.Equal(OidQTSTStatement1) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,7 @@
 package rfc3161
 
 import (
+	"bytes"
 	"crypto"
 	"crypto/rand"
 	"crypto/x509/pkix"
@@ -38,6 +39,11 @@ type MessageImprint struct {
 	HashedMessage []byte
 }
 
+// Equal reports whether the two message imprints have the same hash algorithm and digest
+func (mi *MessageImprint) Equal(other *MessageImprint) bool {
+	return mi.HashAlgorithm.Algorithm.Equal(other.HashAlgorithm.Algorithm) && bytes.Equal(mi.HashedMessage, other.HashedMessage)
+}
+
 // NewTimeStampReq creates a new Time Stamp Request, given a crypto.Hash algorithm and a message digest
 func NewTimeStampReq(hash crypto.Hash, digest []byte) (*TimeStampReq, error) {
 	tsr := new(TimeStampReq)
@@ -113,7 +119,7 @@ func (tsr *TimeStampReq) GenerateNonce() error {
 // Verify does a basic sanity check of the Time Stamp Request
 // Checks to make sure the hash is supported, the digest matches the hash,
 // and no unsupported critical extensions exist. Be sure to add all supported
-// extentions to rfc3161.SupportedExtensions.
+// extentions with rfc3161.RegisterExtension.
 func (tsr *TimeStampReq) Verify() error {
 	hash := tsr.GetHash()
 	if hash == 0 {
@@ -124,25 +130,6 @@ func (tsr *TimeStampReq) Verify() error {
 	}
 
 	// Check for any unsupported critical extensions
-	// Critical Extensions should be registered in rfc3161.SupportedExtensions
-	if tsr.Extensions != nil {
-		for _, ext := range tsr.Extensions {
-			if ext.Critical {
-				supported := false
-				if supportedExtensions != nil {
-					for _, se := range supportedExtensions {
-						if se.Equal(ext.Id) {
-							supported = true
-							break
-						}
-					}
-				}
-				if !supported {
-					return ErrUnsupportedExt
-				}
-			}
-		}
-	}
-
-	return nil
+	// Critical Extensions should be registered with rfc3161.RegisterExtension
+	return checkCriticalExtensions(tsr.Extensions)
 }
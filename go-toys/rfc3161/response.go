@@ -2,6 +2,8 @@ package rfc3161
 
 import (
 	"bytes"
+	"context"
+	"crypto/ecdsa"
 	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
@@ -35,6 +37,7 @@ var (
 	ErrUnableToParseSID            = errors.New("rfc3161: response: Unable to parse SignerInfo.sid")
 	ErrVerificationError           = errors.New("rfc3161: response: Verfication error")
 	ErrInvalidOID                  = errors.New("rfc3161: response: Invalid OID")
+	ErrMismatchedMessageImprint    = errors.New("rfc3161: response: Message imprint does not match the time-stamped data")
 )
 
 // TimeStampResp contains a full Time Stamp Response as defined by RFC 3161
@@ -52,6 +55,11 @@ func ReadTSR(filename string) (*TimeStampResp, error) {
 	if err != nil {
 		return nil, err
 	}
+	return ParseTimeStampResp(der)
+}
+
+// ParseTimeStampResp parses a DER encoded TimeStampResp
+func ParseTimeStampResp(der []byte) (*TimeStampResp, error) {
 	resp := new(TimeStampResp)
 	rest, err := asn1.Unmarshal(der, resp)
 	if err != nil {
@@ -63,14 +71,35 @@ func ReadTSR(filename string) (*TimeStampResp, error) {
 	return resp, nil
 }
 
+// Marshal gets the DER encoding of the Time Stamp Response
+func (resp *TimeStampResp) Marshal() ([]byte, error) {
+	fields := *resp
+	if len(fields.TimeStampToken.Raw) != 0 {
+		// The token is encoded from its Raw bytes, refresh them if it was changed
+		der, err := resp.TimeStampToken.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		fields.TimeStampToken.Raw = der
+	}
+	return asn1.Marshal(fields)
+}
+
 // Verify does a full verification of the Time Stamp Response
 // including cryptographic verification of the signature
 //
-// If req.CertReq was set to true, cert may be set to nil and it will be loaded
-// from the response automatically
+// cert may be set to nil if the response contains the TSA certificate,
+// which is the case when req.CertReq was set to true
 //
-// WARNING: Does not do any revocation checking
+// WARNING: Does not do any revocation checking. Use VerifyWithRevocation for that.
 func (resp *TimeStampResp) Verify(req *TimeStampReq, cert *x509.Certificate) error {
+	return resp.VerifyWithRevocation(context.Background(), req, cert, nil)
+}
+
+// VerifyWithRevocation does the same verification as Verify, and then checks
+// the revocation status of the TSA certificate and its chain according to policy.
+// A nil policy skips revocation checking.
+func (resp *TimeStampResp) VerifyWithRevocation(ctx context.Context, req *TimeStampReq, cert *x509.Certificate, policy *RevocationPolicy) error {
 	tst, err := resp.GetTSTInfo()
 	if err != nil {
 		return err
@@ -96,56 +125,12 @@ func (resp *TimeStampResp) Verify(req *TimeStampReq, cert *x509.Certificate) err
 		return ErrIncorrectNonce
 	}
 
-	// Verify that the OIDs are correct
-	if !resp.ContentType.Equal(OidSignedData) || !resp.EContentType.Equal(OidContentTypeTSTInfo) {
-		return ErrInvalidOID
-	}
-
-	// Get the certificate
-	respcert, err := resp.GetSigningCert()
-	if err != nil {
-		return err
-	}
-	// Rationalize the passed-in certificate vis-a-vis certificate in the response
-	if req.CertReq {
-		if respcert != nil && cert != nil {
-			if !bytes.Equal(cert.Raw, respcert.Raw) {
-				return ErrMismatchedCertificates
-			}
-		} else if cert == nil {
-			cert = respcert
-		}
-	}
-	if cert == nil {
-		return ErrNoCertificate
-	}
-
-	// Get any intermediates that might be needed
-	intermediates, err := resp.GetCertificates()
-	if err != nil && err != ErrNoCertificate {
-		return err
-	}
-	interpool := x509.NewCertPool()
-	for _, intercert := range intermediates {
-		interpool.AddCert(intercert)
-	}
-
-	// Verify the certificate
-	err = resp.VerifyCertificate(cert, interpool)
-	if err != nil {
-		return err
-	}
-
-	// Verify the signature
-	err = resp.VerifySignature(cert)
-	if err != nil {
-		return err
+	// Verify that the token is for the requested data
+	if !tst.MessageImprint.Equal(&req.MessageImprint) {
+		return ErrMismatchedMessageImprint
 	}
 
-	// TODO: Review RFC3161 for other checks that are needed
-
-	// All checks pass
-	return nil
+	return resp.TimeStampToken.verify(ctx, tst, cert, policy, time.Time{})
 }
 
 // VerifyCertificate verifies that the certificate was set up correctly for key signing,
@@ -153,25 +138,32 @@ func (resp *TimeStampResp) Verify(req *TimeStampReq, cert *x509.Certificate) err
 //
 // intermediates is any intermediate certificates needed to verify the cert. Can be nil.
 //
-// WARNING: Does not do any revocation checking
+// WARNING: Does not do any revocation checking. See RevocationPolicy.
 func (resp *TimeStampResp) VerifyCertificate(cert *x509.Certificate, intermediates *x509.CertPool) error {
+	_, err := verifyCertificate(cert, intermediates, time.Time{})
+	return err
+}
+
+// verifyCertificate does the checks of VerifyCertificate and returns the verified chains.
+// The chain is validated at the given time, or now if it is zero.
+func verifyCertificate(cert *x509.Certificate, intermediates *x509.CertPool, at time.Time) ([][]*x509.Certificate, error) {
 	if cert == nil {
-		return ErrNoCertificate
+		return nil, ErrNoCertificate
 	}
 
 	// Key usage must contain the KeyUsageDigitalSignature bit
 	// and MAY contain the non-repudiation / content-commitment bit
 	if cert.KeyUsage != x509.KeyUsageDigitalSignature && cert.KeyUsage != (x509.KeyUsageDigitalSignature+x509.KeyUsageContentCommitment) {
-		return ErrCertificateKeyUsage
+		return nil, ErrCertificateKeyUsage
 	}
 
 	// Next check the extended key usage
 	// Only one ExtKeyUsage may be defined as per RFC 3161
 	if len(cert.ExtKeyUsage) != 1 {
-		return ErrCertificateExtKeyUsageUsage
+		return nil, ErrCertificateExtKeyUsageUsage
 	}
 	if cert.ExtKeyUsage[0] != x509.ExtKeyUsageTimeStamping {
-		return ErrCertificateExtKeyUsageUsage
+		return nil, ErrCertificateExtKeyUsageUsage
 	}
 
 	// Check to make sure it has the correct extension
@@ -180,18 +172,18 @@ func (resp *TimeStampResp) VerifyCertificate(cert *x509.Certificate, intermediat
 	for _, ext := range cert.Extensions {
 		if ext.Id.Equal(OidExtKeyUsage) {
 			if !ext.Critical {
-				return ErrCertificateExtKeyUsageUsage
+				return nil, ErrCertificateExtKeyUsageUsage
 			}
 			var rfc3161Ext []asn1.ObjectIdentifier
 			_, err := asn1.Unmarshal(ext.Value, &rfc3161Ext)
 			if err != nil {
-				return err
+				return nil, err
 			}
 			if len(rfc3161Ext) != 1 {
-				return ErrCertificateExtKeyUsageUsage
+				return nil, ErrCertificateExtKeyUsageUsage
 			}
 			if !rfc3161Ext[0].Equal(OidExtKeyUsageTimeStamping) {
-				return ErrCertificateExtKeyUsageUsage
+				return nil, ErrCertificateExtKeyUsageUsage
 			}
 		}
 	}
@@ -201,18 +193,23 @@ func (resp *TimeStampResp) VerifyCertificate(cert *x509.Certificate, intermediat
 		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
 		Roots:         RootCerts,
 		Intermediates: intermediates,
+		CurrentTime:   at,
 	}
-	_, err := cert.Verify(opts)
+	chains, err := cert.Verify(opts)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return chains, nil
 }
 
 // TimeStampToken is a wrapper than contains the OID for a TimeStampToken
 // as well as the wrapped SignedData
+//
+// It is a CMS ContentInfo, so it can be embedded on its own in other
+// structures, e.g. in CMS unsigned attributes or PDF signatures. See token.go.
 type TimeStampToken struct {
+	Raw         asn1.RawContent       // DER the token was parsed from. Marshal reproduces it unchanged.
 	ContentType asn1.ObjectIdentifier // MUST BE OidSignedData
 	SignedData  `asn1:"tag:0,explicit,optional"`
 }
@@ -280,27 +277,45 @@ func (sd *SignedData) VerifySignature(cert *x509.Certificate) error {
 	}
 
 	// Marshal the Signed Attributes
-	derbytes, err := asn1.Marshal(signer.SignedAttrs)
+	derbytes, err := marshalSignedAttrs(signer.SignedAttrs)
 	if err != nil {
 		return err
 	}
 
-	// Hack the DER bytes of the Signed Attributes to be EXPLICIT SET
-	derbytes[0] = 0x31
-	derbytes[1] = 0x81
+	// ML-DSA signs the DER bytes themselves
+	mldsaPub, mldsaParams, isMLDSA, err := mldsaPublicKeyFromCert(cert)
+	if err != nil {
+		return ErrVerificationError
+	}
 
 	// Hash the DER bytes
 	hash := hashAlgo.Hash.New()
 	hash.Write(derbytes)
 	digest := hash.Sum(nil)
 
-	// Unpack the public key
-	pub := cert.PublicKey.(*rsa.PublicKey)
-
 	// Verify the signature
-	err = rsa.VerifyPKCS1v15(pub, hashAlgo.Hash, digest, signer.Signature)
-	if err != nil {
-		return ErrVerificationError
+	if isMLDSA {
+		if !signer.SignatureAlgorithm.Algorithm.Equal(mldsaParams.alg.Oid) {
+			return ErrVerificationError
+		}
+		err = verifyMLDSA(mldsaPub, mldsaParams, hashAlgo.Hash, derbytes, signer.Signature)
+		if err != nil {
+			return err
+		}
+	} else {
+		switch pub := cert.PublicKey.(type) {
+		case *rsa.PublicKey:
+			err = rsa.VerifyPKCS1v15(pub, hashAlgo.Hash, digest, signer.Signature)
+			if err != nil {
+				return ErrVerificationError
+			}
+		case *ecdsa.PublicKey:
+			if !ecdsa.VerifyASN1(pub, digest, signer.Signature) {
+				return ErrVerificationError
+			}
+		default:
+			return ErrVerificationError
+		}
 	}
 
 	// Verify the signed attributes
@@ -332,10 +347,28 @@ func (sd *SignedData) VerifySignature(cert *x509.Certificate) error {
 		return ErrVerificationError
 	}
 
+	// Verify that the signed attributes bind the certificate to the signature
+	err = signer.VerifySigningCertificate(cert)
+	if err != nil {
+		return err
+	}
+
 	// Everything is OK
 	return nil
 }
 
+// marshalSignedAttrs gets the DER encoding of the Signed Attributes that is covered by the signature.
+// The attributes are IMPLICIT [0] tagged within the SignerInfo, but the signature
+// is calculated over the EXPLICIT SET OF encoding (RFC 5652 5.4).
+func marshalSignedAttrs(attrs []Attribute) ([]byte, error) {
+	derbytes, err := asn1.Marshal(attrs)
+	if err != nil {
+		return nil, err
+	}
+	derbytes[0] = 0x31
+	return derbytes, nil
+}
+
 // GetCertificates gets a list of x509.Certificate objects from the DER encoded Certificates field
 func (sd *SignedData) GetCertificates() ([]*x509.Certificate, error) {
 	if len(sd.Certificates.Bytes) == 0 {
@@ -344,6 +377,24 @@ func (sd *SignedData) GetCertificates() ([]*x509.Certificate, error) {
 	return x509.ParseCertificates(sd.Certificates.Bytes)
 }
 
+// GetCRLs gets the CRLs embedded in the SignedData.
+// CRLs that can't be parsed are skipped.
+func (sd *SignedData) GetCRLs() []*x509.RevocationList {
+	var crls []*x509.RevocationList
+	for _, cl := range sd.CRLs {
+		der, err := asn1.Marshal(cl)
+		if err != nil {
+			continue
+		}
+		crl, err := x509.ParseRevocationList(der)
+		if err != nil {
+			continue
+		}
+		crls = append(crls, crl)
+	}
+	return crls
+}
+
 // SignerInfo is a shared-standard as defined by RFC 2630
 type SignerInfo struct {
 	Version            int           `asn1:"default:1"`
@@ -446,7 +497,7 @@ type TSTInfo struct {
 	Policy         asn1.ObjectIdentifier `json:"policy"`                           // Identifier for the policy. For many TSA's, often the same as SignedData.DigestAlgorithm
 	MessageImprint MessageImprint        `json:"message-imprint"`                  // MUST have the same value of MessageImprint in matching TimeStampReq
 	SerialNumber   *big.Int              `json:"serial-number"`                    // Time-Stamping users MUST be ready to accommodate integers up to 160 bits
-	GenTime        time.Time             `json:"gen-time"`                         // The time at which it was stamped
+	GenTime        time.Time             `json:"gen-time" asn1:"generalized"`      // The time at which it was stamped
 	Accuracy       Accuracy              `json:"accuracy" asn1:"optional"`         // Accuracy represents the time deviation around the UTC time.
 	Ordering       bool                  `json:"ordering" asn1:"optional"`         // True if SerialNumber increases monotonically with time.
 	Nonce          *big.Int              `json:"nonce" asn1:"optional"`            // MUST be present if the similar field was present in TimeStampReq.  In that case it MUST have the same value.
@@ -0,0 +1,318 @@
+package rfc3161
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// Errors
+var (
+	ErrCertificateRevoked         = errors.New("rfc3161: revocation: Certificate has been revoked")
+	ErrRevocationUnknown          = errors.New("rfc3161: revocation: Unable to determine revocation status")
+	ErrRevocationFetch            = errors.New("rfc3161: revocation: Unable to fetch revocation information")
+	ErrRevocationResponseTooLarge = errors.New("rfc3161: revocation: CRL or OCSP response exceeds the maximum allowed size")
+)
+
+// RevocationFetchError is returned by HTTPRevocationFetcher when a CRL or OCSP
+// responder answers with an HTTP status other than 200 OK.
+// It matches ErrRevocationFetch with errors.Is.
+type RevocationFetchError struct {
+	URL        string
+	StatusCode int
+	Status     string
+}
+
+func (e *RevocationFetchError) Error() string {
+	return "rfc3161: revocation: Unexpected HTTP status from " + e.URL + ": " + e.Status
+}
+
+// Is reports whether target is ErrRevocationFetch
+func (e *RevocationFetchError) Is(target error) bool {
+	return target == ErrRevocationFetch
+}
+
+// RevocationError is returned when a certificate of the TSA chain is revoked.
+// It matches ErrCertificateRevoked with errors.Is.
+type RevocationError struct {
+	Certificate *x509.Certificate
+	RevokedAt   time.Time
+	Reason      int // CRL reason code as defined by RFC 5280 5.3.1. See the constants of golang.org/x/crypto/ocsp.
+}
+
+func (e *RevocationError) Error() string {
+	return fmt.Sprintf("rfc3161: revocation: Certificate %q has been revoked at %s (reason %d)",
+		e.Certificate.Subject.String(), e.RevokedAt.Format(time.RFC3339), e.Reason)
+}
+
+// Is reports whether target is ErrCertificateRevoked
+func (e *RevocationError) Is(target error) bool {
+	return target == ErrCertificateRevoked
+}
+
+// RevocationFetcher retrieves revocation information from the locations
+// named in the certificates (CRL distribution points and OCSP responders).
+// Implementations may serve the data from a cache or a local stand-in.
+type RevocationFetcher interface {
+	// FetchCRL gets the DER encoded CRL published at url
+	FetchCRL(ctx context.Context, url string) ([]byte, error)
+	// FetchOCSP sends the DER encoded OCSP request to the responder at url and gets back the DER encoded response
+	FetchOCSP(ctx context.Context, url string, req []byte) ([]byte, error)
+}
+
+// HTTPRevocationFetcher is a RevocationFetcher that fetches CRLs with HTTP GET
+// and queries OCSP responders with HTTP POST (RFC 6960 Appendix A).
+type HTTPRevocationFetcher struct {
+	HTTPClient      *http.Client
+	MaxResponseSize int64 // Maximum accepted size of a CRL or OCSP response. Defaults to DefaultMaxRevocationResponseSize.
+}
+
+// DefaultMaxRevocationResponseSize is the maximum size of a fetched CRL or OCSP response
+// when HTTPRevocationFetcher.MaxResponseSize is not set.
+const DefaultMaxRevocationResponseSize = 10 * 1024 * 1024
+
+// NewHTTPRevocationFetcher creates a new rfc3161.HTTPRevocationFetcher using http.DefaultClient
+func NewHTTPRevocationFetcher() *HTTPRevocationFetcher {
+	fetcher := new(HTTPRevocationFetcher)
+	fetcher.HTTPClient = http.DefaultClient
+	fetcher.MaxResponseSize = DefaultMaxRevocationResponseSize
+	return fetcher
+}
+
+// FetchCRL implements RevocationFetcher
+func (f *HTTPRevocationFetcher) FetchCRL(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return f.do(req)
+}
+
+// FetchOCSP implements RevocationFetcher
+func (f *HTTPRevocationFetcher) FetchOCSP(ctx context.Context, url string, ocspReq []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(ocspReq))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/ocsp-request")
+	return f.do(req)
+}
+
+func (f *HTTPRevocationFetcher) do(req *http.Request) ([]byte, error) {
+	httpClient := f.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &RevocationFetchError{URL: req.URL.String(), StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	maxSize := f.MaxResponseSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxRevocationResponseSize
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > maxSize {
+		return nil, ErrRevocationResponseTooLarge
+	}
+	return body, nil
+}
+
+// RevocationPolicy controls the revocation checking of the TSA certificate chain.
+// The zero value only uses the CRLs embedded in the response.
+//
+// Every certificate of the chain except the trust anchor is checked. OCSP is asked
+// first, then the embedded and supplied CRLs, then the CRLs fetched from the
+// distribution points of the certificate.
+//
+// A token stays valid if its certificate was revoked after the time-stamp was
+// generated, unless the reason is a key compromise (RFC 3161 4, item 2).
+type RevocationPolicy struct {
+	Fetcher     RevocationFetcher      // Used to query OCSP responders and download CRLs. If nil, nothing is fetched.
+	CRLs        []*x509.RevocationList // Additional trusted CRLs, e.g. from a local cache
+	DisableOCSP bool                   // Set to skip OCSP
+	DisableCRL  bool                   // Set to skip fetching CRLs. Embedded and supplied CRLs are still used.
+	SoftFail    bool                   // Set to accept certificates whose revocation status can't be determined
+	Now         func() time.Time       // Time used to check the freshness of CRLs and OCSP responses. Defaults to time.Now.
+}
+
+// NewRevocationPolicy creates a RevocationPolicy that fetches revocation information over HTTP
+// and fails when the status of a certificate can't be determined.
+func NewRevocationPolicy() *RevocationPolicy {
+	policy := new(RevocationPolicy)
+	policy.Fetcher = NewHTTPRevocationFetcher()
+	return policy
+}
+
+// revocationStatus is the outcome of a single revocation source
+type revocationStatus struct {
+	known     bool
+	revoked   bool
+	revokedAt time.Time
+	reason    int
+}
+
+// CheckChains checks the revocation status of the verified chains of the TSA certificate,
+// as returned by x509.Certificate.Verify. Like the chain building, it succeeds if any of the
+// chains passes Check: the chains only differ in the intermediates and trust anchors, and a
+// revoked TSA certificate fails all of them. Otherwise the error of the first chain is returned.
+func (p *RevocationPolicy) CheckChains(ctx context.Context, chains [][]*x509.Certificate, crls []*x509.RevocationList, genTime time.Time) error {
+	var firstErr error
+	for _, chain := range chains {
+		err := p.Check(ctx, chain, crls, genTime)
+		if err == nil {
+			return nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Check checks the revocation status of every certificate in chain, which must be
+// ordered from the TSA certificate to the trust anchor. crls are additional CRLs,
+// usually the ones embedded in the SignedData. genTime is the time of the time-stamp.
+func (p *RevocationPolicy) Check(ctx context.Context, chain []*x509.Certificate, crls []*x509.RevocationList, genTime time.Time) error {
+	crls = append(append([]*x509.RevocationList{}, crls...), p.CRLs...)
+
+	for i := 0; i+1 < len(chain); i++ {
+		cert, issuer := chain[i], chain[i+1]
+
+		status, errs := p.status(ctx, cert, issuer, crls)
+		if !status.known {
+			if p.SoftFail {
+				continue
+			}
+			return errors.Join(append([]error{ErrRevocationUnknown}, errs...)...)
+		}
+		if !status.revoked {
+			continue
+		}
+
+		switch status.reason {
+		case ocsp.KeyCompromise, ocsp.CACompromise, ocsp.AACompromise:
+		default:
+			if status.revokedAt.After(genTime) {
+				continue
+			}
+		}
+		return &RevocationError{Certificate: cert, RevokedAt: status.revokedAt, Reason: status.reason}
+	}
+	return nil
+}
+
+// status gets the revocation status of cert from the first source that knows it
+func (p *RevocationPolicy) status(ctx context.Context, cert, issuer *x509.Certificate, crls []*x509.RevocationList) (revocationStatus, []error) {
+	var errs []error
+
+	if !p.DisableOCSP && p.Fetcher != nil {
+		for _, server := range cert.OCSPServer {
+			status, err := p.checkOCSP(ctx, server, cert, issuer)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if status.known {
+				return status, nil
+			}
+		}
+	}
+
+	for _, crl := range crls {
+		if status := p.checkCRL(crl, cert, issuer); status.known {
+			return status, nil
+		}
+	}
+
+	if !p.DisableCRL && p.Fetcher != nil {
+		for _, dp := range cert.CRLDistributionPoints {
+			der, err := p.Fetcher.FetchCRL(ctx, dp)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			crl, err := x509.ParseRevocationList(der)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if status := p.checkCRL(crl, cert, issuer); status.known {
+				return status, nil
+			}
+		}
+	}
+
+	return revocationStatus{}, errs
+}
+
+// checkOCSP asks the OCSP responder about cert
+func (p *RevocationPolicy) checkOCSP(ctx context.Context, server string, cert, issuer *x509.Certificate) (revocationStatus, error) {
+	req, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return revocationStatus{}, err
+	}
+	der, err := p.Fetcher.FetchOCSP(ctx, server, req)
+	if err != nil {
+		return revocationStatus{}, err
+	}
+	resp, err := ocsp.ParseResponseForCert(der, cert, issuer)
+	if err != nil {
+		return revocationStatus{}, err
+	}
+	if !resp.NextUpdate.IsZero() && p.now().After(resp.NextUpdate) {
+		return revocationStatus{}, nil
+	}
+
+	switch resp.Status {
+	case ocsp.Good:
+		return revocationStatus{known: true}, nil
+	case ocsp.Revoked:
+		return revocationStatus{known: true, revoked: true, revokedAt: resp.RevokedAt, reason: resp.RevocationReason}, nil
+	default:
+		return revocationStatus{}, nil
+	}
+}
+
+// checkCRL looks up cert in the CRL, if the CRL is issued by issuer and is still current
+func (p *RevocationPolicy) checkCRL(crl *x509.RevocationList, cert, issuer *x509.Certificate) revocationStatus {
+	if !bytes.Equal(crl.RawIssuer, issuer.RawSubject) {
+		return revocationStatus{}
+	}
+	if err := crl.CheckSignatureFrom(issuer); err != nil {
+		return revocationStatus{}
+	}
+	if !crl.NextUpdate.IsZero() && p.now().After(crl.NextUpdate) {
+		return revocationStatus{}
+	}
+
+	for _, entry := range crl.RevokedCertificateEntries {
+		if entry.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+			return revocationStatus{known: true, revoked: true, revokedAt: entry.RevocationTime, reason: entry.ReasonCode}
+		}
+	}
+	return revocationStatus{known: true}
+}
+
+func (p *RevocationPolicy) now() time.Time {
+	if p.Now != nil {
+		return p.Now()
+	}
+	return time.Now()
+}
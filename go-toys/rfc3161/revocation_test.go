@@ -0,0 +1,223 @@
+package rfc3161_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bukodi/playground/rfc3161"
+	"golang.org/x/crypto/ocsp"
+)
+
+const (
+	testOCSPURL = "http://ocsp.test.invalid"
+	testCRLURL  = "http://crl.test.invalid/root.crl"
+)
+
+// mapFetcher is a rfc3161.RevocationFetcher serving canned responses
+type mapFetcher struct {
+	crls  map[string][]byte
+	ocsp  map[string][]byte
+	calls int
+}
+
+func (f *mapFetcher) FetchCRL(ctx context.Context, url string) ([]byte, error) {
+	f.calls++
+	if der, ok := f.crls[url]; ok {
+		return der, nil
+	}
+	return nil, errors.New("not found: " + url)
+}
+
+func (f *mapFetcher) FetchOCSP(ctx context.Context, url string, req []byte) ([]byte, error) {
+	f.calls++
+	if der, ok := f.ocsp[url]; ok {
+		return der, nil
+	}
+	return nil, errors.New("not found: " + url)
+}
+
+// revocationFixture holds a local TSA whose certificate points to testOCSPURL and testCRLURL
+type revocationFixture struct {
+	root    *x509.Certificate
+	rootKey crypto.Signer
+	tsaCert *x509.Certificate
+	tsreq   *rfc3161.TimeStampReq
+	tsrsp   *rfc3161.TimeStampResp
+}
+
+func newRevocationFixture(t *testing.T) *revocationFixture {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	root, rootKey, tsaCert := newTestPKI(t, key, func(tmpl *x509.Certificate) {
+		tmpl.OCSPServer = []string{testOCSPURL}
+		tmpl.CRLDistributionPoints = []string{testCRLURL}
+	})
+	rfc3161.RootCerts = x509.NewCertPool()
+	rfc3161.RootCerts.AddCert(root)
+
+	tsa, err := rfc3161.NewTSA(tsaCert, key, testPolicy)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	tsreq := newTestReq(t)
+	return &revocationFixture{root: root, rootKey: rootKey, tsaCert: tsaCert, tsreq: tsreq, tsrsp: tsa.Respond(tsreq)}
+}
+
+func (fx *revocationFixture) crl(t *testing.T, revokedAt time.Time, reason int) []byte {
+	t.Helper()
+	tmpl := &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now().Add(-time.Hour),
+		NextUpdate: time.Now().Add(time.Hour),
+	}
+	if !revokedAt.IsZero() {
+		tmpl.RevokedCertificateEntries = []x509.RevocationListEntry{
+			{SerialNumber: fx.tsaCert.SerialNumber, RevocationTime: revokedAt, ReasonCode: reason},
+		}
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, tmpl, fx.root, fx.rootKey)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	return der
+}
+
+func (fx *revocationFixture) ocsp(t *testing.T, status int, revokedAt time.Time, reason int) []byte {
+	t.Helper()
+	der, err := ocsp.CreateResponse(fx.root, fx.root, ocsp.Response{
+		Status:           status,
+		SerialNumber:     fx.tsaCert.SerialNumber,
+		ThisUpdate:       time.Now().Add(-time.Hour),
+		NextUpdate:       time.Now().Add(time.Hour),
+		RevokedAt:        revokedAt,
+		RevocationReason: reason,
+	}, fx.rootKey)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	return der
+}
+
+func TestRevocationOCSP(t *testing.T) {
+	fx := newRevocationFixture(t)
+
+	fetcher := &mapFetcher{ocsp: map[string][]byte{testOCSPURL: fx.ocsp(t, ocsp.Good, time.Time{}, 0)}}
+	policy := &rfc3161.RevocationPolicy{Fetcher: fetcher}
+	if err := fx.tsrsp.VerifyWithRevocation(context.Background(), fx.tsreq, nil, policy); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	fetcher.ocsp[testOCSPURL] = fx.ocsp(t, ocsp.Revoked, time.Now().Add(-time.Minute), ocsp.Superseded)
+	err := fx.tsrsp.VerifyWithRevocation(context.Background(), fx.tsreq, nil, policy)
+	if !errors.Is(err, rfc3161.ErrCertificateRevoked) {
+		t.Fatalf("expected ErrCertificateRevoked, got %v", err)
+	}
+}
+
+func TestRevocationCRL(t *testing.T) {
+	fx := newRevocationFixture(t)
+
+	// Revoked after the time-stamp was issued for a benign reason: still valid
+	fetcher := &mapFetcher{crls: map[string][]byte{testCRLURL: fx.crl(t, time.Now().Add(time.Minute), ocsp.CessationOfOperation)}}
+	policy := &rfc3161.RevocationPolicy{Fetcher: fetcher, DisableOCSP: true}
+	if err := fx.tsrsp.VerifyWithRevocation(context.Background(), fx.tsreq, nil, policy); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	// Key compromise invalidates the token regardless of time
+	fetcher.crls[testCRLURL] = fx.crl(t, time.Now().Add(time.Minute), ocsp.KeyCompromise)
+	err := fx.tsrsp.VerifyWithRevocation(context.Background(), fx.tsreq, nil, policy)
+	var revErr *rfc3161.RevocationError
+	if !errors.As(err, &revErr) || revErr.Reason != ocsp.KeyCompromise {
+		t.Fatalf("expected key compromise RevocationError, got %v", err)
+	}
+}
+
+func TestRevocationSuppliedCRLAndSoftFail(t *testing.T) {
+	fx := newRevocationFixture(t)
+
+	crl, err := x509.ParseRevocationList(fx.crl(t, time.Time{}, 0))
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	fetcher := &mapFetcher{}
+	policy := &rfc3161.RevocationPolicy{Fetcher: fetcher, DisableOCSP: true, CRLs: []*x509.RevocationList{crl}}
+	if err := fx.tsrsp.VerifyWithRevocation(context.Background(), fx.tsreq, nil, policy); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if fetcher.calls != 0 {
+		t.Errorf("supplied CRL should make fetching unnecessary, got %d fetches", fetcher.calls)
+	}
+
+	policy = &rfc3161.RevocationPolicy{Fetcher: fetcher}
+	err = fx.tsrsp.VerifyWithRevocation(context.Background(), fx.tsreq, nil, policy)
+	if !errors.Is(err, rfc3161.ErrRevocationUnknown) {
+		t.Fatalf("expected ErrRevocationUnknown, got %v", err)
+	}
+
+	policy.SoftFail = true
+	if err := fx.tsrsp.VerifyWithRevocation(context.Background(), fx.tsreq, nil, policy); err != nil {
+		t.Fatalf("%+v", err)
+	}
+}
+
+func TestRevocationCheckChains(t *testing.T) {
+	fx := newRevocationFixture(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	otherRoot, _, _ := newTestPKI(t, key)
+
+	// The OCSP response isn't signed by otherRoot, the status is unknown in the first chain
+	fetcher := &mapFetcher{ocsp: map[string][]byte{testOCSPURL: fx.ocsp(t, ocsp.Good, time.Time{}, 0)}}
+	policy := &rfc3161.RevocationPolicy{Fetcher: fetcher, DisableCRL: true}
+	unknown := []*x509.Certificate{fx.tsaCert, otherRoot}
+	good := []*x509.Certificate{fx.tsaCert, fx.root}
+	if err := policy.CheckChains(context.Background(), [][]*x509.Certificate{unknown, good}, nil, time.Now()); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	err = policy.CheckChains(context.Background(), [][]*x509.Certificate{unknown}, nil, time.Now())
+	if !errors.Is(err, rfc3161.ErrRevocationUnknown) {
+		t.Fatalf("expected ErrRevocationUnknown, got %v", err)
+	}
+}
+
+func TestHTTPRevocationFetcherErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/large.crl" {
+			w.Write(make([]byte, 2048))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	fetcher := rfc3161.NewHTTPRevocationFetcher()
+	fetcher.MaxResponseSize = 1024
+	_, err := fetcher.FetchCRL(context.Background(), srv.URL+"/missing.crl")
+	var fetchErr *rfc3161.RevocationFetchError
+	if !errors.As(err, &fetchErr) || fetchErr.StatusCode != http.StatusNotFound || !errors.Is(err, rfc3161.ErrRevocationFetch) {
+		t.Fatalf("expected RevocationFetchError, got %v", err)
+	}
+	if errors.Is(err, rfc3161.ErrUnexpectedHTTPResponse) || !strings.HasPrefix(err.Error(), "rfc3161: revocation: ") {
+		t.Errorf("fetch error mentions the client: %v", err)
+	}
+	if _, err := fetcher.FetchCRL(context.Background(), srv.URL+"/large.crl"); !errors.Is(err, rfc3161.ErrRevocationResponseTooLarge) {
+		t.Errorf("expected ErrRevocationResponseTooLarge, got %v", err)
+	}
+}
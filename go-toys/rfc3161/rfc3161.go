@@ -34,44 +34,11 @@ var (
 	OidContentTypeTSTInfo = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
 )
 
-// Supported Extensions.
-var supportedExtensions []asn1.ObjectIdentifier
-
 // RootCerts is any additional trusted root certificates.
 // It should only be used for testing.
 // It must be initialized with x509.NewCertPool
 var RootCerts *x509.CertPool
 
-// RegisterExtension registers a supported Extension.
-// This is intended to be called from the init function in
-// packages that implement support for these extensions.
-// A TimeStampReq or TimeStampResp with an unregistered
-// critical extension will return an error when verified.
-func RegisterExtension(extension asn1.ObjectIdentifier) {
-	if supportedExtensions == nil {
-		supportedExtensions = make([]asn1.ObjectIdentifier, 0, 0)
-	}
-
-	// Check if it already exists
-	for _, ext := range supportedExtensions {
-		if ext.Equal(extension) {
-			return
-		}
-	}
-
-	// Add it
-	supportedExtensions = append(supportedExtensions, extension)
-}
-
-// ListExtensions lists all supported extensions
-func ListExtensions() []asn1.ObjectIdentifier {
-	if supportedExtensions == nil {
-		return make([]asn1.ObjectIdentifier, 0, 0)
-	} else {
-		return supportedExtensions
-	}
-}
-
 func setMimeTypes() error {
 	err := mime.AddExtensionType(".tsq", "application/timestamp-query")
 	if err != nil {
@@ -56,3 +56,32 @@ func TestReqBuildManually(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+// The testdata responses carry an RFC 2634 signingCertificate attribute
+func TestSigningCertificateAttribute(t *testing.T) {
+	for _, name := range []string{"sha1", "sha1_nonce"} {
+		resp, err := ReadTSR("./testdata/" + name + ".response.tsr")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := resp.GetSigningCert()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sc, err := resp.SignerInfos[0].GetSigningCertificate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sc == nil || len(sc.Certs) == 0 {
+			t.Fatalf("%s: signingCertificate attribute is missing", name)
+		}
+		err = resp.SignerInfos[0].VerifySigningCertificate(cert)
+		if err != nil {
+			t.Error(err)
+		}
+		err = resp.VerifySignature(cert)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
@@ -0,0 +1,462 @@
+package rfc3161
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"io"
+	"math/big"
+	"mime"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/phayes/cryptoid"
+)
+
+// Errors
+var (
+	ErrTSANoCertificate      = errors.New("rfc3161: tsa: No signing certificate provided")
+	ErrTSANoSigner           = errors.New("rfc3161: tsa: No signer provided")
+	ErrTSANoPolicy           = errors.New("rfc3161: tsa: No default policy provided")
+	ErrTSAKeyMismatch        = errors.New("rfc3161: tsa: Signer does not match the signing certificate")
+	ErrTSAUnsupportedKeyType = errors.New("rfc3161: tsa: Unsupported signing key type")
+)
+
+// DefaultMaxRequestSize is the maximum accepted size of a DER encoded TimeStampReq
+// when TSA.MaxRequestSize is not set.
+const DefaultMaxRequestSize = 64 * 1024
+
+// TSA is a Time-Stamp Authority as defined by RFC 3161.
+// It signs TimeStampReqs and implements http.Handler for the
+// "application/timestamp-query" transport described in RFC 3161 3.4.
+//
+// Use NewTSA to create one. The exported fields may be changed before
+// the TSA starts serving requests.
+type TSA struct {
+	Certificate      *x509.Certificate       // The TSA signing certificate. Its ExtKeyUsage MUST be critical and contain only timeStamping.
+	Intermediates    []*x509.Certificate     // Additional certificates included in the response when the request sets CertReq
+	Signer           crypto.Signer           // Private key of Certificate. RSA (PKCS #1 v1.5), ECDSA and circl ML-DSA keys are supported.
+	Hash             crypto.Hash             // Digest algorithm used for signing the TSTInfo. Defaults to crypto.SHA256, or DefaultMLDSAHash for ML-DSA.
+	Policy           asn1.ObjectIdentifier   // Policy used when the request does not ask for a specific one
+	AcceptedPolicies []asn1.ObjectIdentifier // Additional policies a requester may ask for with ReqPolicy
+	Accuracy         Accuracy                // Accuracy reported in every TSTInfo. Omitted when zero.
+	Ordering         bool                    // Set if serial numbers should be reported as monotonically increasing with time
+	ESSCertIDv1      bool                    // Set to also emit the RFC 2634 signingCertificate (SHA-1) attribute for legacy verifiers
+	IncludeTSAName   bool                    // Set if the TSTInfo should carry the subject of Certificate as the TSA name
+	Extensions       []pkix.Extension        // Extensions added to every TSTInfo, e.g. NewQualifiedTimeStampExtension
+	MaxRequestSize   int64                   // Maximum accepted request body. Defaults to DefaultMaxRequestSize.
+	Now              func() time.Time        // Time source. Defaults to time.Now.
+
+	serialMu   sync.Mutex
+	lastSerial *big.Int
+}
+
+// NewTSA creates a new rfc3161.TSA given the signing certificate, the matching
+// private key and the default TSA policy.
+func NewTSA(cert *x509.Certificate, signer crypto.Signer, policy asn1.ObjectIdentifier) (*TSA, error) {
+	if cert == nil {
+		return nil, ErrTSANoCertificate
+	}
+	if signer == nil {
+		return nil, ErrTSANoSigner
+	}
+	if len(policy) == 0 {
+		return nil, ErrTSANoPolicy
+	}
+
+	hash := crypto.SHA256
+	if pub, _, ok := mldsaPublicKey(signer.Public()); ok {
+		// crypto/x509 may not know ML-DSA, so compare the encoded keys
+		if !mldsaCertMatches(cert, pub) {
+			return nil, ErrTSAKeyMismatch
+		}
+		hash = DefaultMLDSAHash
+	} else {
+		pub, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+		if !ok || !pub.Equal(cert.PublicKey) {
+			return nil, ErrTSAKeyMismatch
+		}
+		switch signer.Public().(type) {
+		case *rsa.PublicKey, *ecdsa.PublicKey:
+		default:
+			return nil, ErrTSAUnsupportedKeyType
+		}
+	}
+
+	tsa := new(TSA)
+	tsa.Certificate = cert
+	tsa.Signer = signer
+	tsa.Hash = hash
+	tsa.Policy = policy
+	tsa.MaxRequestSize = DefaultMaxRequestSize
+	tsa.Now = time.Now
+	return tsa, nil
+}
+
+// ServeHTTP implements http.Handler.
+// It accepts a DER encoded TimeStampReq POSTed with the "application/timestamp-query"
+// content type and answers with a DER encoded TimeStampResp. Requests that can be
+// parsed but not granted are answered with a rejection TimeStampResp, as required by RFC 3161.
+func (tsa *TSA) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "application/timestamp-query" {
+		http.Error(w, http.StatusText(http.StatusUnsupportedMediaType), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	maxSize := tsa.MaxRequestSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxRequestSize
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSize))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		} else {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		}
+		return
+	}
+
+	var resp *TimeStampResp
+	tsq := new(TimeStampReq)
+	rest, err := asn1.Unmarshal(body, tsq)
+	if err != nil || len(rest) != 0 {
+		resp = rejection(FailureDataFormat, "Unable to parse the TimeStampReq")
+	} else {
+		resp = tsa.Respond(tsq)
+	}
+
+	der, err := asn1.Marshal(*resp)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/timestamp-reply")
+	w.WriteHeader(http.StatusOK)
+	w.Write(der)
+}
+
+// Respond creates the Time Stamp Response for the given Time Stamp Request.
+// Invalid or unsupported requests get a rejection response with the
+// appropriate PKIFailureInfo, so the result is never nil.
+func (tsa *TSA) Respond(req *TimeStampReq) *TimeStampResp {
+	if err := req.Verify(); err != nil {
+		switch err {
+		case ErrUnsupportedHash, ErrInvalidDigestSize:
+			return rejection(FailureBadAlg, err.Error())
+		case ErrUnsupportedExt:
+			return rejection(FailureUunacceptedExtension, err.Error())
+		default:
+			return rejection(FailureBadRequest, err.Error())
+		}
+	}
+
+	policy, ok := tsa.policyFor(req.ReqPolicy)
+	if !ok {
+		return rejection(FailureUnacceptedPolicy, "Requested policy "+req.ReqPolicy.String()+" is not supported")
+	}
+
+	tst := TSTInfo{
+		Version:        1,
+		Policy:         policy,
+		MessageImprint: req.MessageImprint,
+		SerialNumber:   tsa.nextSerial(),
+		GenTime:        tsa.now().UTC().Truncate(time.Second),
+		Accuracy:       tsa.Accuracy,
+		Ordering:       tsa.Ordering,
+		Nonce:          req.Nonce,
+	}
+	if tsa.IncludeTSAName {
+		tst.TSA = tsaName(tsa.Certificate)
+	}
+	for _, ext := range tsa.Extensions {
+		tst.Extensions = setExtension(tst.Extensions, ext)
+	}
+
+	token, err := tsa.sign(&tst, req.CertReq)
+	if err != nil {
+		return rejection(FailureSystemFailure, err.Error())
+	}
+
+	return &TimeStampResp{
+		Status:         PKIStatusInfo{Status: StatusGranted},
+		TimeStampToken: *token,
+	}
+}
+
+// TimeStamp creates a TimeStampToken for the digest locally, with the TSA
+// certificate included. It has the same signature as Client.TimeStamp,
+// so a local TSA can stand in for a remote one.
+func (tsa *TSA) TimeStamp(ctx context.Context, hash crypto.Hash, digest []byte) (*TimeStampToken, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	tsq, err := NewTimeStampReq(hash, digest)
+	if err != nil {
+		return nil, err
+	}
+	tsq.CertReq = true
+	resp := tsa.Respond(tsq)
+	if resp.Status.Status.IsError() {
+		return nil, &resp.Status
+	}
+	return &resp.TimeStampToken, nil
+}
+
+// policyFor selects the policy of the TSTInfo for the requested policy
+func (tsa *TSA) policyFor(reqPolicy asn1.ObjectIdentifier) (asn1.ObjectIdentifier, bool) {
+	if len(reqPolicy) == 0 || reqPolicy.Equal(tsa.Policy) {
+		return tsa.Policy, true
+	}
+	for _, accepted := range tsa.AcceptedPolicies {
+		if accepted.Equal(reqPolicy) {
+			return accepted, true
+		}
+	}
+	return nil, false
+}
+
+// now returns the current time of the Now time source
+func (tsa *TSA) now() time.Time {
+	if tsa.Now != nil {
+		return tsa.Now()
+	}
+	return time.Now()
+}
+
+// nextSerial returns a unique, monotonically increasing serial number.
+// Serials are seeded from the Now time source, so they stay unique across restarts
+// as long as the TSA issues less than a billion tokens per second.
+func (tsa *TSA) nextSerial() *big.Int {
+	tsa.serialMu.Lock()
+	defer tsa.serialMu.Unlock()
+
+	next := big.NewInt(tsa.now().UnixNano())
+	if tsa.lastSerial != nil && next.Cmp(tsa.lastSerial) <= 0 {
+		next.Add(tsa.lastSerial, big.NewInt(1))
+	}
+	tsa.lastSerial = next
+	return new(big.Int).Set(next)
+}
+
+// sign wraps the TSTInfo into a SignedData signed by the TSA
+func (tsa *TSA) sign(tst *TSTInfo, certReq bool) (*TimeStampToken, error) {
+	hash := tsa.Hash
+	if hash == 0 {
+		hash = crypto.SHA256
+	}
+	if !hash.Available() {
+		return nil, ErrUnsupportedHash
+	}
+	digestAlgo := pkix.AlgorithmIdentifier{Algorithm: cryptoid.HashAlgorithmByCrypto(hash).OID}
+
+	sigAlgo, err := signatureAlgorithm(tsa.Signer.Public(), hash)
+	if err != nil {
+		return nil, err
+	}
+
+	eContent, err := asn1.Marshal(*tst)
+	if err != nil {
+		return nil, err
+	}
+
+	sid, err := asn1.Marshal(issuerAndSerial{
+		IssuerName:   asn1.RawValue{FullBytes: tsa.Certificate.RawIssuer},
+		SerialNumber: tsa.Certificate.SerialNumber,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	h := hash.New()
+	h.Write(eContent)
+	contentTypeAttr, err := NewAttribute(OidContentType, OidContentTypeTSTInfo)
+	if err != nil {
+		return nil, err
+	}
+	messageDigestAttr, err := NewAttribute(OidMessageDigest, h.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	signedAttrs := []Attribute{contentTypeAttr, messageDigestAttr}
+
+	// RFC 5816: ESSCertIDv2 with the signing digest, unless that is SHA-1
+	if hash != crypto.SHA1 {
+		certID, err := NewESSCertIDv2(tsa.Certificate, hash)
+		if err != nil {
+			return nil, err
+		}
+		signingCertAttr, err := NewAttribute(OidSigningCertificateV2, SigningCertificateV2{Certs: []ESSCertIDv2{certID}})
+		if err != nil {
+			return nil, err
+		}
+		signedAttrs = append(signedAttrs, signingCertAttr)
+	}
+	if hash == crypto.SHA1 || tsa.ESSCertIDv1 {
+		signingCertAttr, err := NewAttribute(OidSigningCertificate, SigningCertificate{Certs: []ESSCertID{NewESSCertID(tsa.Certificate)}})
+		if err != nil {
+			return nil, err
+		}
+		signedAttrs = append(signedAttrs, signingCertAttr)
+	}
+	if err := sortAttributes(signedAttrs); err != nil {
+		return nil, err
+	}
+
+	attrsDER, err := marshalSignedAttrs(signedAttrs)
+	if err != nil {
+		return nil, err
+	}
+	var signature []byte
+	if _, params, ok := mldsaPublicKey(tsa.Signer.Public()); ok {
+		// RFC 9882: pure ML-DSA over the signed attributes, no pre-hashing
+		if !params.allows(hash) {
+			return nil, ErrMLDSADigestTooWeak
+		}
+		signature, err = tsa.Signer.Sign(rand.Reader, attrsDER, crypto.Hash(0))
+	} else {
+		h = hash.New()
+		h.Write(attrsDER)
+		signature, err = tsa.Signer.Sign(rand.Reader, h.Sum(nil), hash)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sd := SignedData{
+		Version:          3,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{digestAlgo},
+		EncapsulatedContentInfo: EncapsulatedContentInfo{
+			EContentType: OidContentTypeTSTInfo,
+			EContent:     eContent,
+		},
+		SignerInfos: []SignerInfo{{
+			Version:            1,
+			SID:                asn1.RawValue{FullBytes: sid},
+			DigestAlgorithm:    digestAlgo,
+			SignedAttrs:        signedAttrs,
+			SignatureAlgorithm: sigAlgo,
+			Signature:          signature,
+		}},
+	}
+	if certReq {
+		var certs []byte
+		certs = append(certs, tsa.Certificate.Raw...)
+		for _, intercert := range tsa.Intermediates {
+			certs = append(certs, intercert.Raw...)
+		}
+		sd.Certificates = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certs}
+	}
+
+	return &TimeStampToken{
+		ContentType: OidSignedData,
+		SignedData:  sd,
+	}, nil
+}
+
+// issuerAndSerial is the encoding side of IssuerAndSerialNumber.
+// It keeps the issuer name exactly as it appears in the certificate.
+type issuerAndSerial struct {
+	IssuerName   asn1.RawValue
+	SerialNumber *big.Int
+}
+
+// NewAttribute creates an Attribute with a single value
+func NewAttribute(attrType asn1.ObjectIdentifier, value interface{}) (Attribute, error) {
+	der, err := asn1.Marshal(value)
+	if err != nil {
+		return Attribute{}, err
+	}
+	set := asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: der}
+	set.FullBytes, err = asn1.Marshal(set)
+	if err != nil {
+		return Attribute{}, err
+	}
+	return Attribute{Type: attrType, Value: set}, nil
+}
+
+// sortAttributes orders the attributes by their DER encoding, as required for a DER SET OF
+func sortAttributes(attrs []Attribute) error {
+	encoded := make([][]byte, len(attrs))
+	for i := range attrs {
+		der, err := asn1.Marshal(attrs[i])
+		if err != nil {
+			return err
+		}
+		encoded[i] = der
+	}
+	sort.Sort(attributesByEncoding{attrs, encoded})
+	return nil
+}
+
+type attributesByEncoding struct {
+	attrs   []Attribute
+	encoded [][]byte
+}
+
+func (a attributesByEncoding) Len() int { return len(a.attrs) }
+func (a attributesByEncoding) Less(i, j int) bool {
+	return bytes.Compare(a.encoded[i], a.encoded[j]) < 0
+}
+func (a attributesByEncoding) Swap(i, j int) {
+	a.attrs[i], a.attrs[j] = a.attrs[j], a.attrs[i]
+	a.encoded[i], a.encoded[j] = a.encoded[j], a.encoded[i]
+}
+
+// signatureAlgorithm gets the SignerInfo.SignatureAlgorithm for the given key and digest
+func signatureAlgorithm(pub crypto.PublicKey, hash crypto.Hash) (pkix.AlgorithmIdentifier, error) {
+	if _, params, ok := mldsaPublicKey(pub); ok {
+		// RFC 9882: the parameters MUST be absent
+		return pkix.AlgorithmIdentifier{Algorithm: params.alg.Oid}, nil
+	}
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		return pkix.AlgorithmIdentifier{Algorithm: cryptoid.RSA.OID, Parameters: asn1.NullRawValue}, nil
+	case *ecdsa.PublicKey:
+		switch hash {
+		case crypto.SHA1:
+			return pkix.AlgorithmIdentifier{Algorithm: cryptoid.ECDSAWithSHA1.OID}, nil
+		case crypto.SHA256:
+			return pkix.AlgorithmIdentifier{Algorithm: cryptoid.ECDSAWithSHA256.OID}, nil
+		case crypto.SHA384:
+			return pkix.AlgorithmIdentifier{Algorithm: cryptoid.ECDSAWithSHA384.OID}, nil
+		case crypto.SHA512:
+			return pkix.AlgorithmIdentifier{Algorithm: cryptoid.ECDSAWithSHA512.OID}, nil
+		}
+		return pkix.AlgorithmIdentifier{}, ErrUnsupportedHash
+	default:
+		return pkix.AlgorithmIdentifier{}, ErrTSAUnsupportedKeyType
+	}
+}
+
+// tsaName creates the TSTInfo.TSA GeneralName (directoryName) from the certificate subject
+func tsaName(cert *x509.Certificate) asn1.RawValue {
+	directoryName, _ := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 4, IsCompound: true, Bytes: cert.RawSubject})
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: directoryName}
+}
+
+// rejection creates a Time Stamp Response without a TimeStampToken
+func rejection(failInfo PKIFailureInfo, statusString string) *TimeStampResp {
+	return &TimeStampResp{
+		Status: PKIStatusInfo{
+			Status:       StatusRejection,
+			StatusString: statusString,
+			FailInfo:     failInfo,
+		},
+	}
+}
@@ -0,0 +1,225 @@
+package rfc3161_test
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bukodi/playground/rfc3161"
+)
+
+var testPolicy = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1}
+
+// newTestPKI creates a root CA and a TSA signing certificate issued by it.
+// The TSA certificate template can be adjusted with tsaTmplOpts.
+func newTestPKI(t *testing.T, tsaKey crypto.Signer, tsaTmplOpts ...func(*x509.Certificate)) (root *x509.Certificate, rootKey crypto.Signer, tsaCert *x509.Certificate) {
+	t.Helper()
+
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	rootTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Root CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	rootDER, err := x509.CreateCertificate(rand.Reader, rootTmpl, rootTmpl, rootKey.Public(), rootKey)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	root, err = x509.ParseCertificate(rootDER)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	// The ExtKeyUsage must be critical, which x509.CreateCertificate doesn't do on its own
+	ekuValue, err := asn1.Marshal([]asn1.ObjectIdentifier{rfc3161.OidExtKeyUsageTimeStamping})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	tsaTmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "Test TSA"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtraExtensions: []pkix.Extension{
+			{Id: rfc3161.OidExtKeyUsage, Critical: true, Value: ekuValue},
+		},
+	}
+	for _, opt := range tsaTmplOpts {
+		opt(tsaTmpl)
+	}
+	tsaDER, err := x509.CreateCertificate(rand.Reader, tsaTmpl, root, tsaKey.Public(), rootKey)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	tsaCert, err = x509.ParseCertificate(tsaDER)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	return root, rootKey, tsaCert
+}
+
+// newTestTSA starts a local TSA over HTTP
+func newTestTSA(t *testing.T, tsaKey crypto.Signer) (*rfc3161.TSA, *httptest.Server) {
+	t.Helper()
+
+	root, _, tsaCert := newTestPKI(t, tsaKey)
+	rfc3161.RootCerts = x509.NewCertPool()
+	rfc3161.RootCerts.AddCert(root)
+
+	tsa, err := rfc3161.NewTSA(tsaCert, tsaKey, testPolicy)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	srv := httptest.NewServer(tsa)
+	t.Cleanup(srv.Close)
+	return tsa, srv
+}
+
+func TestLocalTSA(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	for name, key := range map[string]crypto.Signer{"RSA": rsaKey, "ECDSA": ecKey} {
+		t.Run(name, func(t *testing.T) {
+			tsa, srv := newTestTSA(t, key)
+			tsa.Accuracy = rfc3161.Accuracy{Seconds: 1}
+			tsa.IncludeTSAName = true
+
+			digest := sha256.Sum256([]byte("Hello world!"))
+			tsreq, err := rfc3161.NewTimeStampReq(crypto.SHA256, digest[:])
+			if err != nil {
+				t.Fatalf("%+v", err)
+			}
+			tsreq.CertReq = true
+			if err := tsreq.GenerateNonce(); err != nil {
+				t.Fatalf("%+v", err)
+			}
+
+			tsrsp, err := rfc3161.NewClient(srv.URL).Do(tsreq)
+			if err != nil {
+				t.Fatalf("%+v", err)
+			}
+			if err := tsrsp.Verify(tsreq, nil); err != nil {
+				t.Fatalf("%+v", err)
+			}
+
+			tst, err := tsrsp.GetTSTInfo()
+			if err != nil {
+				t.Fatalf("%+v", err)
+			}
+			if !tst.Policy.Equal(testPolicy) {
+				t.Errorf("policy: got %s, want %s", tst.Policy, testPolicy)
+			}
+			if !bytes.Equal(tst.MessageImprint.HashedMessage, digest[:]) {
+				t.Errorf("message imprint mismatch")
+			}
+			if tst.Accuracy.Duration() != time.Second {
+				t.Errorf("accuracy: got %s", tst.Accuracy.Duration())
+			}
+			if len(tst.TSA.Bytes) == 0 {
+				t.Errorf("TSA name is missing")
+			}
+			if time.Since(tst.GenTime) > time.Minute {
+				t.Errorf("unexpected gen time: %s", tst.GenTime)
+			}
+		})
+	}
+}
+
+func TestLocalTSASerialNumbers(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	tsa, _ := newTestTSA(t, key)
+
+	digest := sha256.Sum256([]byte("Hello world!"))
+	tsreq, err := rfc3161.NewTimeStampReq(crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	var last *big.Int
+	for i := 0; i < 10; i++ {
+		tst, err := tsa.Respond(tsreq).GetTSTInfo()
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+		if last != nil && tst.SerialNumber.Cmp(last) <= 0 {
+			t.Fatalf("serial %s is not greater than %s", tst.SerialNumber, last)
+		}
+		last = tst.SerialNumber
+	}
+
+	// Serials follow the Now time source
+	at := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	tsa.Now = func() time.Time { return at }
+	for i := int64(0); i < 2; i++ {
+		tst, err := tsa.Respond(tsreq).GetTSTInfo()
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+		if want := big.NewInt(at.UnixNano() + i); tst.SerialNumber.Cmp(want) != 0 {
+			t.Errorf("serial %s, want %s", tst.SerialNumber, want)
+		}
+	}
+}
+
+func TestLocalTSARejection(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	_, srv := newTestTSA(t, key)
+	c := rfc3161.NewClient(srv.URL)
+
+	digest := sha256.Sum256([]byte("Hello world!"))
+	tsreq, err := rfc3161.NewTimeStampReq(crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	tsreq.ReqPolicy = asn1.ObjectIdentifier{1, 2, 3, 4}
+
+	tsrsp, err := c.Do(tsreq)
+	if err == nil {
+		t.Fatalf("expected a rejection")
+	}
+	if tsrsp.Status.Status != rfc3161.StatusRejection || tsrsp.Status.FailInfo != rfc3161.FailureUnacceptedPolicy {
+		t.Errorf("unexpected status: %v", err)
+	}
+
+	httpResp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET: got HTTP %d", httpResp.StatusCode)
+	}
+}
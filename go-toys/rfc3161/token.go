@@ -0,0 +1,284 @@
+package rfc3161
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"time"
+
+	"github.com/phayes/cryptoid"
+)
+
+// Errors
+var (
+	ErrNoTimeStampToken = errors.New("rfc3161: token: SignerInfo has no timeStampToken attribute")
+)
+
+// OID Identifiers
+var (
+	// RFC-3161 Appendix A: iso(1) member-body(2) us(840) rsadsi(113549) pkcs(1) pkcs-9(9) smime(16) aa(2) 14
+	OidTimeStampToken = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 14}
+)
+
+// ParseTimeStampToken parses a DER encoded TimeStampToken (a CMS ContentInfo),
+// as found in CMS unsigned attributes or PDF document time-stamps.
+func ParseTimeStampToken(der []byte) (*TimeStampToken, error) {
+	token := new(TimeStampToken)
+	rest, err := asn1.Unmarshal(der, token)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return token, ErrUnrecognizedData
+	}
+	return token, nil
+}
+
+// Marshal gets the DER encoding of the TimeStampToken.
+// A parsed token is returned exactly as it was parsed, unless its fields were changed.
+func (token *TimeStampToken) Marshal() ([]byte, error) {
+	fields := *token
+	fields.Raw = nil
+	der, err := asn1.Marshal(fields)
+	if err != nil || len(token.Raw) == 0 {
+		return der, err
+	}
+
+	// Raw is only valid if the fields still encode like the parsed ones
+	var parsed TimeStampToken
+	if _, err := asn1.Unmarshal(token.Raw, &parsed); err != nil {
+		return der, nil
+	}
+	parsed.Raw = nil
+	parsedDER, err := asn1.Marshal(parsed)
+	if err != nil || !bytes.Equal(parsedDER, der) {
+		return der, nil
+	}
+	return bytes.Clone(token.Raw), nil
+}
+
+// GetHash gets the crypto.Hash of the time-stamped message imprint.
+// The Hash will be 0 if it is not recognized
+func (token *TimeStampToken) GetHash() crypto.Hash {
+	tst, err := token.GetTSTInfo()
+	if err != nil {
+		return 0
+	}
+	hashAlgo, err := cryptoid.HashAlgorithmByOID(tst.MessageImprint.HashAlgorithm.Algorithm.String())
+	if err != nil {
+		return 0
+	}
+	return hashAlgo.Hash
+}
+
+// Verify does a full verification of the TimeStampToken against the digest of
+// the time-stamped data. The digest must be calculated with the hash algorithm
+// of the token, see GetHash. The TSA certificate must be included in the token.
+//
+// WARNING: Does not do any revocation checking. Use VerifyContext for that.
+func (token *TimeStampToken) Verify(digest []byte) error {
+	return token.VerifyContext(context.Background(), digest, nil, nil)
+}
+
+// VerifyContext does the same verification as Verify. cert may be set to nil if the
+// token contains the TSA certificate. A non-nil policy also checks the revocation
+// status of the TSA certificate chain.
+func (token *TimeStampToken) VerifyContext(ctx context.Context, digest []byte, cert *x509.Certificate, policy *RevocationPolicy) error {
+	return token.VerifyAt(ctx, digest, cert, policy, time.Time{})
+}
+
+// VerifyAt does the same verification as VerifyContext, but validates the TSA
+// certificate chain at the given time instead of now. This is how a token is
+// verified that is protected by a later time-stamp, e.g. in an evidence record
+// (RFC 4998), after its TSA certificate has expired.
+func (token *TimeStampToken) VerifyAt(ctx context.Context, digest []byte, cert *x509.Certificate, policy *RevocationPolicy, at time.Time) error {
+	tst, err := token.GetTSTInfo()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(tst.MessageImprint.HashedMessage, digest) {
+		return ErrMismatchedMessageImprint
+	}
+	return token.verify(ctx, tst, cert, policy, at)
+}
+
+// verify checks everything about the token except the message imprint.
+// The certificate chain is validated at the given time, or now if it is zero.
+func (token *TimeStampToken) verify(ctx context.Context, tst *TSTInfo, cert *x509.Certificate, policy *RevocationPolicy, at time.Time) error {
+	// Verify that the OIDs are correct
+	if !token.ContentType.Equal(OidSignedData) || !token.EContentType.Equal(OidContentTypeTSTInfo) {
+		return ErrInvalidOID
+	}
+
+	// The TSTInfo may not have unsupported critical extensions
+	err := checkCriticalExtensions(tst.Extensions)
+	if err != nil {
+		return err
+	}
+
+	// Get the certificate
+	tokencert, err := token.GetSigningCert()
+	if err != nil {
+		return err
+	}
+	// Rationalize the passed-in certificate vis-a-vis certificate in the token
+	if tokencert != nil && cert != nil {
+		if !bytes.Equal(cert.Raw, tokencert.Raw) {
+			return ErrMismatchedCertificates
+		}
+	} else if cert == nil {
+		cert = tokencert
+	}
+	if cert == nil {
+		return ErrNoCertificate
+	}
+
+	// Get any intermediates that might be needed
+	intermediates, err := token.GetCertificates()
+	if err != nil && err != ErrNoCertificate {
+		return err
+	}
+	interpool := x509.NewCertPool()
+	for _, intercert := range intermediates {
+		interpool.AddCert(intercert)
+	}
+
+	// Verify the certificate
+	chains, err := verifyCertificate(cert, interpool, at)
+	if err != nil {
+		return err
+	}
+
+	// Verify the signature
+	err = token.VerifySignature(cert)
+	if err != nil {
+		return err
+	}
+
+	// Check the revocation status of the chain
+	if policy != nil {
+		err = policy.CheckChains(ctx, chains, token.GetCRLs(), tst.GenTime)
+		if err != nil {
+			return err
+		}
+	}
+
+	// All checks pass
+	return nil
+}
+
+// NewSignatureTimeStampReq creates a Time Stamp Request for the signature value of a
+// CMS SignerInfo, as described in RFC 3161 Appendix A. The request has a nonce and
+// asks for the TSA certificate, so the resulting token can be verified on its own.
+func NewSignatureTimeStampReq(hash crypto.Hash, signature []byte) (*TimeStampReq, error) {
+	if !hash.Available() {
+		return nil, ErrUnsupportedHash
+	}
+	h := hash.New()
+	h.Write(signature)
+
+	tsq, err := NewTimeStampReq(hash, h.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	tsq.CertReq = true
+	err = tsq.GenerateNonce()
+	if err != nil {
+		return nil, err
+	}
+	return tsq, nil
+}
+
+// TimeStampSignature gets a verified TimeStampToken for the signature value of a
+// CMS SignerInfo from the TSA. The token can be added to the SignerInfo with
+// SignerInfo.AddTimeStampToken or NewTimeStampTokenAttribute.
+func (client *Client) TimeStampSignature(ctx context.Context, hash crypto.Hash, signature []byte) (*TimeStampToken, error) {
+	tsq, err := NewSignatureTimeStampReq(hash, signature)
+	if err != nil {
+		return nil, err
+	}
+	return client.timeStamp(ctx, tsq)
+}
+
+// TimeStamp gets a verified TimeStampToken for the digest from the TSA.
+// The request has a nonce and asks for the TSA certificate, so the token
+// can be verified on its own.
+func (client *Client) TimeStamp(ctx context.Context, hash crypto.Hash, digest []byte) (*TimeStampToken, error) {
+	tsq, err := NewTimeStampReq(hash, digest)
+	if err != nil {
+		return nil, err
+	}
+	tsq.CertReq = true
+	err = tsq.GenerateNonce()
+	if err != nil {
+		return nil, err
+	}
+	return client.timeStamp(ctx, tsq)
+}
+
+// timeStamp sends the request and verifies the response
+func (client *Client) timeStamp(ctx context.Context, tsq *TimeStampReq) (*TimeStampToken, error) {
+	tsr, err := client.DoContext(ctx, tsq)
+	if err != nil {
+		return nil, err
+	}
+	err = tsr.Verify(tsq, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &tsr.TimeStampToken, nil
+}
+
+// NewTimeStampTokenAttribute creates the id-aa-timeStampToken unsigned attribute
+// holding the token, for signers that build their own CMS SignerInfo.
+func NewTimeStampTokenAttribute(token *TimeStampToken) (Attribute, error) {
+	der, err := token.Marshal()
+	if err != nil {
+		return Attribute{}, err
+	}
+	return NewAttribute(OidTimeStampToken, asn1.RawValue{FullBytes: der})
+}
+
+// AddTimeStampToken adds the token as an id-aa-timeStampToken unsigned attribute.
+// The token should time-stamp the Signature of the SignerInfo.
+func (si *SignerInfo) AddTimeStampToken(token *TimeStampToken) error {
+	attr, err := NewTimeStampTokenAttribute(token)
+	if err != nil {
+		return err
+	}
+	si.UnsignedAtrributes = append(si.UnsignedAtrributes, attr)
+	return sortAttributes(si.UnsignedAtrributes)
+}
+
+// GetTimeStampToken gets the first TimeStampToken from the unsigned attributes.
+// It returns ErrNoTimeStampToken if there is none.
+func (si *SignerInfo) GetTimeStampToken() (*TimeStampToken, error) {
+	for _, attr := range si.UnsignedAtrributes {
+		if attr.Type.Equal(OidTimeStampToken) {
+			return ParseTimeStampToken(attr.Value.Bytes)
+		}
+	}
+	return nil, ErrNoTimeStampToken
+}
+
+// VerifyTimeStampToken verifies the signature time-stamp of the SignerInfo:
+// the TimeStampToken in the unsigned attributes must be valid and must
+// time-stamp the Signature.
+//
+// WARNING: Does not do any revocation checking
+func (si *SignerInfo) VerifyTimeStampToken() error {
+	token, err := si.GetTimeStampToken()
+	if err != nil {
+		return err
+	}
+	hash := token.GetHash()
+	if hash == 0 || !hash.Available() {
+		return ErrUnsupportedHash
+	}
+	h := hash.New()
+	h.Write(si.Signature)
+	return token.Verify(h.Sum(nil))
+}
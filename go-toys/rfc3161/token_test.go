@@ -0,0 +1,184 @@
+package rfc3161_test
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
+	"errors"
+	"testing"
+
+	"github.com/bukodi/playground/rfc3161"
+)
+
+func TestTimeStampTokenRoundTrip(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	tsa, _ := newTestTSA(t, key)
+
+	digest := sha256.Sum256([]byte("Hello world!"))
+	tsreq := newTestReq(t)
+	tsrsp := tsa.Respond(tsreq)
+
+	der, err := tsrsp.TimeStampToken.Marshal()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	token, err := rfc3161.ParseTimeStampToken(der)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if token.GetHash() != crypto.SHA256 {
+		t.Errorf("hash: got %v", token.GetHash())
+	}
+	if err := token.Verify(digest[:]); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	other := sha256.Sum256([]byte("Hello other world!"))
+	if err := token.Verify(other[:]); !errors.Is(err, rfc3161.ErrMismatchedMessageImprint) {
+		t.Errorf("expected ErrMismatchedMessageImprint, got %v", err)
+	}
+
+	der2, err := token.Marshal()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if !bytes.Equal(der, der2) {
+		t.Errorf("parsed token does not marshal to the same DER")
+	}
+}
+
+func TestTimeStampTokenModifiedMarshal(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	tsa, _ := newTestTSA(t, key)
+	tsrsp := tsa.Respond(newTestReq(t))
+
+	der, err := tsrsp.TimeStampToken.Marshal()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	token, err := rfc3161.ParseTimeStampToken(der)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	// Drop the embedded certificates
+	token.Certificates = asn1.RawValue{}
+	modified, err := token.Marshal()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if bytes.Equal(der, modified) {
+		t.Fatalf("modified token marshals to the parsed DER")
+	}
+	reparsed, err := rfc3161.ParseTimeStampToken(modified)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if certs, err := reparsed.GetCertificates(); len(certs) != 0 {
+		t.Errorf("expected no certificates, got %d (%v)", len(certs), err)
+	}
+
+	// The same through the response
+	rspDER, err := tsrsp.Marshal()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	rsp, err := rfc3161.ParseTimeStampResp(rspDER)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	rsp.TimeStampToken.Certificates = asn1.RawValue{}
+	rspDER2, err := rsp.Marshal()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	rsp2, err := rfc3161.ParseTimeStampResp(rspDER2)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if len(rsp2.TimeStampToken.Certificates.Bytes) != 0 {
+		t.Errorf("modified response token still has certificates")
+	}
+}
+
+func TestTimeStampTokenFromResponse(t *testing.T) {
+	resp, err := rfc3161.ReadTSR("./testdata/sha1_nonce.response.tsr")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	der, err := resp.TimeStampToken.Marshal()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	token, err := rfc3161.ParseTimeStampToken(der)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	cert, err := token.GetSigningCert()
+	if err != nil || cert == nil {
+		t.Fatalf("signing cert: %v, %v", cert, err)
+	}
+	if err := token.VerifySignature(cert); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	respDER, err := resp.Marshal()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if !bytes.Contains(respDER, der) {
+		t.Errorf("token DER is not part of the response DER")
+	}
+}
+
+func TestSignatureTimeStamp(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	_, srv := newTestTSA(t, key)
+
+	// The signature of some CMS signer
+	signerInfo := rfc3161.SignerInfo{Version: 1, Signature: []byte("not really a signature")}
+
+	token, err := rfc3161.NewClient(srv.URL).TimeStampSignature(context.Background(), crypto.SHA256, signerInfo.Signature)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if err := signerInfo.AddTimeStampToken(token); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	attr, err := asn1.Marshal(signerInfo.UnsignedAtrributes[0])
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	var parsed rfc3161.Attribute
+	if _, err := asn1.Unmarshal(attr, &parsed); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if !parsed.Type.Equal(rfc3161.OidTimeStampToken) {
+		t.Errorf("attribute type: got %s", parsed.Type)
+	}
+	signerInfo.UnsignedAtrributes = []rfc3161.Attribute{parsed}
+
+	if err := signerInfo.VerifyTimeStampToken(); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	signerInfo.Signature = []byte("a different signature")
+	if err := signerInfo.VerifyTimeStampToken(); !errors.Is(err, rfc3161.ErrMismatchedMessageImprint) {
+		t.Errorf("expected ErrMismatchedMessageImprint, got %v", err)
+	}
+}